@@ -0,0 +1,696 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var archiveFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "from",
+		EnvVar: "FIL_WALLET",
+		Usage:  "specify filecoin wallet to use, default $FIL_WALLET",
+	},
+	cli.StringFlag{
+		Name:  "older-than",
+		Value: "30d",
+		Usage: "archive the objects older than L days, M hours and N minutes, default: 30d",
+	},
+	cli.Uint64Flag{
+		Name:  "slice-size",
+		Value: 17179869184, // 16G
+		Usage: "specify the size of the batches of objects, one or more CAR files each",
+	},
+	cli.StringFlag{
+		Name:  "car-dir",
+		Usage: "specify the local directory of the CAR files and deal csvs of the batches, default: the system temporary directory",
+	},
+	cli.DurationFlag{
+		Name:  "interval",
+		Value: 24 * time.Hour,
+		Usage: "specify the time between two scans of the source, default: 24h",
+	},
+	cli.BoolFlag{
+		Name:  "watch, w",
+		Usage: "also scan the source as soon as a slice worth of objects is uploaded to it",
+	},
+	cli.BoolFlag{
+		Name:  "once",
+		Usage: "scan the source once and exit",
+	},
+	cli.StringFlag{
+		Name:  "price",
+		Value: "0",
+		Usage: "specify the deal price for each GiB of file in FIL, or with a unit like '500 nanoFIL', default: 0",
+	},
+	cli.UintFlag{
+		Name:  "start",
+		Value: uint(defaultStart),
+		Usage: "specify days for miner to process the file, default: 7 or the default of the network",
+	},
+	cli.UintFlag{
+		Name:  "duration",
+		Value: uint(defaultDuration),
+		Usage: "specify length in day to store the file, default: 360 or the default of the network",
+	},
+	cli.StringFlag{
+		Name:   "network",
+		EnvVar: networkEnv,
+		Value:  defaultNetwork,
+		Usage:  "specify the network profile used to compute epochs, mainnet, calibnet or one of the config file",
+	},
+	cli.BoolFlag{
+		Name:  "verified",
+		Usage: "propose verified deals",
+	},
+	cli.DurationFlag{
+		Name:  "car-url-expire",
+		Value: shareDefaultExpiry,
+		Usage: "with --upload-to, expiry of the CAR download URLs written to the deal csv, default: 168h",
+	},
+	cli.IntFlag{
+		Name:  "max-retries",
+		Value: 3,
+		Usage: "specify how many times to retry a failed proposal with an exponential backoff, default: 3",
+	},
+	cli.DurationFlag{
+		Name:  "miner-interval",
+		Value: time.Second,
+		Usage: "specify the minimum time between two deals proposed to the same miner, default: 1s",
+	},
+	cli.StringFlag{
+		Name:  "monitoring-address",
+		Usage: "if specified, a new prometheus endpoint will be created to report archiving activity. (eg: localhost:8081)",
+	},
+}
+
+var archiveCmd = cli.Command{
+	Name:         "archive",
+	Usage:        "keep archiving the objects of a bucket to filecoin",
+	Action:       mainArchive,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(append(archiveFlags, uploadFlags...), globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] SOURCE MINER-ID [MINER-ID...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Periodically list SOURCE, an mc URL such as myminio/bucket/prefix, and archive the
+  objects older than --older-than which are not archived yet. Objects are batched into
+  slices of --slice-size, each batch is turned into CAR files in --car-dir with its
+  manifest and deal csv, and a deal is proposed to every MINER-ID for each of its
+  pieces. With --upload-to, the CAR files are uploaded and shared so that miners can
+  download them, else they are left in --car-dir to be shipped to the miners.
+
+  Archived objects are tagged with their data CID, piece CID, deal CID and miner, and
+  recorded in a state file under the config directory; objects with a data CID tag
+  are never archived again, nor are the objects of the state file unless they change.
+  An object split over several slices is archived once all of them have a deal. The CAR
+  files which are uploaded, or of slices without any deal, are removed from --car-dir.
+
+EXAMPLES:
+  1. Archive the objects of a bucket older than 30 days to two miners, every day.
+     {{.Prompt}} {{.HelpName}} --from f3rv...xyz --car-dir /data/archive myminio/dataset f01276 f01234
+
+  2. Archive new objects as soon as 32GiB of them are uploaded, with CAR files shared from a bucket.
+     {{.Prompt}} {{.HelpName}} --from f3rv...xyz --older-than 0s --watch --slice-size 34359738368 \
+        --upload-to myminio/swan/archive myminio/dataset f01276
+
+  3. Report the archiving activity to prometheus.
+     {{.Prompt}} {{.HelpName}} --from f3rv...xyz --monitoring-address localhost:8081 myminio/dataset f01276
+`,
+}
+
+var (
+	archiveTotalObjects = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_total_objects",
+		Help: "The total number of objects archived",
+	})
+	archiveTotalArchivedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_total_archived_bytes",
+		Help: "The total number of bytes archived",
+	})
+	archiveTotalDeals = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_total_deals",
+		Help: "The total number of deals proposed",
+	})
+	archiveFailedDeals = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_failed_deals",
+		Help: "The total number of deals which could not be proposed",
+	})
+	archiveFailedBatches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_failed_batches",
+		Help: "The total number of batches which could not be turned into CAR files",
+	})
+	archiveTotalScans = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mc_archive_total_scans",
+		Help: "The number of scans of the source",
+	})
+)
+
+// archiveMessage container for archived slice messages.
+type archiveMessage struct {
+	Status   string   `json:"status"`
+	Batch    string   `json:"batch"`
+	DataCid  string   `json:"dataCid"`
+	PieceCid string   `json:"pieceCid"`
+	Objects  int      `json:"objects"`
+	Size     int64    `json:"size"`
+	DealCids []string `json:"dealCids"`
+}
+
+// JSON jsonified archive message.
+func (a archiveMessage) JSON() string {
+	archiveJSONBytes, e := json.MarshalIndent(a, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(archiveJSONBytes)
+}
+
+// String colorized archive message.
+func (a archiveMessage) String() string {
+	return fmt.Sprintf("Batch: %s, DataCid: %s, Objects: %d, Deals: %s", a.Batch, a.DataCid, a.Objects, strings.Join(a.DealCids, ","))
+}
+
+// archiveJob archives the objects of a source URL.
+type archiveJob struct {
+	cliCtx     *cli.Context
+	sourceURL  string
+	alias      string
+	olderThan  string
+	sliceSize  int64
+	carDir     string
+	uploadTo   string
+	urlExpiry  time.Duration
+	miners     []string
+	wallet     string
+	price      *big.Int
+	network    networkConfigV10
+	start      uint
+	duration   uint
+	verified   bool
+	maxRetries int
+
+	api       *lotusClient
+	preflight *dealPreflight
+	limiter   *minerRateLimiter
+	db        *archiveDBV1
+	dbFile    string
+}
+
+// archiveBatches groups objects into batches of at most sliceSize bytes, an
+// object larger than sliceSize is a batch on its own.
+func archiveBatches(contents []*ClientContent, sliceSize int64) [][]*ClientContent {
+	var batches [][]*ClientContent
+	var batch []*ClientContent
+	var batchSize int64
+	for _, content := range contents {
+		if len(batch) > 0 && batchSize+content.Size > sliceSize {
+			batches = append(batches, batch)
+			batch, batchSize = nil, 0
+		}
+		batch = append(batch, content)
+		batchSize += content.Size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// archivedObjectName returns the path of an object in the CAR files of its
+// batch.
+func archivedObjectName(content *ClientContent) string {
+	return strings.TrimPrefix(content.URL.Path, string(content.URL.Separator))
+}
+
+// objectURL returns the mc URL of an object of the source.
+func (j *archiveJob) objectURL(content *ClientContent) string {
+	return j.alias + content.URL.Path
+}
+
+// pendingObjects lists the objects of the source which are old enough and not
+// archived yet, the objects tagged by another archive are added to the state.
+func (j *archiveJob) pendingObjects(ctx context.Context) ([]*ClientContent, *probe.Error) {
+	clnt, err := newClient(j.sourceURL)
+	if err != nil {
+		return nil, err.Trace(j.sourceURL)
+	}
+	var pending []*ClientContent
+	for content := range clnt.List(ctx, ListOptions{Recursive: true, ShowDir: DirNone}) {
+		if content.Err != nil {
+			return nil, content.Err.Trace(j.sourceURL)
+		}
+		if content.Type.IsDir() || isOlder(content.Time, j.olderThan) {
+			continue
+		}
+		objectURL := j.objectURL(content)
+		if j.db.isArchived(objectURL, content.ETag) {
+			continue
+		}
+		if objectClnt, err := newClientFromAlias(j.alias, content.URL.String()); err == nil {
+			if tags, err := objectClnt.GetTags(ctx, content.VersionID); err == nil && tags[filDataCidTag] != "" {
+				j.db.Set(objectURL, archiveObjectV1{
+					ETag:     content.ETag,
+					Size:     content.Size,
+					DataCid:  tags[filDataCidTag],
+					PieceCid: tags[filPieceCidTag],
+					DealCids: strings.Fields(tags[filDealCidTag]),
+					Date:     UTCNow(),
+				})
+				continue
+			}
+		}
+		pending = append(pending, content)
+	}
+	return pending, j.db.Save(j.dbFile)
+}
+
+// buildBatch streams the objects of a batch into its CAR files, it returns
+// the slices of the batch from its manifest.
+func (j *archiveJob) buildBatch(ctx context.Context, batchName, batchDir string, contents []*ClientContent) ([]*OfflineDeal, *probe.Error) {
+	var sources []carSource
+	for _, content := range contents {
+		source, err := newCarObjectSource(ctx, j.alias, archivedObjectName(content), content)
+		if err != nil {
+			return nil, err.Trace(batchName)
+		}
+		sources = append(sources, source)
+	}
+	sortCarSources(sources)
+	if e := os.MkdirAll(batchDir, 0700); e != nil {
+		return nil, probe.NewError(e).Trace(batchDir)
+	}
+	err := chunkCarSources(ctx, sources, j.sliceSize, batchDir, batchName, 1, func(slice *OfflineDeal, carPath string) *probe.Error {
+		return appendCarManifest(batchDir, slice)
+	})
+	if err != nil {
+		return nil, err.Trace(batchName)
+	}
+	slices, err := readDealCsv(filepath.Join(batchDir, carManifestName))
+	if err != nil {
+		return nil, err.Trace(batchName)
+	}
+	if len(slices) == 0 {
+		return nil, errInvalidArgument().Trace(batchName)
+	}
+	return slices, nil
+}
+
+// shareBatch uploads the CAR files of a batch and sets the URL miners
+// download them from.
+func (j *archiveJob) shareBatch(ctx context.Context, batchDir string, slices []*OfflineDeal) *probe.Error {
+	var carPaths []string
+	carSlices := make(map[string]*OfflineDeal)
+	for _, slice := range slices {
+		carPath := findSliceCar(batchDir, slice)
+		if carPath == "" {
+			return errInvalidArgument().Trace(filepath.Join(batchDir, slice.DataCid+".car"))
+		}
+		carPaths = append(carPaths, carPath)
+		carSlices[carPath] = slice
+	}
+	if err := uploadFiles(j.cliCtx, carPaths, j.uploadTo); err != nil {
+		return err.Trace(j.uploadTo)
+	}
+	carURLs, err := shareUploadedFiles(ctx, carPaths, j.uploadTo, j.urlExpiry)
+	if err != nil {
+		return err.Trace(j.uploadTo)
+	}
+	expiryTime := UTCNow().Add(j.urlExpiry).Format(time.RFC3339)
+	for carPath, carURL := range carURLs {
+		carSlices[carPath].CarUrl = carURL
+		carSlices[carPath].CarUrlExpiry = expiryTime
+	}
+	return nil
+}
+
+// proposeSlice proposes the deals of a slice to every miner, it returns the
+// deals proposed.
+func (j *archiveJob) proposeSlice(ctx context.Context, dealCsvPath string, slice *OfflineDeal) []OfflineDeal {
+	var proposed []OfflineDeal
+	for _, miner := range j.miners {
+		deal := *slice
+		deal.MinerId = miner
+		deal.SenderWallet = j.wallet
+		deal.VerifiedDeal = j.verified
+		// The start epoch is computed for each deal, the job runs for days.
+		deal.StartEpoch = strconv.FormatUint(uint64(calculateStartEpoch(j.network, j.start)), 10)
+		deal.Duration = strconv.FormatUint(uint64(calculateDuration(j.network, j.duration)), 10)
+		epochPrice, err := calculateCost(j.price, deal.PieceSize)
+		if err == nil {
+			deal.Cost = formatFIL(epochPrice)
+			if violations := j.preflight.check(ctx, deal, MinerMessage{MinerID: miner}); len(violations) > 0 {
+				err = errInvalidArgument().Trace(strings.Join(violations, ", "))
+			}
+		}
+		if err == nil {
+			err = proposeOfflineDealWithRetry(ctx, j.api, j.limiter, &deal, j.maxRetries)
+		}
+		if err != nil {
+			errorIf(err.Trace(deal.DataCid, miner), "Unable to propose deal for `"+deal.DataCid+"` to miner `"+miner+"`.")
+			archiveFailedDeals.Inc()
+			continue
+		}
+		writeCsv(dealCsvPath, deal)
+		archiveTotalDeals.Inc()
+		proposed = append(proposed, deal)
+	}
+	return proposed
+}
+
+// dealtObjects returns the source objects of a batch whose slices all have
+// a deal, by object name. An object split over several slices is not
+// archived until every part of it is stored.
+func dealtObjects(batchDir string, slices []*OfflineDeal, summaries []sendReplicaMessage) (map[string]*sourceObject, *probe.Error) {
+	sliceCounts := make(map[string]int)
+	for _, slice := range slices {
+		files, err := sliceFiles(batchDir, slice)
+		if err != nil {
+			return nil, err.Trace(slice.DataCid)
+		}
+		for _, file := range files {
+			sliceCounts[file]++
+		}
+	}
+	objects, err := collectSourceObjects(batchDir, slices, summaries, 0)
+	if err != nil {
+		return nil, err.Trace(batchDir)
+	}
+	dealt := make(map[string]*sourceObject)
+	for _, object := range objects {
+		if len(object.slices) == sliceCounts[object.name] {
+			dealt[strings.TrimPrefix(object.name, "/")] = object
+		}
+	}
+	return dealt, nil
+}
+
+// pruneBatch removes the CAR files of a batch which are not needed anymore:
+// those of the slices without any deal, and all of them once uploaded. The
+// directory of a batch without any deal is removed.
+func (j *archiveJob) pruneBatch(batchDir string, slices []*OfflineDeal, summaries []sendReplicaMessage) {
+	dealt := false
+	for i, slice := range slices {
+		if summaries[i].Replicas > 0 {
+			dealt = true
+			if j.uploadTo == "" {
+				continue
+			}
+		}
+		if carPath := findSliceCar(batchDir, slice); carPath != "" {
+			errorIf(probe.NewError(os.Remove(carPath)).Trace(carPath), "Unable to remove `"+carPath+"`.")
+		}
+	}
+	if !dealt {
+		errorIf(probe.NewError(os.RemoveAll(batchDir)).Trace(batchDir), "Unable to remove `"+batchDir+"`.")
+	}
+}
+
+// archiveBatch archives a batch of objects, the objects with a slice without
+// any deal are left for the next scan.
+func (j *archiveJob) archiveBatch(ctx context.Context, batchName string, contents []*ClientContent) bool {
+	batchDir := filepath.Join(j.carDir, batchName)
+	slices, err := j.buildBatch(ctx, batchName, batchDir, contents)
+	if err != nil {
+		errorIf(err, "Unable to generate the CAR files of batch `"+batchName+"`.")
+		errorIf(probe.NewError(os.RemoveAll(batchDir)).Trace(batchDir), "Unable to remove `"+batchDir+"`.")
+		archiveFailedBatches.Inc()
+		return false
+	}
+	if j.uploadTo != "" {
+		if err = j.shareBatch(ctx, batchDir, slices); err != nil {
+			errorIf(err, "Unable to upload the CAR files of batch `"+batchName+"`.")
+			errorIf(probe.NewError(os.RemoveAll(batchDir)).Trace(batchDir), "Unable to remove `"+batchDir+"`.")
+			archiveFailedBatches.Inc()
+			return false
+		}
+	}
+
+	ok := true
+	dealCsvPath := filepath.Join(batchDir, fmt.Sprintf("dealMetadata-%s.csv", batchName))
+	summaries := make([]sendReplicaMessage, len(slices))
+	msgs := make(map[*OfflineDeal]*archiveMessage)
+	for i, slice := range slices {
+		deals := j.proposeSlice(ctx, dealCsvPath, slice)
+		if len(deals) == 0 {
+			ok = false
+			continue
+		}
+		msg := &archiveMessage{Status: "success", Batch: batchName, DataCid: slice.DataCid, PieceCid: slice.PieceCid}
+		for _, deal := range deals {
+			msg.DealCids = append(msg.DealCids, deal.DealCid)
+			summaries[i].Miners = append(summaries[i].Miners, deal.MinerId)
+		}
+		summaries[i].Replicas = len(deals)
+		summaries[i].DealCids = msg.DealCids
+		msgs[slice] = msg
+	}
+	defer j.pruneBatch(batchDir, slices, summaries)
+
+	dealt, err := dealtObjects(batchDir, slices, summaries)
+	if err != nil {
+		errorIf(err, "Unable to find the objects of batch `"+batchName+"`.")
+		return false
+	}
+	for _, content := range contents {
+		object, found := dealt[archivedObjectName(content)]
+		if !found {
+			ok = false
+			continue
+		}
+		objectURL := j.objectURL(content)
+		j.db.Set(objectURL, archiveObjectV1{
+			ETag:     content.ETag,
+			Size:     content.Size,
+			DataCid:  object.slices[0].DataCid,
+			PieceCid: object.slices[0].PieceCid,
+			DealCids: object.dealCids,
+			Date:     UTCNow(),
+		})
+		errorIf(tagDealObject(ctx, objectURL, object.tags(dealCsvPath)), "Unable to tag `"+objectURL+"`.")
+		for _, slice := range object.slices {
+			msgs[slice].Objects++
+			msgs[slice].Size += content.Size
+		}
+		archiveTotalObjects.Inc()
+		archiveTotalArchivedBytes.Add(float64(content.Size))
+	}
+	for _, slice := range slices {
+		if msg, found := msgs[slice]; found {
+			printMsg(*msg)
+		}
+	}
+	errorIf(j.db.Save(j.dbFile), "Unable to save the archive state.")
+	return ok
+}
+
+// scan archives the pending objects of the source.
+func (j *archiveJob) scan(ctx context.Context) bool {
+	archiveTotalScans.Inc()
+	pending, err := j.pendingObjects(ctx)
+	if err != nil {
+		errorIf(err, "Unable to list `"+j.sourceURL+"`.")
+		return false
+	}
+	ok := true
+	batchTime := UTCNow().Format("20060102T150405")
+	for i, batch := range archiveBatches(pending, j.sliceSize) {
+		if ctx.Err() != nil {
+			return false
+		}
+		if !j.archiveBatch(ctx, fmt.Sprintf("archive-%s-%d", batchTime, i+1), batch) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func checkArchiveArgs(ctx *cli.Context) (string, []string) {
+	args := ctx.Args()
+	if len(args) < 2 {
+		cli.ShowCommandHelpAndExit(ctx, "archive", globalErrorExitStatus)
+	}
+	for _, arg := range args {
+		if strings.TrimSpace(arg) == "" {
+			fatalIf(errInvalidArgument().Trace(args...), "Unable to validate empty argument.")
+		}
+	}
+	sourceURL := args[0]
+	fatalIf(checkUploadTarget(sourceURL), "Unable to archive `"+sourceURL+"`, please provide an mc URL such as myminio/bucket.")
+	if uploadTo := ctx.String("upload-to"); uploadTo != "" {
+		fatalIf(checkUploadTarget(uploadTo), "Unable to upload to `"+uploadTo+"`.")
+	}
+	if strings.TrimSpace(ctx.String("from")) == "" {
+		fatalIf(errInvalidArgument(), "please provide a valid wallet")
+	}
+	if ctx.Uint64("slice-size") == 0 {
+		fatalIf(errInvalidArgument(), "please provide a valid slice size")
+	}
+	if ctx.Uint("start") == 0 {
+		fatalIf(errInvalidArgument(), "please provide a valid length of start time in day")
+	}
+	if ctx.Uint("duration") == 0 {
+		fatalIf(errInvalidArgument(), "please provide a valid length of duration in day")
+	}
+	if !ctx.Bool("once") && ctx.Duration("interval") <= 0 {
+		fatalIf(errInvalidArgument().Trace(ctx.Duration("interval").String()), "Please provide a positive scan interval.")
+	}
+	if ctx.Int("max-retries") < 0 {
+		fatalIf(errInvalidArgument().Trace(ctx.String("max-retries")), "please provide a valid number of retries")
+	}
+	return sourceURL, args[1:]
+}
+
+// newArchiveJob returns the archive job of the command line.
+func newArchiveJob(cliCtx *cli.Context, sourceURL string, miners []string) *archiveJob {
+	price, err := parseFIL(cliCtx.String("price"))
+	if err != nil || price.Sign() < 0 {
+		fatalIf(errInvalidArgument().Trace(cliCtx.String("price")), "please provide a valid price")
+	}
+	network, err := loadNetwork(cliCtx.String("network"))
+	fatalIf(err, "Unable to load the network profile.")
+	start, duration := cliCtx.Uint("start"), cliCtx.Uint("duration")
+	if !cliCtx.IsSet("start") && network.DefaultStart > 0 {
+		start = network.DefaultStart
+	}
+	if !cliCtx.IsSet("duration") && network.DefaultDuration > 0 {
+		duration = network.DefaultDuration
+	}
+
+	carDir := strings.TrimSpace(cliCtx.String("car-dir"))
+	if carDir == "" {
+		carDir = filepath.Join(os.TempDir(), "mc-archive")
+	}
+	carDir, e := filepath.Abs(carDir)
+	fatalIf(probe.NewError(e), "Unable to find the CAR directory.")
+
+	alias, _, _, err := expandAlias(sourceURL)
+	fatalIf(err, "Unable to expand `"+sourceURL+"`.")
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	dbFile, err := getArchiveDBFile(sourceURL)
+	fatalIf(err, "Unable to find the archive state.")
+	db := newArchiveDBV1()
+	fatalIf(db.Load(dbFile), "Unable to load the archive state.")
+
+	if cliCtx.String("upload-to") != "" {
+		initShareConfig()
+	}
+	return &archiveJob{
+		cliCtx:     cliCtx,
+		sourceURL:  sourceURL,
+		alias:      alias,
+		olderThan:  cliCtx.String("older-than"),
+		sliceSize:  int64(cliCtx.Uint64("slice-size")),
+		carDir:     carDir,
+		uploadTo:   cliCtx.String("upload-to"),
+		urlExpiry:  cliCtx.Duration("car-url-expire"),
+		miners:     miners,
+		wallet:     strings.TrimSpace(cliCtx.String("from")),
+		price:      price,
+		network:    network,
+		start:      start,
+		duration:   duration,
+		verified:   cliCtx.Bool("verified"),
+		maxRetries: cliCtx.Int("max-retries"),
+		api:        api,
+		preflight:  newDealPreflight(network, api),
+		limiter:    newMinerRateLimiter(cliCtx.Duration("miner-interval")),
+		db:         db,
+		dbFile:     dbFile,
+	}
+}
+
+// mainArchive is the handle for "mc archive" command.
+func mainArchive(cliCtx *cli.Context) error {
+	sourceURL, miners := checkArchiveArgs(cliCtx)
+
+	ctx, cancelArchive := context.WithCancel(globalContext)
+	defer cancelArchive()
+
+	job := newArchiveJob(cliCtx, sourceURL, miners)
+	if prometheusAddress := cliCtx.String("monitoring-address"); prometheusAddress != "" {
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if e := http.ListenAndServe(prometheusAddress, nil); e != nil {
+				fatalIf(probe.NewError(e), "Unable to setup monitoring endpoint.")
+			}
+		}()
+	}
+
+	if cliCtx.Bool("once") {
+		if !job.scan(ctx) {
+			return exitStatus(globalErrorExitStatus)
+		}
+		return nil
+	}
+
+	// With --watch, the uploads to the source trigger a scan as soon as a
+	// slice worth of objects is uploaded.
+	var events chan []EventInfo
+	var watchErrors chan *probe.Error
+	if cliCtx.Bool("watch") {
+		clnt, err := newClient(sourceURL)
+		fatalIf(err, "Unable to initialize `"+sourceURL+"`.")
+		wo, err := clnt.Watch(ctx, WatchOptions{Recursive: true, Events: []string{"put"}})
+		fatalIf(err, "Unable to watch `"+sourceURL+"`.")
+		defer close(wo.DoneChan)
+		events, watchErrors = wo.Events(), wo.Errors()
+	}
+
+	interval := cliCtx.Duration("interval")
+	for {
+		job.scan(ctx)
+		timer := time.NewTimer(interval)
+		var uploaded int64
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+				break wait
+			case err, ok := <-watchErrors:
+				if !ok || err != nil {
+					errorIf(err, "Unable to watch `"+sourceURL+"`, scanning every "+interval.String()+" only.")
+					events, watchErrors = nil, nil
+				}
+			case eventInfos, ok := <-events:
+				if !ok {
+					events, watchErrors = nil, nil
+					continue
+				}
+				for _, event := range eventInfos {
+					uploaded += event.Size
+				}
+				if uploaded >= job.sliceSize {
+					timer.Stop()
+					break wait
+				}
+			}
+		}
+	}
+}
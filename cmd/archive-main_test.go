@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestArchiveBatches(t *testing.T) {
+	sizes := func(batches [][]*ClientContent) []int {
+		var counts []int
+		for _, batch := range batches {
+			counts = append(counts, len(batch))
+		}
+		return counts
+	}
+	objects := func(sizes ...int64) []*ClientContent {
+		var contents []*ClientContent
+		for _, size := range sizes {
+			contents = append(contents, &ClientContent{Size: size})
+		}
+		return contents
+	}
+	testCases := []struct {
+		contents []*ClientContent
+		expected []int
+	}{
+		{objects(40, 40, 40), []int{2, 1}},
+		{objects(100, 10, 10), []int{1, 2}},
+		{objects(150, 10), []int{1, 1}},
+		{objects(50, 50), []int{2}},
+		{nil, nil},
+	}
+	for i, testCase := range testCases {
+		counts := sizes(archiveBatches(testCase.contents, 100))
+		if len(counts) != len(testCase.expected) {
+			t.Fatalf("Test %d: expected batches %v, got %v", i+1, testCase.expected, counts)
+		}
+		for j := range counts {
+			if counts[j] != testCase.expected[j] {
+				t.Errorf("Test %d: expected batches %v, got %v", i+1, testCase.expected, counts)
+			}
+		}
+	}
+}
+
+func TestArchivedObjectName(t *testing.T) {
+	content := &ClientContent{URL: ClientURL{Type: objectStorage, Path: "/dataset/2021/a.zip", Separator: '/'}}
+	if name := archivedObjectName(content); name != "dataset/2021/a.zip" {
+		t.Errorf("expected dataset/2021/a.zip, got %s", name)
+	}
+	job := &archiveJob{alias: "myminio"}
+	if objectURL := job.objectURL(content); objectURL != "myminio/dataset/2021/a.zip" {
+		t.Errorf("expected myminio/dataset/2021/a.zip, got %s", objectURL)
+	}
+}
+
+func TestDealtObjects(t *testing.T) {
+	// dir/big.txt is split over the two slices.
+	slices := []*OfflineDeal{
+		{DataCid: "bafy1", PieceCid: "baga1", Detail: `{"Name":"","Link":[{"Name":"dir","Link":[{"Name":"a.txt","Size":5},{"Name":"big.txt","Size":10}]}]}`},
+		{DataCid: "bafy2", PieceCid: "baga2", Detail: `{"Name":"","Link":[{"Name":"dir","Link":[{"Name":"big.txt","Size":10},{"Name":"c.txt","Size":5}]}]}`},
+	}
+	dealt := sendReplicaMessage{Replicas: 1, Miners: []string{"f01000"}, DealCids: []string{"bafyrei1"}}
+	testCases := []struct {
+		summaries []sendReplicaMessage
+		expected  []string
+	}{
+		{[]sendReplicaMessage{dealt, dealt}, []string{"dir/a.txt", "dir/big.txt", "dir/c.txt"}},
+		{[]sendReplicaMessage{dealt, {}}, []string{"dir/a.txt"}},
+		{[]sendReplicaMessage{{}, dealt}, []string{"dir/c.txt"}},
+		{[]sendReplicaMessage{{}, {}}, nil},
+	}
+	for i, testCase := range testCases {
+		objects, err := dealtObjects("batch", slices, testCase.summaries)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		var names []string
+		for name := range objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, testCase.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.expected, names)
+		}
+	}
+
+	objects, err := dealtObjects("batch", slices, []sendReplicaMessage{dealt, dealt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := objects["dir/big.txt"].tags("dealMetadata-archive.csv")
+	if tags[filDataCidTag] != "bafy1" || tags[filSlicesTag] != "2" || tags[filDealCidTag] != "bafyrei1 bafyrei1" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestPruneBatch(t *testing.T) {
+	carDir, e := ioutil.TempDir("", "mc-archive")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(carDir)
+
+	slices := []*OfflineDeal{{DataCid: "bafy1"}, {DataCid: "bafy2"}}
+	dealt := sendReplicaMessage{Replicas: 1}
+	testCases := []struct {
+		uploadTo  string
+		summaries []sendReplicaMessage
+		expected  []string
+	}{
+		// The CAR files of the deals are left to be shipped to the miners.
+		{"", []sendReplicaMessage{dealt, {}}, []string{"bafy1.car", carManifestName}},
+		// Uploaded CAR files are not needed anymore.
+		{"myminio/swan", []sendReplicaMessage{dealt, {}}, []string{carManifestName}},
+		// A batch without any deal is removed.
+		{"", []sendReplicaMessage{{}, {}}, nil},
+	}
+	for i, testCase := range testCases {
+		batchDir := filepath.Join(carDir, "batch")
+		if e = os.MkdirAll(batchDir, 0700); e != nil {
+			t.Fatal(e)
+		}
+		for _, name := range []string{"bafy1.car", "bafy2.car", carManifestName} {
+			if e = ioutil.WriteFile(filepath.Join(batchDir, name), []byte(name), 0600); e != nil {
+				t.Fatal(e)
+			}
+		}
+		job := &archiveJob{carDir: carDir, uploadTo: testCase.uploadTo}
+		job.pruneBatch(batchDir, slices, testCase.summaries)
+
+		var names []string
+		files, _ := ioutil.ReadDir(batchDir)
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		if !reflect.DeepEqual(names, testCase.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.expected, names)
+		}
+		os.RemoveAll(batchDir)
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/minio/pkg/quick"
+)
+
+// archiveStateDir is where `archive` keeps its state, under the config dir.
+const archiveStateDir = "archive"
+
+// archiveObjectV1 records the deals an object was archived with.
+type archiveObjectV1 struct {
+	ETag     string    `json:"etag"`
+	Size     int64     `json:"size"`
+	DataCid  string    `json:"dataCid"`
+	PieceCid string    `json:"pieceCid,omitempty"`
+	DealCids []string  `json:"dealCids,omitempty"`
+	Date     time.Time `json:"date"`
+}
+
+// archiveDBV1 is the JSON file of the objects archived from a source.
+type archiveDBV1 struct {
+	Version string `json:"version"`
+
+	// key is the object URL.
+	Objects map[string]archiveObjectV1 `json:"objects"`
+}
+
+// newArchiveDBV1 returns an empty archive state.
+func newArchiveDBV1() *archiveDBV1 {
+	return &archiveDBV1{
+		Version: "1",
+		Objects: make(map[string]archiveObjectV1),
+	}
+}
+
+// getArchiveDBFile returns the state file of the archive of a source URL.
+func getArchiveDBFile(sourceURL string) (string, *probe.Error) {
+	configDir, err := getMcConfigDir()
+	if err != nil {
+		return "", err.Trace()
+	}
+	sum := sha256.Sum256([]byte(sourceURL))
+	return filepath.Join(configDir, archiveStateDir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// isArchived returns true if the object was archived with the same content.
+func (a *archiveDBV1) isArchived(objectURL, etag string) bool {
+	object, ok := a.Objects[objectURL]
+	return ok && object.ETag == etag
+}
+
+// Set records the archive of an object.
+func (a *archiveDBV1) Set(objectURL string, object archiveObjectV1) {
+	a.Objects[objectURL] = object
+}
+
+// Load reads the archive state from disk, a missing file is an empty state.
+func (a *archiveDBV1) Load(filename string) *probe.Error {
+	if _, e := os.Stat(filename); os.IsNotExist(e) {
+		return nil
+	}
+	qs, e := quick.NewConfig(newArchiveDBV1(), nil)
+	if e != nil {
+		return probe.NewError(e).Trace(filename)
+	}
+	if e = qs.Load(filename); e != nil {
+		return probe.NewError(e).Trace(filename)
+	}
+	for k, v := range qs.Data().(*archiveDBV1).Objects {
+		a.Objects[k] = v
+	}
+	return nil
+}
+
+// Save persists the archive state to disk.
+func (a *archiveDBV1) Save(filename string) *probe.Error {
+	if e := os.MkdirAll(filepath.Dir(filename), 0700); e != nil {
+		return probe.NewError(e).Trace(filename)
+	}
+	qs, e := quick.NewConfig(a, nil)
+	if e != nil {
+		return probe.NewError(e).Trace(filename)
+	}
+	if e = qs.Save(filename); e != nil {
+		return probe.NewError(e).Trace(filename)
+	}
+	return nil
+}
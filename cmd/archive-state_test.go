@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveDB(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-archive")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, archiveStateDir, "state.json")
+
+	db := newArchiveDBV1()
+	if err := db.Load(dbFile); err != nil {
+		t.Fatal(err)
+	}
+	db.Set("myminio/dataset/a.zip", archiveObjectV1{ETag: "etag-1", DataCid: "bafybeidata", DealCids: []string{"bafyreideal"}})
+	if err := db.Save(dbFile); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newArchiveDBV1()
+	if err := loaded.Load(dbFile); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		objectURL string
+		etag      string
+		archived  bool
+	}{
+		{"myminio/dataset/a.zip", "etag-1", true},
+		{"myminio/dataset/a.zip", "etag-2", false},
+		{"myminio/dataset/b.zip", "etag-1", false},
+	}
+	for i, testCase := range testCases {
+		if archived := loaded.isArchived(testCase.objectURL, testCase.etag); archived != testCase.archived {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.archived, archived)
+		}
+	}
+}
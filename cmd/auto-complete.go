@@ -220,10 +220,32 @@ func (al aliasComplete) Predict(a complete.Args) (prediction []string) {
 	return
 }
 
+// minerComplete completes miner IDs from the swan miner list, which is
+// cached on disk.
+type minerComplete struct{}
+
+func (m minerComplete) Predict(a complete.Args) (prediction []string) {
+	defer func() {
+		sort.Strings(prediction)
+	}()
+
+	miners, err := fetchSwanMiners(globalContext, swanMinerQuery{Status: "Active"})
+	if err != nil {
+		return nil
+	}
+	for _, miner := range miners {
+		if strings.HasPrefix(miner.MinerID, a.Last) {
+			prediction = append(prediction, miner.MinerID)
+		}
+	}
+	return
+}
+
 var adminConfigCompleter = adminConfigComplete{}
 var s3Completer = s3Complete{}
 var aliasCompleter = aliasComplete{}
 var fsCompleter = fsComplete{}
+var minerCompleter = minerComplete{}
 
 // The list of all commands supported by mc with their mapping
 // with their bash completer function
@@ -288,6 +310,7 @@ var completeCmds = map[string]complete.Predictor{
 
 	"/share/download": s3Completer,
 	"/share/list":     nil,
+	"/share/renew":    fsCompleter,
 	"/share/upload":   s3Completer,
 
 	"/ilm/ls":     s3Complete{deepLevel: 2},
@@ -377,6 +400,26 @@ var completeCmds = map[string]complete.Predictor{
 	"/alias/remove": aliasCompleter,
 
 	"/update": nil,
+
+	"/send":       minerCompleter,
+	"/sendonline": nil,
+	"/list/miner": nil,
+	"/list/ask":   minerCompleter,
+	"/retrieve":   complete.PredictOr(s3Completer, fsCompleter),
+	"/archive":    s3Completer,
+	"/import":     complete.PredictOr(s3Completer, fsCompleter),
+
+	"/car/generate": complete.PredictOr(s3Completer, fsCompleter),
+	"/car/inspect":  fsCompleter,
+	"/car/verify":   fsCompleter,
+	"/car/extract":  fsCompleter,
+
+	"/deal/status":   fsCompleter,
+	"/deal/expiring": fsCompleter,
+	"/deal/renew":    fsCompleter,
+
+	"/swan/task/create": fsCompleter,
+	"/swan/task/status": fsCompleter,
 }
 
 // flagsToCompleteFlags transforms a cli.Flag to complete.Flags
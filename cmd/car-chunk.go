@@ -0,0 +1,549 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipld/go-car"
+)
+
+// carManifestHeader is the header of the manifests written by graphsplit,
+// the manifests of 'car generate' keep it for the tools reading them.
+var carManifestHeader = []string{"playload_cid", "filename", "piece_cid", "piece_size", "detail"}
+
+// carSource is a file, or an object, stored in the slices. dir is its slash
+// separated directory relative to the parent path, "" at the root.
+type carSource struct {
+	dir  string
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// carSlicePart is the part of a source stored in a slice.
+type carSlicePart struct {
+	source *carSource
+	name   string
+	offset int64
+	length int64
+}
+
+// reader returns the data of the part.
+func (p carSlicePart) reader() (io.ReadCloser, error) {
+	rc, e := p.source.open()
+	if e != nil {
+		return nil, e
+	}
+	if seeker, ok := rc.(io.Seeker); ok {
+		_, e = seeker.Seek(p.offset, io.SeekStart)
+	} else {
+		_, e = io.CopyN(ioutil.Discard, rc, p.offset)
+	}
+	if e != nil {
+		rc.Close()
+		return nil, e
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, p.length), rc}, nil
+}
+
+// carSourceFiles returns the files under targetPath in the order graphsplit
+// reads them: directories are sorted, hidden files and directories are
+// skipped and symbolic links are followed.
+func carSourceFiles(parentPath, targetPath string) ([]carSource, *probe.Error) {
+	parentPath = filepath.Clean(parentPath)
+	var sources []carSource
+	var walk func(filePath string, top bool) *probe.Error
+	walk = func(filePath string, top bool) *probe.Error {
+		info, e := os.Stat(filePath)
+		if e != nil {
+			return probe.NewError(e).Trace(filePath)
+		}
+		if !top && strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		if info.IsDir() {
+			entries, e := ioutil.ReadDir(filePath)
+			if e != nil {
+				return probe.NewError(e).Trace(filePath)
+			}
+			for _, entry := range entries {
+				if err := walk(filepath.Join(filePath, entry.Name()), false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// A single file is stored at the root.
+		dir := ""
+		if filepath.Clean(filePath) != parentPath {
+			rel, e := filepath.Rel(parentPath, filepath.Dir(filePath))
+			if e != nil {
+				return probe.NewError(e).Trace(parentPath, filePath)
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == ".." || strings.HasPrefix(rel, "../") {
+				return errInvalidArgument().Trace(parentPath, filePath)
+			}
+			if rel != "." {
+				dir = rel
+			}
+		}
+		sources = append(sources, carSource{
+			dir:  dir,
+			name: info.Name(),
+			size: info.Size(),
+			open: func() (io.ReadCloser, error) { return os.Open(filePath) },
+		})
+		return nil
+	}
+	if err := walk(targetPath, true); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// carSlices groups sources into slices of sliceSize bytes like graphsplit:
+// a source is split at the slice boundaries and its parts are named
+// name.00000000, name.00000001 and so on.
+func carSlices(sources []carSource, sliceSize int64) [][]carSlicePart {
+	var slices [][]carSlicePart
+	var slice []carSlicePart
+	var size int64
+	flush := func() {
+		slices = append(slices, slice)
+		slice, size = nil, 0
+	}
+	for i := range sources {
+		source := &sources[i]
+		if size+source.size <= sliceSize {
+			slice = append(slice, carSlicePart{source: source, name: source.name, length: source.size})
+			size += source.size
+			if size == sliceSize {
+				flush()
+			}
+			continue
+		}
+
+		var offset int64
+		for part := 0; offset < source.size; part++ {
+			length := source.size - offset
+			if length > sliceSize-size {
+				length = sliceSize - size
+			}
+			slice = append(slice, carSlicePart{
+				source: source,
+				name:   fmt.Sprintf("%s.%08d", source.name, part),
+				offset: offset,
+				length: length,
+			})
+			size += length
+			offset += length
+			if size == sliceSize {
+				flush()
+			}
+		}
+	}
+	if len(slice) > 0 {
+		flush()
+	}
+	return slices
+}
+
+// carSliceName returns the name of a slice in the manifest, total is the
+// number of slices graphsplit counts: one more than the whole slices of the
+// data.
+func carSliceName(graphName string, slice, total int) string {
+	if total == 1 {
+		return graphName + ".car"
+	}
+	return fmt.Sprintf("%s-total-%d-part-%d.car", graphName, total, slice+1)
+}
+
+// carBodyBlock is a block written to a CAR file body.
+type carBodyBlock struct {
+	body   *carBody
+	offset int64
+	length int64
+	links  []string
+}
+
+// carBody writes the nodes added to a DAG as the sections of a CAR file
+// without its header, once each.
+type carBody struct {
+	cidDAGService
+	ctx    context.Context
+	file   *os.File
+	w      *bufio.Writer
+	size   int64
+	blocks map[string]carBodyBlock
+}
+
+func newCarBody(ctx context.Context, dir string) (*carBody, *probe.Error) {
+	file, e := ioutil.TempFile(dir, ".mc-car-")
+	if e != nil {
+		return nil, probe.NewError(e).Trace(dir)
+	}
+	return &carBody{
+		ctx:    ctx,
+		file:   file,
+		w:      bufio.NewWriter(file),
+		blocks: make(map[string]carBodyBlock),
+	}, nil
+}
+
+func (b *carBody) Add(ctx context.Context, node ipld.Node) error {
+	if e := b.ctx.Err(); e != nil {
+		return e
+	}
+	key := node.Cid().KeyString()
+	if _, ok := b.blocks[key]; ok {
+		return nil
+	}
+
+	data := append(node.Cid().Bytes(), node.RawData()...)
+	lengthPrefix := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lengthPrefix, uint64(len(data)))
+	if _, e := b.w.Write(lengthPrefix[:n]); e != nil {
+		return e
+	}
+	if _, e := b.w.Write(data); e != nil {
+		return e
+	}
+	// The links are sorted once the node is encoded.
+	block := carBodyBlock{body: b, offset: b.size, length: int64(n + len(data))}
+	for _, link := range node.Links() {
+		block.links = append(block.links, link.Cid.KeyString())
+	}
+	b.blocks[key] = block
+	b.size += block.length
+	return nil
+}
+
+func (b *carBody) AddMany(ctx context.Context, nodes []ipld.Node) error {
+	for _, node := range nodes {
+		if e := b.Add(ctx, node); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Close removes the body.
+func (b *carBody) Close() error {
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// carSliceTree is a file or a directory of a slice.
+type carSliceTree struct {
+	node     ipld.Node
+	size     uint64
+	children map[string]*carSliceTree
+}
+
+// add adds a file node to the tree under its slash separated directory.
+func (t *carSliceTree) add(dir, name string, node ipld.Node, size uint64) {
+	elements := []string{name}
+	if dir != "" {
+		elements = append(strings.Split(dir, "/"), name)
+	}
+	entry := t
+	for _, element := range elements {
+		if entry.children == nil {
+			entry.children = make(map[string]*carSliceTree)
+		}
+		child, ok := entry.children[element]
+		if !ok {
+			child = &carSliceTree{}
+			entry.children[element] = child
+		}
+		entry = child
+	}
+	entry.node, entry.size = node, size
+}
+
+// build builds the directory nodes of the tree into dagServ, and returns the
+// graphsplit detail of the tree.
+func (t *carSliceTree) build(ctx context.Context, name string, dagServ ipld.DAGService) (graphsplitNode, error) {
+	detail := graphsplitNode{Name: name}
+	if t.children == nil {
+		detail.Hash, detail.Size = t.node.Cid().String(), t.size
+		return detail, nil
+	}
+	names := make([]string, 0, len(t.children))
+	for childName := range t.children {
+		names = append(names, childName)
+	}
+	sort.Strings(names)
+
+	dir := merkledag.NodeWithData(unixfs.FolderPBData())
+	for _, childName := range names {
+		child := t.children[childName]
+		childDetail, e := child.build(ctx, childName, dagServ)
+		if e != nil {
+			return detail, e
+		}
+		if e = dir.AddNodeLink(childName, child.node); e != nil {
+			return detail, e
+		}
+		detail.Size += child.size
+		detail.Link = append(detail.Link, childDetail)
+	}
+	if e := dagServ.Add(ctx, dir); e != nil {
+		return detail, e
+	}
+	t.node, t.size = dir, detail.Size
+	detail.Hash = dir.Cid().String()
+	return detail, nil
+}
+
+// buildCarSlice writes the CAR file of a slice into carDir, named after its
+// data CID, and returns its manifest row. Up to parallel file parts are read
+// at once, the CAR file is the same whatever their number.
+func buildCarSlice(ctx context.Context, carDir, sliceName string, parts []carSlicePart, parallel int) (*OfflineDeal, *probe.Error) {
+	bodies := make([]*carBody, len(parts))
+	defer func() {
+		for _, body := range bodies {
+			if body != nil {
+				body.Close()
+			}
+		}
+	}()
+	nodes := make([]ipld.Node, len(parts))
+	errs := make([]*probe.Error, len(parts))
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, parallel)
+	for i, part := range parts {
+		body, err := newCarBody(ctx, carDir)
+		if err != nil {
+			wg.Wait()
+			return nil, err.Trace(sliceName)
+		}
+		bodies[i] = body
+
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, part carSlicePart) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			r, e := part.reader()
+			if e != nil {
+				errs[i] = probe.NewError(e)
+				return
+			}
+			defer r.Close()
+			nodes[i], errs[i] = buildUnixFSFile(contextReader{ctx: ctx, r: r}, defaultCIDChunkSize, defaultCIDVersion, bodies[i])
+		}(i, part)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, err.Trace(sliceName, path.Join(parts[i].source.dir, parts[i].name))
+		}
+	}
+
+	tree := &carSliceTree{}
+	for i, part := range parts {
+		tree.add(part.source.dir, part.name, nodes[i], uint64(part.length))
+	}
+	dirs, err := newCarBody(ctx, carDir)
+	if err != nil {
+		return nil, err.Trace(sliceName)
+	}
+	defer dirs.Close()
+	detail, e := tree.build(ctx, "", dirs)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(sliceName)
+	}
+	root := tree.node.Cid()
+
+	carPath := filepath.Join(carDir, root.String()+".car")
+	if e = writeCarBodies(carPath, root, append(bodies, dirs)); e != nil {
+		return nil, probe.NewError(e).Trace(carPath)
+	}
+	pieceCid, pieceSize, err := computeCommP(ctx, carPath)
+	if err != nil {
+		return nil, err.Trace(sliceName)
+	}
+	detailJSON, e := json.Marshal(detail)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(sliceName)
+	}
+
+	slice := NewOfflineDeal()
+	slice.DataCid = root.String()
+	slice.Filename = sliceName
+	slice.PieceCid = pieceCid
+	slice.PieceSize = strconv.FormatUint(pieceSize, 10)
+	slice.Detail = string(detailJSON)
+	return slice, nil
+}
+
+// writeCarBodies writes a CAR file with the given root and the blocks of
+// bodies in the order of the selective CAR files of graphsplit: depth first
+// from the root, each block once. An interrupted write leaves no CAR file
+// behind.
+func writeCarBodies(carPath string, root cid.Cid, bodies []*carBody) error {
+	blocks := make(map[string]carBodyBlock)
+	for _, body := range bodies {
+		if e := body.w.Flush(); e != nil {
+			return e
+		}
+		for key, block := range body.blocks {
+			if _, ok := blocks[key]; !ok {
+				blocks[key] = block
+			}
+		}
+	}
+
+	file, e := ioutil.TempFile(filepath.Dir(carPath), ".mc-car-")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if e = car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w); e != nil {
+		return e
+	}
+	written := make(map[string]bool)
+	var write func(key string) error
+	write = func(key string) error {
+		if written[key] {
+			return nil
+		}
+		written[key] = true
+		block, ok := blocks[key]
+		if !ok {
+			c, _ := cid.Cast([]byte(key))
+			return fmt.Errorf("block %s is missing", c)
+		}
+		if _, e := io.Copy(w, io.NewSectionReader(block.body.file, block.offset, block.length)); e != nil {
+			return e
+		}
+		for _, link := range block.links {
+			if e := write(link); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+	if e = write(root.KeyString()); e != nil {
+		return e
+	}
+	if e = w.Flush(); e != nil {
+		return e
+	}
+	if e = file.Close(); e != nil {
+		return e
+	}
+	return os.Rename(file.Name(), carPath)
+}
+
+// appendCarManifest appends the row of a slice to the manifest of carDir.
+func appendCarManifest(carDir string, slice *OfflineDeal) *probe.Error {
+	manifestPath := filepath.Join(carDir, carManifestName)
+	_, e := os.Stat(manifestPath)
+	newManifest := os.IsNotExist(e)
+	file, e := os.OpenFile(manifestPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if e != nil {
+		return probe.NewError(e).Trace(manifestPath)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if newManifest {
+		w.Write(carManifestHeader)
+	}
+	w.Write([]string{slice.DataCid, slice.Filename, slice.PieceCid, slice.PieceSize, slice.Detail})
+	w.Flush()
+	if e = w.Error(); e != nil {
+		return probe.NewError(e).Trace(manifestPath)
+	}
+	return nil
+}
+
+// chunkCars generates the CAR files of the files under targetPath into
+// carDir, in slices of sliceSize bytes, and appends them to the manifest of
+// carDir. Names in the CAR files are relative to parentPath, targetPath by
+// default. The slices, their data CIDs and their CAR files are those of
+// graphsplit.
+func chunkCars(ctx context.Context, sliceSize int64, parentPath, targetPath, carDir, graphName string, parallel int) *probe.Error {
+	if parentPath == "" {
+		parentPath = targetPath
+	}
+	sources, err := carSourceFiles(parentPath, targetPath)
+	if err != nil {
+		return err.Trace(targetPath)
+	}
+	err = chunkCarSources(ctx, sources, sliceSize, carDir, graphName, parallel, func(slice *OfflineDeal, carPath string) *probe.Error {
+		return appendCarManifest(carDir, slice)
+	})
+	if err != nil {
+		return err.Trace(targetPath)
+	}
+	return nil
+}
+
+// chunkCarSources generates the CAR files of sources into carDir, in slices
+// of sliceSize bytes, onSlice is called after each CAR file is written.
+// Nothing is generated when sources hold no data.
+func chunkCarSources(ctx context.Context, sources []carSource, sliceSize int64, carDir, graphName string, parallel int, onSlice func(slice *OfflineDeal, carPath string) *probe.Error) *probe.Error {
+	if sliceSize <= 0 {
+		return errInvalidArgument().Trace(strconv.FormatInt(sliceSize, 10))
+	}
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var totalSize int64
+	for _, source := range sources {
+		totalSize += source.size
+	}
+	if totalSize == 0 {
+		return nil
+	}
+	if e := os.MkdirAll(carDir, 0755); e != nil {
+		return probe.NewError(e).Trace(carDir)
+	}
+	total := int(totalSize/sliceSize) + 1
+	for i, parts := range carSlices(sources, sliceSize) {
+		sliceName := carSliceName(graphName, i, total)
+		slice, err := buildCarSlice(ctx, carDir, sliceName, parts, parallel)
+		if err != nil {
+			return err
+		}
+		if err = onSlice(slice, filepath.Join(carDir, slice.DataCid+".car")); err != nil {
+			return err.Trace(sliceName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build ffi
+// +build ffi
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filedrive-team/go-graphsplit"
+)
+
+// TestChunkCarsGraphsplitChunk compares the slices of chunkCars with those of
+// graphsplit itself.
+func TestChunkCarsGraphsplitChunk(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-chunk")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "src")
+	writeGraphsplitTestTree(t, srcDir)
+
+	graphsplitDir := filepath.Join(dir, "graphsplit")
+	if e = os.MkdirAll(graphsplitDir, 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e = graphsplit.Chunk(context.Background(), 1572864, srcDir, srcDir, graphsplitDir, "graph", 2, graphsplit.CommPCallback(graphsplitDir)); e != nil {
+		t.Fatal(e)
+	}
+	carDir := filepath.Join(dir, "car")
+	if err := chunkCars(context.Background(), 1572864, "", srcDir, carDir, "graph", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := readDealCsv(filepath.Join(graphsplitDir, carManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices, err := readDealCsv(filepath.Join(carDir, carManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slices) != len(expected) {
+		t.Fatalf("expected %d slices, got %d", len(expected), len(slices))
+	}
+	for i, slice := range slices {
+		row := strings.Join([]string{slice.DataCid, slice.Filename, slice.PieceCid, slice.PieceSize}, ",")
+		expectedRow := strings.Join([]string{expected[i].DataCid, expected[i].Filename, expected[i].PieceCid, expected[i].PieceSize}, ",")
+		if row != expectedRow {
+			t.Errorf("expected row %s, got %s", expectedRow, row)
+		}
+		carFile, e := ioutil.ReadFile(filepath.Join(carDir, slice.DataCid+".car"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		expectedCarFile, e := ioutil.ReadFile(filepath.Join(graphsplitDir, expected[i].DataCid+".car"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !bytes.Equal(carFile, expectedCarFile) {
+			t.Errorf("the CAR file of %s differs from graphsplit", slice.Filename)
+		}
+	}
+}
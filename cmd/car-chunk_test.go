@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCarSlices(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-chunk")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{"a.txt": "aaaa", "dir/big.txt": "bbbbbbbbbb", "dir/empty.txt": "", ".hidden": "h", "dir/.git/x": "x"}
+	for name, data := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if e = os.MkdirAll(filepath.Dir(filePath), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e = ioutil.WriteFile(filePath, []byte(data), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	sources, err := carSourceFiles(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dir/big.txt is split over three slices, hidden files are skipped.
+	expected := [][]string{
+		{"a.txt:0:4", "dir/big.txt.00000000:0:2"},
+		{"dir/big.txt.00000001:2:6"},
+		{"dir/big.txt.00000002:8:2", "dir/empty.txt:0:0"},
+	}
+	var got [][]string
+	for _, slice := range carSlices(sources, 6) {
+		var parts []string
+		for _, part := range slice {
+			parts = append(parts, strings.Join([]string{path.Join(part.source.dir, part.name), strconv.FormatInt(part.offset, 10), strconv.FormatInt(part.length, 10)}, ":"))
+		}
+		got = append(got, parts)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected slices %v, got %v", expected, got)
+	}
+
+	// A single file is stored at the root.
+	sources, err = carSourceFiles(filepath.Join(dir, "dir", "big.txt"), filepath.Join(dir, "dir", "big.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].dir != "" || sources[0].name != "big.txt" {
+		t.Errorf("unexpected sources %+v", sources)
+	}
+	if _, err = carSourceFiles(filepath.Join(dir, "dir"), dir); err == nil {
+		t.Error("expected an error for a file outside of the parent path")
+	}
+}
+
+func TestChunkCars(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-chunk")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "src")
+	files := map[string]string{"a.txt": "a\n", "dir/big.txt": "hello world\n", "dir/b.txt": "b\n", "dir/same.txt": "b\n"}
+	for name, data := range files {
+		filePath := filepath.Join(srcDir, filepath.FromSlash(name))
+		if e = os.MkdirAll(filepath.Dir(filePath), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e = ioutil.WriteFile(filePath, []byte(data), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	var manifests []string
+	for _, parallel := range []int{1, 4} {
+		carDir := filepath.Join(dir, "car", strconv.Itoa(parallel))
+		if err := chunkCars(context.Background(), 10, "", srcDir, carDir, "graph", parallel); err != nil {
+			t.Fatal(err)
+		}
+		slices, err := readDealCsv(filepath.Join(carDir, carManifestName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(slices) != 2 || slices[0].Filename != "graph-total-2-part-1.car" {
+			t.Fatalf("unexpected manifest %+v", slices)
+		}
+		for _, slice := range slices {
+			if size, e := strconv.ParseUint(slice.PieceSize, 10, 64); e != nil || size%127 != 0 || !strings.HasPrefix(slice.PieceCid, "baga") {
+				t.Errorf("unexpected piece of %+v", slice)
+			}
+			// Every CAR file is complete and named after its data CID.
+			carPath := filepath.Join(carDir, slice.DataCid+".car")
+			if msg := verifyCar(context.Background(), carPath, "", carManifests{}); len(msg.Problems) > 0 || msg.DataCid != slice.DataCid {
+				t.Errorf("unexpected verification of %s: %+v", carPath, msg)
+			}
+		}
+		manifest, e := ioutil.ReadFile(filepath.Join(carDir, carManifestName))
+		if e != nil {
+			t.Fatal(e)
+		}
+		manifests = append(manifests, string(manifest))
+
+		// The files are extracted from the slices.
+		outDir := filepath.Join(dir, "out", strconv.Itoa(parallel))
+		x := &carExtractor{outDir: outDir, target: outDir, local: true, pending: make(map[string]*carExtractMessage)}
+		if err = x.extractSlices(carDir, slices); err != nil || x.failed {
+			t.Fatalf("unable to extract the slices: %v", err)
+		}
+		for name, data := range files {
+			extracted, e := ioutil.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+			if e != nil || string(extracted) != data {
+				t.Errorf("expected %q in %s, got %q, %v", data, name, extracted, e)
+			}
+		}
+	}
+	// The CAR files do not depend on the number of files read at once.
+	if manifests[0] != manifests[1] {
+		t.Errorf("manifests differ:\n%s\n%s", manifests[0], manifests[1])
+	}
+}
+
+// graphsplitTestData returns size bytes of data which do not repeat within
+// the blocks of a file.
+func graphsplitTestData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte((i*7 + i/1000) % 251)
+	}
+	return data
+}
+
+// writeGraphsplitTestTree writes a tree which graphsplit splits into three
+// slices of 1572864 bytes: it has hidden, empty and duplicate files and a
+// file split over all of the slices.
+func writeGraphsplitTestTree(t *testing.T, srcDir string) {
+	files := map[string][]byte{
+		"a.txt":          []byte("a\n"),
+		".hidden":        []byte("hidden\n"),
+		"dir/b.txt":      []byte("b\n"),
+		"dir/same.txt":   []byte("b\n"),
+		"dir/big.bin":    graphsplitTestData(3<<20 + 12345),
+		"dir/sub/c.txt":  []byte("c\n"),
+		"dir/sub/.git/x": []byte("x\n"),
+		"empty.txt":      nil,
+		"z.bin":          graphsplitTestData(200000),
+	}
+	for name, data := range files {
+		filePath := filepath.Join(srcDir, filepath.FromSlash(name))
+		if e := os.MkdirAll(filepath.Dir(filePath), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e := ioutil.WriteFile(filePath, data, 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+}
+
+func TestChunkCarsGraphsplit(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-chunk")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "src")
+	writeGraphsplitTestTree(t, srcDir)
+
+	carDir := filepath.Join(dir, "car")
+	if err := chunkCars(context.Background(), 1572864, "", srcDir, carDir, "graph", 2); err != nil {
+		t.Fatal(err)
+	}
+	slices, err := readDealCsv(filepath.Join(carDir, carManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rows and the CAR files written by graphsplit v0.4.0 for the same
+	// tree and the same arguments, with the piece CIDs of its CAR files.
+	expected := []struct {
+		row    string
+		sha256 string
+	}{
+		{
+			"QmadYBCQ95G8cH8Yt5JmZw5G3jamWE3xiPKWY6qKJdYxW4,graph-total-3-part-1.car,baga6ea4seaqg5v537fq266yf35i6fsk5hpekrcdgslt6fingmtbmdsszqv6qady,2080768",
+			"649a7997ae3fa2d5855e077d79911d2ffc2fe992e6d363d442761e1d8d7a7c5b",
+		},
+		{
+			"QmcC7XAZ7XcbrwsJNbdWKBPBa8d76uZ3so5Qzpme9nCfsn,graph-total-3-part-2.car,baga6ea4seaqiygtn2ystzdx4njhupmd2azdnt2c4tf2qmgiqzeyzgldvq4tjaci,2080768",
+			"7a4441a80dc4a671189b36c60bebbfd254a6a6e682078328a690dce525505059",
+		},
+		{
+			"QmYrQPBTryAwkMPAywyiVXJ3q9UbcPDPjGPPg4vnqWo3Fk,graph-total-3-part-3.car,baga6ea4seaqjbcfbrnr6xbracgbjdh3ziydruuqeqphk4iqzdya66s6ijblxqny,260096",
+			"fd950a6c943b8a9c435bc16e1ebacfec3808a001b0b3ebbf2b6fe7c3cb326445",
+		},
+	}
+	if len(slices) != len(expected) {
+		t.Fatalf("expected %d slices, got %+v", len(expected), slices)
+	}
+	for i, slice := range slices {
+		row := strings.Join([]string{slice.DataCid, slice.Filename, slice.PieceCid, slice.PieceSize}, ",")
+		if row != expected[i].row {
+			t.Errorf("expected row %s, got %s", expected[i].row, row)
+		}
+		data, e := ioutil.ReadFile(filepath.Join(carDir, slice.DataCid+".car"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if sum := fmt.Sprintf("%x", sha256.Sum256(data)); sum != expected[i].sha256 {
+			t.Errorf("expected the CAR file of %s to have sha256 %s, got %s", slice.Filename, expected[i].sha256, sum)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/filswan/fs3-mc/pkg/commp"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// Codecs of piece CIDs, as in go-fil-commcid.
+const (
+	filCommitmentUnsealed = 0xf101
+	sha256Trunc254Padded  = 0x1012
+)
+
+// pieceCommitmentCID returns the piece CID of a piece commitment.
+func pieceCommitmentCID(comm [commp.NodeSize]byte) cid.Cid {
+	buf := make([]byte, 2*binary.MaxVarintLen64+commp.NodeSize)
+	n := binary.PutUvarint(buf, sha256Trunc254Padded)
+	n += binary.PutUvarint(buf[n:], commp.NodeSize)
+	n += copy(buf[n:], comm[:])
+	return cid.NewCidV1(filCommitmentUnsealed, buf[:n])
+}
+
+// computeCommPGo returns the piece CID and unpadded piece size of a CAR
+// file, computed in pure Go. The file is Fr32 padded and zero filled up to
+// the next power of two, the piece size is the unpadded size of that piece.
+func computeCommPGo(ctx context.Context, carPath string) (string, uint64, *probe.Error) {
+	file, e := os.Open(carPath)
+	if e != nil {
+		return "", 0, probe.NewError(e).Trace(carPath)
+	}
+	defer file.Close()
+
+	// Only CAR files are accepted, like filecoin-ffi through graphsplit.
+	if _, _, e = car.ReadHeader(bufio.NewReader(file)); e != nil {
+		return "", 0, probe.NewError(e).Trace(carPath)
+	}
+	if _, e = file.Seek(0, io.SeekStart); e != nil {
+		return "", 0, probe.NewError(e).Trace(carPath)
+	}
+
+	w := &commp.Writer{}
+	if _, e = io.Copy(w, contextReader{ctx: ctx, r: file}); e != nil {
+		return "", 0, probe.NewError(e).Trace(carPath)
+	}
+	comm, padded := w.Sum()
+	return pieceCommitmentCID(comm).String(), commp.UnpaddedSize(padded), nil
+}
+
+// contextReader stops reading once its context is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if e := c.ctx.Err(); e != nil {
+		return 0, e
+	}
+	return c.r.Read(p)
+}
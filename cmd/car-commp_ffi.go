@@ -0,0 +1,20 @@
+//go:build ffi
+// +build ffi
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/filedrive-team/go-graphsplit"
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+// computeCommP returns the piece CID and unpadded piece size of a CAR file.
+func computeCommP(ctx context.Context, carPath string) (string, uint64, *probe.Error) {
+	res, e := graphsplit.CalcCommP(ctx, carPath)
+	if e != nil {
+		return "", 0, probe.NewError(e).Trace(carPath)
+	}
+	return res.Root.String(), uint64(res.Size), nil
+}
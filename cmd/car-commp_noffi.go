@@ -0,0 +1,15 @@
+//go:build !ffi
+// +build !ffi
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+// computeCommP returns the piece CID and unpadded piece size of a CAR file.
+func computeCommP(ctx context.Context, carPath string) (string, uint64, *probe.Error) {
+	return computeCommPGo(ctx, carPath)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filswan/fs3-mc/pkg/commp"
+)
+
+func TestPieceCommitmentCID(t *testing.T) {
+	// The piece CID of 127 zero bytes.
+	c := pieceCommitmentCID(commp.ZeroComm(commp.MinPieceSize))
+	if expected := "baga6ea4seaqdomn3tgwgrh3g532zopskstnbrd2n3sxfqbze7rxt7vqn7veigmy"; c.String() != expected {
+		t.Errorf("expected %s, got %s", expected, c)
+	}
+}
+
+func TestComputeCommPGo(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-commp")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	// A CAR file with the raw block of "hello world\n" as root.
+	carData, e := hex.DecodeString("3aa265726f6f747381d82a58250001551220a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a4476776657273696f6e013001551220a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a44768656c6c6f20776f726c640a")
+	if e != nil {
+		t.Fatal(e)
+	}
+	carPath := filepath.Join(dir, "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4.car")
+	if e = ioutil.WriteFile(carPath, carData, 0644); e != nil {
+		t.Fatal(e)
+	}
+	pieceCid, pieceSize, err := computeCommPGo(context.Background(), carPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "baga6ea4seaqbyafx5e5lzyqq2upjo5j4ziulp6phikah6p7ujgv2cmqrkxcqepq"; pieceCid != expected {
+		t.Errorf("expected piece CID %s, got %s", expected, pieceCid)
+	}
+	if pieceSize != 127 {
+		t.Errorf("expected piece size 127, got %d", pieceSize)
+	}
+
+	notCar := filepath.Join(dir, "data.txt")
+	if e = ioutil.WriteFile(notCar, []byte("hello world\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, _, err = computeCommPGo(context.Background(), notCar); err == nil {
+		t.Error("expected an error for a file which is not a CAR file")
+	}
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+)
+
+var carExtractFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "manifest",
+		Usage: "manifest written by `car generate --save-manifest`, default: manifest.csv in CAR-DIR",
+	},
+}
+
+var carExtractCmd = cli.Command{
+	Name:         "extract",
+	Usage:        "rebuild the original files from CAR slices",
+	Action:       mainCarExtract,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(carExtractFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CAR-DIR TARGET
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Rebuild the file hierarchy split by 'car generate' from the CAR slices listed in the
+  manifest. The parts of a file split over several slices, which graphsplit names
+  file.00000000, file.00000001..., are joined into the file. Every block is verified
+  against its CID while extracting. TARGET is a local
+  directory or an mc URL. Slices missing from CAR-DIR are reported and the command
+  exits with a non-zero status.
+
+EXAMPLES:
+  1. Restore the files of retrieved CAR slices into a local directory.
+     {{.Prompt}} {{.HelpName}} /data/retrieved /data/restore
+
+  2. Restore the files into a bucket, using a manifest stored elsewhere.
+     {{.Prompt}} {{.HelpName}} --manifest /data/manifest.csv /data/retrieved myminio/restore
+`,
+}
+
+// carExtractMessage container for CAR extract messages.
+type carExtractMessage struct {
+	Status  string `json:"status"`
+	Slice   string `json:"slice,omitempty"`
+	Target  string `json:"target,omitempty"`
+	Size    uint64 `json:"size,omitempty"`
+	Slices  int    `json:"slices,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// part is the index of the last part extracted from a split file.
+	part int
+}
+
+// JSON jsonified CAR extract message.
+func (c carExtractMessage) JSON() string {
+	extractJSONBytes, e := json.MarshalIndent(c, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(extractJSONBytes)
+}
+
+// String colorized CAR extract message.
+func (c carExtractMessage) String() string {
+	if c.Slice != "" {
+		return console.Colorize("ExtractFailed", "Slice `"+c.Slice+"` "+c.Message)
+	}
+	msg := fmt.Sprintf("`%s` (%s, %d slices)", c.Target, humanize.IBytes(c.Size), c.Slices)
+	if c.Message != "" {
+		return console.Colorize("ExtractFailed", msg+": "+c.Message)
+	}
+	return console.Colorize("Extract", msg)
+}
+
+// findSliceCar returns the CAR file of a manifest row in carDir, CAR files are
+// named after their data CID or their slice name, which graphsplit ends with
+// .car.
+func findSliceCar(carDir string, slice *OfflineDeal) string {
+	var names []string
+	if slice.DataCid != "" {
+		names = append(names, slice.DataCid+".car")
+	}
+	if strings.HasSuffix(slice.Filename, ".car") {
+		names = append(names, slice.Filename)
+	} else if slice.Filename != "" {
+		names = append(names, slice.Filename+".car")
+	}
+	for _, name := range names {
+		carPath := filepath.Join(carDir, name)
+		if st, e := os.Stat(carPath); e == nil && st.Mode().IsRegular() {
+			return carPath
+		}
+	}
+	return ""
+}
+
+// carExtractor appends the parts of files spread over CAR slices.
+type carExtractor struct {
+	outDir  string
+	target  string
+	local   bool
+	pending map[string]*carExtractMessage
+	failed  bool
+}
+
+// extractSlice appends the files of a slice to their targets and finalizes
+// the files of previous slices which do not continue in this one.
+func (x *carExtractor) extractSlice(carPath string, index *carIndex) *probe.Error {
+	file, e := os.Open(carPath)
+	if e != nil {
+		return probe.NewError(e).Trace(carPath)
+	}
+	defer file.Close()
+
+	inSlice := make(map[string]bool)
+	for _, entry := range index.tree() {
+		if entry.IsDir || entry.Path == "" {
+			continue
+		}
+		name, part := graphsplitFileName(entry.Path)
+		filePath := filepath.Join(x.outDir, filepath.FromSlash(name))
+		if !strings.HasPrefix(filePath, filepath.Clean(x.outDir)+string(filepath.Separator)) {
+			return errInvalidSource(entry.Path).Trace(carPath)
+		}
+
+		msg, ok := x.pending[name]
+		flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if !ok {
+			msg = &carExtractMessage{Status: "success", Target: urlJoinPath(x.target, name), part: -1}
+			x.pending[name] = msg
+			flags |= os.O_TRUNC
+		}
+		if part > msg.part+1 {
+			msg.Status = "error"
+			msg.Message = fmt.Sprintf("part %d of the file is missing", msg.part+1)
+		}
+		if part >= 0 {
+			msg.part = part
+		}
+		inSlice[name] = true
+
+		if e = os.MkdirAll(filepath.Dir(filePath), 0755); e != nil {
+			return probe.NewError(e).Trace(filePath)
+		}
+		out, e := os.OpenFile(filePath, flags, 0644)
+		if e != nil {
+			return probe.NewError(e).Trace(filePath)
+		}
+		c, e := cid.Decode(entry.Cid)
+		if e != nil {
+			out.Close()
+			return probe.NewError(e).Trace(entry.Cid)
+		}
+		written, err := index.writeFile(file, c, out)
+		out.Close()
+		if err != nil {
+			return err.Trace(carPath, entry.Path)
+		}
+		if written != entry.Size {
+			msg.Status = "error"
+			msg.Message = fmt.Sprintf("extracted %d bytes from %s, expected %d", written, filepath.Base(carPath), entry.Size)
+		}
+		msg.Size += written
+		msg.Slices++
+	}
+
+	for name := range x.pending {
+		if !inSlice[name] {
+			x.finalize(name)
+		}
+	}
+	return nil
+}
+
+// markIncomplete flags the files which may continue in a missing slice.
+func (x *carExtractor) markIncomplete(slice string) {
+	for _, msg := range x.pending {
+		msg.Status = "error"
+		msg.Message = "may be incomplete, slice `" + slice + "` is missing"
+	}
+}
+
+// finalize uploads a complete file to a remote target and reports it.
+func (x *carExtractor) finalize(name string) {
+	msg := x.pending[name]
+	delete(x.pending, name)
+
+	if !x.local {
+		filePath := filepath.Join(x.outDir, filepath.FromSlash(name))
+		if err := uploadLocalFile(filePath, msg.Target); err != nil {
+			msg.Status = "error"
+			msg.Message = err.ToGoError().Error()
+		}
+		os.Remove(filePath)
+	}
+	if msg.Status != "success" {
+		x.failed = true
+	}
+	printMsg(*msg)
+}
+
+// extractSlices extracts the slices of a manifest in order, the missing and
+// corrupted slices are reported and the files they may hold a part of are
+// marked as incomplete.
+func (x *carExtractor) extractSlices(carDir string, slices []*OfflineDeal) *probe.Error {
+	for _, slice := range slices {
+		carPath := findSliceCar(carDir, slice)
+		if carPath == "" {
+			x.failed = true
+			x.markIncomplete(slice.Filename)
+			printMsg(carExtractMessage{Status: "error", Slice: slice.Filename, Message: "is missing from `" + carDir + "`."})
+			continue
+		}
+		index, err := loadCarIndex(carPath)
+		if err == nil {
+			if missing := index.missingBlocks(); len(missing) > 0 {
+				err = errCorruptedBlock(missing[0].String(), "is missing from the CAR file")
+			}
+		}
+		if err != nil {
+			x.failed = true
+			x.markIncomplete(slice.Filename)
+			printMsg(carExtractMessage{Status: "error", Slice: slice.Filename, Message: "is corrupted: " + err.ToGoError().Error()})
+			continue
+		}
+		if err = x.extractSlice(carPath, index); err != nil {
+			return err.Trace(carPath)
+		}
+	}
+
+	remaining := make([]string, 0, len(x.pending))
+	for name := range x.pending {
+		remaining = append(remaining, name)
+	}
+	sort.Strings(remaining)
+	for _, name := range remaining {
+		x.finalize(name)
+	}
+	return nil
+}
+
+// uploadLocalFile uploads a local file to an mc URL.
+func uploadLocalFile(filePath, targetURL string) *probe.Error {
+	file, e := os.Open(filePath)
+	if e != nil {
+		return probe.NewError(e).Trace(filePath)
+	}
+	defer file.Close()
+
+	st, e := file.Stat()
+	if e != nil {
+		return probe.NewError(e).Trace(filePath)
+	}
+	if _, err := putTargetStreamWithURL(targetURL, file, st.Size(), PutOptions{}); err != nil {
+		return err.Trace(filePath, targetURL)
+	}
+	return nil
+}
+
+// mainCarExtract is the handle for "mc car extract" command.
+func mainCarExtract(cliCtx *cli.Context) error {
+	if len(cliCtx.Args()) != 2 {
+		cli.ShowCommandHelpAndExit(cliCtx, "extract", globalErrorExitStatus)
+	}
+	carDir := cliCtx.Args().Get(0)
+	target := cliCtx.Args().Get(1)
+
+	// Set colors.
+	console.SetColor("Extract", color.New(color.FgGreen))
+	console.SetColor("ExtractFailed", color.New(color.FgRed, color.Bold))
+
+	manifestPath := cliCtx.String("manifest")
+	if manifestPath == "" {
+		manifestPath = filepath.Join(carDir, carManifestName)
+	}
+	slices, err := readDealCsv(manifestPath)
+	fatalIf(err, "Unable to read manifest `"+manifestPath+"`.")
+
+	x := &carExtractor{
+		outDir:  target,
+		target:  target,
+		local:   isLocalURL(target),
+		pending: make(map[string]*carExtractMessage),
+	}
+	// Files for a remote target are staged locally until their last
+	// slice has been extracted.
+	if !x.local {
+		tmpDir, e := ioutil.TempDir("", "mc-car-extract-")
+		fatalIf(probe.NewError(e), "Unable to create a temporary directory.")
+		defer os.RemoveAll(tmpDir)
+		x.outDir = tmpDir
+	}
+
+	fatalIf(x.extractSlices(carDir, slices), "Unable to extract the CAR files of `"+carDir+"`.")
+
+	if x.failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipld/go-car"
+)
+
+// writeTestCar writes a CAR file with the given root and blocks.
+func writeTestCar(t *testing.T, carPath string, root cid.Cid, nodes ...ipld.Node) {
+	var buf bytes.Buffer
+	if e := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &buf); e != nil {
+		t.Fatal(e)
+	}
+	for _, node := range nodes {
+		section := append(node.Cid().Bytes(), node.RawData()...)
+		lengthPrefix := make([]byte, binary.MaxVarintLen64)
+		buf.Write(lengthPrefix[:binary.PutUvarint(lengthPrefix, uint64(len(section)))])
+		buf.Write(section)
+	}
+	if e := ioutil.WriteFile(carPath, buf.Bytes(), 0644); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// newTestDir returns a UnixFS directory node linking to the given nodes.
+func newTestDir(t *testing.T, links map[string]ipld.Node) *merkledag.ProtoNode {
+	dir := merkledag.NodeWithData(unixfs.FolderPBData())
+	for name, node := range links {
+		if e := dir.AddNodeLink(name, node); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return dir
+}
+
+// newTestFile returns a UnixFS file node made of raw leaves.
+func newTestFile(t *testing.T, leaves ...*merkledag.RawNode) *merkledag.ProtoNode {
+	fsNode := unixfs.NewFSNode(unixfs.TFile)
+	for _, leaf := range leaves {
+		fsNode.AddBlockSize(uint64(len(leaf.RawData())))
+	}
+	data, e := fsNode.GetBytes()
+	if e != nil {
+		t.Fatal(e)
+	}
+	file := merkledag.NodeWithData(data)
+	for _, leaf := range leaves {
+		if e = file.AddNodeLink("", leaf); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return file
+}
+
+// writeTestSlices writes two CAR slices and their manifest into carDir, the
+// file dir/big.txt is split over both slices with the part names of
+// graphsplit.
+func writeTestSlices(t *testing.T, carDir string) []*OfflineDeal {
+	hello := merkledag.NewRawNode([]byte("hello "))
+	wor := merkledag.NewRawNode([]byte("wor"))
+	big1 := newTestFile(t, hello, wor)
+	a := merkledag.NewRawNode([]byte("a\n"))
+	dir1 := newTestDir(t, map[string]ipld.Node{"big.txt.00000000": big1, "a.txt": a})
+	root1 := newTestDir(t, map[string]ipld.Node{"dir": dir1})
+
+	big2 := merkledag.NewRawNode([]byte("ld\n"))
+	b := merkledag.NewRawNode([]byte("b\n"))
+	dir2 := newTestDir(t, map[string]ipld.Node{"big.txt.00000001": big2})
+	root2 := newTestDir(t, map[string]ipld.Node{"dir": dir2, "b.txt": b})
+
+	writeTestCar(t, filepath.Join(carDir, root1.Cid().String()+".car"), root1.Cid(), root1, dir1, big1, hello, wor, a)
+	writeTestCar(t, filepath.Join(carDir, "graph-total-2-part-2.car"), root2.Cid(), root2, dir2, big2, b)
+
+	first := NewOfflineDeal()
+	first.DataCid = root1.Cid().String()
+	first.Filename = "graph-total-2-part-1.car"
+	second := NewOfflineDeal()
+	second.DataCid = root2.Cid().String()
+	second.Filename = "graph-total-2-part-2.car"
+	return []*OfflineDeal{first, second}
+}
+
+func TestCarExtractSlices(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-extract")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	carDir := filepath.Join(dir, "car")
+	if e = os.Mkdir(carDir, 0755); e != nil {
+		t.Fatal(e)
+	}
+	slices := writeTestSlices(t, carDir)
+
+	testCases := []struct {
+		slices []*OfflineDeal
+		files  map[string]string
+		failed bool
+	}{
+		// The parts of dir/big.txt are appended in the order of the manifest.
+		{slices, map[string]string{"dir/big.txt": "hello world\n", "dir/a.txt": "a\n", "b.txt": "b\n"}, false},
+		{slices[:1], map[string]string{"dir/big.txt": "hello wor", "dir/a.txt": "a\n"}, false},
+		// The second slice is missing from the CAR directory.
+		{[]*OfflineDeal{slices[0], {DataCid: "bafymissing", Filename: "slice-3"}}, map[string]string{"dir/big.txt": "hello wor"}, true},
+		// The first part of dir/big.txt is missing.
+		{slices[1:], map[string]string{"dir/big.txt": "ld\n", "b.txt": "b\n"}, true},
+	}
+	for i, testCase := range testCases {
+		outDir := filepath.Join(dir, "out", string(rune('a'+i)))
+		x := &carExtractor{
+			outDir:  outDir,
+			target:  outDir,
+			local:   true,
+			pending: make(map[string]*carExtractMessage),
+		}
+		if err := x.extractSlices(carDir, testCase.slices); err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if x.failed != testCase.failed {
+			t.Errorf("Test %d: expected failed %v, got %v", i+1, testCase.failed, x.failed)
+		}
+		for name, content := range testCase.files {
+			data, e := ioutil.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+			if e != nil {
+				t.Fatalf("Test %d: %v", i+1, e)
+			}
+			if string(data) != content {
+				t.Errorf("Test %d: expected %s to be %q, got %q", i+1, name, content, data)
+			}
+		}
+	}
+
+	// A corrupted slice is reported and skipped.
+	carPath := filepath.Join(carDir, "graph-total-2-part-2.car")
+	data, e := ioutil.ReadFile(carPath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	data[len(data)-1] ^= 0xff
+	if e = ioutil.WriteFile(carPath, data, 0644); e != nil {
+		t.Fatal(e)
+	}
+	outDir := filepath.Join(dir, "out", "corrupted")
+	x := &carExtractor{outDir: outDir, target: outDir, local: true, pending: make(map[string]*carExtractMessage)}
+	if err := x.extractSlices(carDir, slices); err != nil {
+		t.Fatal(err)
+	}
+	if !x.failed {
+		t.Error("expected the extraction of a corrupted slice to fail")
+	}
+	if _, e = os.Stat(filepath.Join(outDir, "b.txt")); !os.IsNotExist(e) {
+		t.Errorf("expected b.txt of the corrupted slice not to be extracted, got %v", e)
+	}
+}
@@ -2,35 +2,58 @@ package cmd
 
 import (
 	"context"
-	"github.com/filedrive-team/go-graphsplit"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
 	"github.com/minio/cli"
 	"golang.org/x/xerrors"
 )
 
 var carGenerateCmd = cli.Command{
-	Name:  "generate",
-	Usage: "Generate CAR files of the specified size",
-	Action: func(c *cli.Context) error {
-		ctx := context.Background()
-		parallel := c.Uint("parallel")
-		sliceSize := c.Uint64("slice-size")
-		parentPath := c.String("parent-path")
-		carDir := c.String("car-dir")
-		graphName := c.String("graph-name")
-		if sliceSize == 0 {
-			return xerrors.Errorf("Unexpected! Slice size has been set as 0")
-		}
+	Name:         "generate",
+	Usage:        "Generate CAR files of the specified size",
+	Action:       mainCarGenerate,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(append(carGenerateFlags, uploadFlags...), globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
 
-		targetPath := c.Args().First()
-		var cb graphsplit.GraphBuildCallback
+USAGE:
+  {{.HelpName}} [FLAGS] SOURCE
 
-		cb = graphsplit.CommPCallback(carDir)
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  SOURCE is a local directory or file, or any mc URL such as myalias/bucket/prefix.
+  The objects of a remote SOURCE are streamed into the CAR files, which are the
+  same as those of the same files on disk.
+  --car-dir can be a local directory or an mc URL, in which case each CAR file is
+  uploaded and removed locally as soon as it is generated. With --upload-to, the CAR
+  files generated by this run and the manifest are kept in a local --car-dir and
+  uploaded once all of them are generated, with a progress bar; an interrupted upload
+  resumes when the command is run again.
 
-		return graphsplit.Chunk(ctx, int64(sliceSize), parentPath, targetPath, carDir, graphName, int(parallel), cb)
-	},
-	OnUsageError: onUsageError,
-	Before:       setGlobalsFromContext,
-	Flags:        append(carGenerateFlags, globalFlags...),
+EXAMPLES:
+  1. Generate CAR files from a local directory.
+     {{.Prompt}} {{.HelpName}} --car-dir /data/car /data/dataset
+
+  2. Generate CAR files of 32GiB slices from a bucket prefix.
+     {{.Prompt}} {{.HelpName}} --slice-size 34359738368 --car-dir /data/car myminio/dataset/2021
+
+  3. Generate CAR files from a bucket prefix and store them in another bucket.
+     {{.Prompt}} {{.HelpName}} --car-dir myminio/swan/batch-42 myminio/dataset/2021
+
+  4. Generate CAR files locally and upload a copy of them to a bucket.
+     {{.Prompt}} {{.HelpName}} --car-dir /data/car --upload-to myminio/swan/batch-42 /data/dataset
+`,
 }
 
 var carGenerateFlags = []cli.Flag{
@@ -55,10 +78,229 @@ var carGenerateFlags = []cli.Flag{
 	},
 	cli.StringFlag{
 		Name:  "car-dir",
-		Usage: "specify output CAR directory",
+		Usage: "specify output CAR directory, a local path or an mc URL",
 	},
 	cli.BoolTFlag{
 		Name:  "save-manifest",
-		Usage: "create a mainfest.csv in car-dir to save mapping of data-cids and slice names",
+		Usage: "create a manifest.csv in car-dir to save mapping of data-cids and slice names",
 	},
 }
+
+// carManifestName is the manifest of the slices of a CAR directory.
+const carManifestName = "manifest.csv"
+
+// isLocalURL returns true if the aliased URL does not refer to an alias.
+func isLocalURL(aliasedURL string) bool {
+	_, _, hostCfg, err := expandAlias(aliasedURL)
+	return err == nil && hostCfg == nil
+}
+
+// mainCarGenerate is the handle for "mc car generate" command.
+func mainCarGenerate(c *cli.Context) error {
+	ctx, cancelGenerate := context.WithCancel(globalContext)
+	defer cancelGenerate()
+
+	parallel := c.Uint("parallel")
+	sliceSize := c.Uint64("slice-size")
+	parentPath := c.String("parent-path")
+	carDir := c.String("car-dir")
+	graphName := c.String("graph-name")
+	if sliceSize == 0 {
+		return xerrors.Errorf("Unexpected! Slice size has been set as 0")
+	}
+
+	targetPath := c.Args().First()
+
+	saveManifest := c.BoolT("save-manifest")
+	uploadTo := c.String("upload-to")
+	if uploadTo != "" {
+		if !isLocalURL(carDir) {
+			fatalIf(errInvalidArgument().Trace(carDir, uploadTo), "--upload-to needs a local --car-dir.")
+		}
+		fatalIf(checkUploadTarget(uploadTo), "Unable to upload to `"+uploadTo+"`.")
+	}
+
+	// CAR files for a remote car-dir are generated in a temporary
+	// directory and uploaded as soon as they are complete.
+	localCarDir := carDir
+	flush := func() *probe.Error { return nil }
+	if !isLocalURL(carDir) {
+		tmpDir, e := ioutil.TempDir("", "mc-car-")
+		fatalIf(probe.NewError(e), "Unable to create a temporary CAR directory.")
+		defer os.RemoveAll(tmpDir)
+
+		localCarDir = tmpDir
+		flush = func() *probe.Error {
+			return uploadCarDir(localCarDir, carDir)
+		}
+	}
+
+	var sources []carSource
+	var err *probe.Error
+	if isLocalURL(targetPath) {
+		if parentPath == "" {
+			parentPath = targetPath
+		}
+		sources, err = carSourceFiles(parentPath, targetPath)
+	} else {
+		sources, err = carObjectSources(ctx, targetPath)
+	}
+	fatalIf(err, "Unable to read `"+targetPath+"`.")
+
+	// Only the CAR files generated by this run are uploaded, the car-dir
+	// may hold the slices of previous runs.
+	var carPaths []string
+	err = chunkCarSources(ctx, sources, int64(sliceSize), localCarDir, graphName, int(parallel), func(slice *OfflineDeal, carPath string) *probe.Error {
+		if saveManifest {
+			if err := appendCarManifest(localCarDir, slice); err != nil {
+				return err.Trace(carPath)
+			}
+		}
+		carPaths = append(carPaths, carPath)
+		return flush()
+	})
+	fatalIf(err, "Unable to generate CAR files from `"+targetPath+"`.")
+
+	if uploadTo != "" {
+		if saveManifest {
+			carPaths = append(carPaths, filepath.Join(carDir, carManifestName))
+		}
+		fatalIf(uploadFiles(c, carPaths, uploadTo), "Unable to upload CAR files to `"+uploadTo+"`.")
+	}
+	return nil
+}
+
+// carObjectSources returns the objects under sourceURL in the order
+// graphsplit reads the same files on disk, hidden files and directories are
+// skipped. The objects are read when their slice is generated.
+func carObjectSources(ctx context.Context, sourceURL string) ([]carSource, *probe.Error) {
+	alias, _, _, err := expandAlias(sourceURL)
+	if err != nil {
+		return nil, err.Trace(sourceURL)
+	}
+	clnt, err := newClient(sourceURL)
+	if err != nil {
+		return nil, err.Trace(sourceURL)
+	}
+
+	var sources []carSource
+	prefix := clnt.GetURL().Path
+	for content := range clnt.List(ctx, ListOptions{Recursive: true, ShowDir: DirNone}) {
+		if content.Err != nil {
+			return nil, content.Err.Trace(sourceURL)
+		}
+		if content.Type.IsDir() {
+			continue
+		}
+		separator := string(content.URL.Separator)
+		name := strings.TrimPrefix(strings.TrimPrefix(content.URL.Path, prefix), separator)
+		if name == "" {
+			// A single object is stored at the root.
+			name = path.Base(strings.ReplaceAll(content.URL.Path, separator, "/"))
+		} else {
+			name = strings.ReplaceAll(name, separator, "/")
+			if isHiddenCarName(name) {
+				continue
+			}
+		}
+		source, err := newCarObjectSource(ctx, alias, name, content)
+		if err != nil {
+			return nil, err.Trace(sourceURL)
+		}
+		sources = append(sources, source)
+	}
+	sortCarSources(sources)
+	return sources, nil
+}
+
+// isHiddenCarName returns true if a file or a directory of a slash separated
+// name is hidden, graphsplit skips them.
+func isHiddenCarName(name string) bool {
+	for _, element := range strings.Split(name, "/") {
+		if strings.HasPrefix(element, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// newCarObjectSource returns the source of an object stored under a slash
+// separated name in the slices.
+func newCarObjectSource(ctx context.Context, alias, name string, content *ClientContent) (carSource, *probe.Error) {
+	if name == "" || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") || strings.HasPrefix(name, "/") {
+		return carSource{}, errInvalidSource(content.URL.String())
+	}
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+	objectURL := content.URL.String()
+	return carSource{
+		dir:  dir,
+		name: path.Base(name),
+		size: content.Size,
+		open: func() (io.ReadCloser, error) {
+			clnt, err := newClientFromAlias(alias, objectURL)
+			if err != nil {
+				return nil, err.Trace(objectURL).ToGoError()
+			}
+			reader, err := clnt.Get(ctx, GetOptions{VersionID: content.VersionID})
+			if err != nil {
+				return nil, err.Trace(objectURL).ToGoError()
+			}
+			return reader, nil
+		},
+	}, nil
+}
+
+// sortCarSources sorts sources like the files of directories read in the
+// order of their names.
+func sortCarSources(sources []carSource) {
+	elements := func(source carSource) []string {
+		if source.dir == "" {
+			return []string{source.name}
+		}
+		return append(strings.Split(source.dir, "/"), source.name)
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		a, b := elements(sources[i]), elements(sources[j])
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// uploadCarDir uploads the CAR files of a local directory to targetURL and
+// removes them locally, the manifest is uploaded and kept so that the next
+// slices are appended to it.
+func uploadCarDir(carDir, targetURL string) *probe.Error {
+	entries, e := ioutil.ReadDir(carDir)
+	if e != nil {
+		return probe.NewError(e).Trace(carDir)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || (filepath.Ext(entry.Name()) != ".car" && entry.Name() != carManifestName) {
+			continue
+		}
+		filePath := filepath.Join(carDir, entry.Name())
+		file, e := os.Open(filePath)
+		if e != nil {
+			return probe.NewError(e).Trace(filePath)
+		}
+		_, err := putTargetStreamWithURL(urlJoinPath(targetURL, entry.Name()), file, entry.Size(), PutOptions{})
+		file.Close()
+		if err != nil {
+			return err.Trace(filePath)
+		}
+		if entry.Name() == carManifestName {
+			continue
+		}
+		if e = os.Remove(filePath); e != nil {
+			return probe.NewError(e).Trace(filePath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+func TestCarObjectSources(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	dir, e := ioutil.TempDir("", "mc-car-generate")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	// dir.txt is listed before the objects of dir/, but read after them.
+	srcDir := filepath.Join(dir, "src")
+	writeGraphsplitTestTree(t, srcDir)
+	if e = ioutil.WriteFile(filepath.Join(srcDir, "dir.txt"), []byte("d\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	files, err := carSourceFiles(srcDir, srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := carObjectSources(context.Background(), srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifests []string
+	for i, sources := range [][]carSource{files, objects} {
+		carDir := filepath.Join(dir, "car", string(rune('a'+i)))
+		var carPaths []string
+		err = chunkCarSources(context.Background(), sources, 1572864, carDir, "graph", 2, func(slice *OfflineDeal, carPath string) *probe.Error {
+			carPaths = append(carPaths, carPath)
+			return appendCarManifest(carDir, slice)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(carPaths) != 3 {
+			t.Fatalf("expected 3 CAR files, got %v", carPaths)
+		}
+		manifest, e := ioutil.ReadFile(filepath.Join(carDir, carManifestName))
+		if e != nil {
+			t.Fatal(e)
+		}
+		manifests = append(manifests, string(manifest))
+	}
+	// The objects are streamed into the CAR files of the same files on disk.
+	if manifests[0] != manifests[1] {
+		t.Errorf("manifests differ:\n%s\n%s", manifests[0], manifests[1])
+	}
+}
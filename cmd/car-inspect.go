@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipld/go-car"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+)
+
+var carInspectCmd = cli.Command{
+	Name:         "inspect",
+	Usage:        "show roots, blocks and the file tree of CAR files",
+	Action:       mainCarInspect,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        globalFlags,
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CAR-FILE [CAR-FILE...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+EXAMPLES:
+  1. Show the content of a CAR file.
+     {{.Prompt}} {{.HelpName}} /data/car/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi.car
+
+  2. Show the content of a CAR file in JSON format.
+     {{.Prompt}} {{.HelpName}} --json /data/car/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi.car
+`,
+}
+
+// carLink is a named link of a dag-pb node.
+type carLink struct {
+	Name string
+	Cid  cid.Cid
+}
+
+// carBlock holds what is needed of a block to walk the file tree, the
+// block data itself is read back from the CAR file when needed.
+type carBlock struct {
+	offset   int64
+	length   int
+	links    []carLink
+	isDir    bool
+	fileSize uint64
+}
+
+// carIndex is an in-memory index of the blocks of a CAR file.
+type carIndex struct {
+	roots     []cid.Cid
+	blocks    map[cid.Cid]*carBlock
+	blockSize int64
+}
+
+// carTreeEntry is a file or directory of the UnixFS tree of a CAR file.
+type carTreeEntry struct {
+	Path  string `json:"path"`
+	Cid   string `json:"cid"`
+	Size  uint64 `json:"size"`
+	IsDir bool   `json:"isDir,omitempty"`
+}
+
+// carSectionReader reads the length prefixed sections of a CAR file and
+// keeps track of their offset.
+type carSectionReader struct {
+	br     *bufio.Reader
+	offset int64
+	size   int64
+}
+
+func (r *carSectionReader) ReadByte() (byte, error) {
+	b, e := r.br.ReadByte()
+	if e == nil {
+		r.offset++
+	}
+	return b, e
+}
+
+// next returns the next section and its offset, io.EOF at the end of the file.
+func (r *carSectionReader) next() (int64, []byte, error) {
+	length, e := binary.ReadUvarint(r)
+	if e != nil {
+		return 0, nil, e
+	}
+	// Do not trust the length prefix of a corrupted file for allocating.
+	if length > uint64(r.size-r.offset) {
+		return 0, nil, fmt.Errorf("section of %d bytes at offset %d goes past the end of the file", length, r.offset)
+	}
+	section := make([]byte, length)
+	offset := r.offset
+	if _, e = io.ReadFull(r.br, section); e != nil {
+		if e == io.EOF {
+			e = io.ErrUnexpectedEOF
+		}
+		return 0, nil, e
+	}
+	r.offset += int64(length)
+	return offset, section, nil
+}
+
+// loadCarIndex reads a CAR file, verifying that every block matches its CID.
+func loadCarIndex(carPath string) (*carIndex, *probe.Error) {
+	file, e := os.Open(carPath)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(carPath)
+	}
+	defer file.Close()
+
+	st, e := file.Stat()
+	if e != nil {
+		return nil, probe.NewError(e).Trace(carPath)
+	}
+	reader := &carSectionReader{br: bufio.NewReader(file), size: st.Size()}
+	_, headerBytes, e := reader.next()
+	if e != nil {
+		return nil, errCorruptedCar(carPath, e.Error()).Trace(carPath)
+	}
+	lengthPrefix := make([]byte, binary.MaxVarintLen64)
+	lengthPrefix = lengthPrefix[:binary.PutUvarint(lengthPrefix, uint64(len(headerBytes)))]
+	header, _, e := car.ReadHeader(bufio.NewReader(io.MultiReader(bytes.NewReader(lengthPrefix), bytes.NewReader(headerBytes))))
+	if e != nil {
+		return nil, probe.NewError(e).Trace(carPath)
+	}
+
+	index := &carIndex{
+		roots:  header.Roots,
+		blocks: make(map[cid.Cid]*carBlock),
+	}
+	for {
+		offset, section, e := reader.next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return nil, errCorruptedCar(carPath, e.Error()).Trace(carPath)
+		}
+		n, c, e := cid.CidFromBytes(section)
+		if e != nil {
+			return nil, errCorruptedCar(carPath, e.Error()).Trace(carPath)
+		}
+		data := section[n:]
+		if err := verifyBlock(c, data); err != nil {
+			return nil, err.Trace(carPath)
+		}
+
+		index.blockSize += int64(len(data))
+		block := &carBlock{offset: offset + int64(n), length: len(data)}
+		switch c.Type() {
+		case cid.Raw:
+			block.fileSize = uint64(len(data))
+		case cid.DagProtobuf:
+			node, e := merkledag.DecodeProtobuf(data)
+			if e != nil {
+				return nil, probe.NewError(e).Trace(carPath, c.String())
+			}
+			for _, link := range node.Links() {
+				block.links = append(block.links, carLink{Name: link.Name, Cid: link.Cid})
+			}
+			if fsNode, e := unixfs.FSNodeFromBytes(node.Data()); e == nil {
+				switch fsNode.Type() {
+				case unixfs.TDirectory, unixfs.THAMTShard:
+					block.isDir = true
+				default:
+					block.fileSize = fsNode.FileSize()
+				}
+			}
+		}
+		index.blocks[c] = block
+	}
+	return index, nil
+}
+
+// verifyBlock checks that the block data matches its CID.
+func verifyBlock(c cid.Cid, data []byte) *probe.Error {
+	sum, e := c.Prefix().Sum(data)
+	if e != nil {
+		return probe.NewError(e).Trace(c.String())
+	}
+	if !sum.Equals(c) {
+		return errCorruptedBlock(c.String(), "does not match its hash").Trace(c.String())
+	}
+	return nil
+}
+
+// readBlock reads and verifies the data of a block from the CAR file.
+func (index *carIndex) readBlock(file io.ReaderAt, c cid.Cid) ([]byte, *probe.Error) {
+	block, ok := index.blocks[c]
+	if !ok {
+		return nil, errCorruptedBlock(c.String(), "is missing from the CAR file").Trace(c.String())
+	}
+	data := make([]byte, block.length)
+	if _, e := file.ReadAt(data, block.offset); e != nil {
+		return nil, probe.NewError(e).Trace(c.String())
+	}
+	if err := verifyBlock(c, data); err != nil {
+		return nil, err.Trace(c.String())
+	}
+	return data, nil
+}
+
+// writeFile writes the content of the UnixFS file c to w and returns the
+// number of bytes written.
+func (index *carIndex) writeFile(file io.ReaderAt, c cid.Cid, w io.Writer) (uint64, *probe.Error) {
+	data, err := index.readBlock(file, c)
+	if err != nil {
+		return 0, err.Trace(c.String())
+	}
+	if c.Type() == cid.Raw {
+		n, e := w.Write(data)
+		if e != nil {
+			return uint64(n), probe.NewError(e)
+		}
+		return uint64(n), nil
+	}
+
+	node, e := merkledag.DecodeProtobuf(data)
+	if e != nil {
+		return 0, probe.NewError(e).Trace(c.String())
+	}
+	fsNode, e := unixfs.FSNodeFromBytes(node.Data())
+	if e != nil {
+		return 0, probe.NewError(e).Trace(c.String())
+	}
+	var written uint64
+	if len(fsNode.Data()) > 0 {
+		n, e := w.Write(fsNode.Data())
+		written += uint64(n)
+		if e != nil {
+			return written, probe.NewError(e)
+		}
+	}
+	for _, link := range node.Links() {
+		n, err := index.writeFile(file, link.Cid, w)
+		written += n
+		if err != nil {
+			return written, err.Trace(c.String())
+		}
+	}
+	return written, nil
+}
+
+// missingBlocks returns the blocks linked from the roots that are not in the CAR.
+func (index *carIndex) missingBlocks() []cid.Cid {
+	var missing []cid.Cid
+	seen := make(map[cid.Cid]bool)
+	pending := append([]cid.Cid{}, index.roots...)
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		block, ok := index.blocks[c]
+		if !ok {
+			missing = append(missing, c)
+			continue
+		}
+		for _, link := range block.links {
+			pending = append(pending, link.Cid)
+		}
+	}
+	return missing
+}
+
+// tree lists the files and directories reachable from the roots. Blocks
+// that are not in the CAR are skipped.
+func (index *carIndex) tree() []carTreeEntry {
+	var entries []carTreeEntry
+	var walk func(c cid.Cid, name string)
+	walk = func(c cid.Cid, name string) {
+		block, ok := index.blocks[c]
+		if !ok {
+			return
+		}
+		entries = append(entries, carTreeEntry{Path: name, Cid: c.String(), Size: block.fileSize, IsDir: block.isDir})
+		if !block.isDir {
+			return
+		}
+		for _, link := range block.links {
+			walk(link.Cid, path.Join(name, link.Name))
+		}
+	}
+	for _, root := range index.roots {
+		walk(root, "")
+	}
+	return entries
+}
+
+// carInspectMessage container for CAR inspect messages.
+type carInspectMessage struct {
+	Status      string         `json:"status"`
+	File        string         `json:"file"`
+	Roots       []string       `json:"roots"`
+	Blocks      int            `json:"blocks"`
+	BlockSize   int64          `json:"blockSize"`
+	PayloadSize uint64         `json:"payloadSize"`
+	Tree        []carTreeEntry `json:"tree"`
+}
+
+// JSON jsonified CAR inspect message.
+func (c carInspectMessage) JSON() string {
+	inspectJSONBytes, e := json.MarshalIndent(c, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(inspectJSONBytes)
+}
+
+// String colorized CAR inspect message.
+func (c carInspectMessage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", console.Colorize("Key", "File"), c.File)
+	fmt.Fprintf(&b, "%s: %s\n", console.Colorize("Key", "Roots"), strings.Join(c.Roots, ", "))
+	fmt.Fprintf(&b, "%s: %d (%s)\n", console.Colorize("Key", "Blocks"), c.Blocks, humanize.IBytes(uint64(c.BlockSize)))
+	fmt.Fprintf(&b, "%s: %s\n", console.Colorize("Key", "Payload"), humanize.IBytes(c.PayloadSize))
+	for _, entry := range c.Tree {
+		name := entry.Path
+		if entry.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "%10s %s %s\n", humanize.IBytes(entry.Size), entry.Cid, name)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// mainCarInspect is the handle for "mc car inspect" command.
+func mainCarInspect(ctx *cli.Context) error {
+	if !ctx.Args().Present() {
+		cli.ShowCommandHelpAndExit(ctx, "inspect", globalErrorExitStatus)
+	}
+
+	// Set colors.
+	console.SetColor("Key", color.New(color.FgCyan, color.Bold))
+
+	for _, carPath := range ctx.Args() {
+		index, err := loadCarIndex(carPath)
+		fatalIf(err, "Unable to read CAR file `"+carPath+"`.")
+
+		msg := carInspectMessage{
+			Status:    "success",
+			File:      carPath,
+			Blocks:    len(index.blocks),
+			BlockSize: index.blockSize,
+			Tree:      index.tree(),
+		}
+		for _, root := range index.roots {
+			msg.Roots = append(msg.Roots, root.String())
+		}
+		for _, entry := range msg.Tree {
+			if !entry.IsDir {
+				msg.PayloadSize += entry.Size
+			}
+		}
+		printMsg(msg)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCarHex is a CAR file with the raw block of "hello world\n" as root.
+const testCarHex = "3aa265726f6f747381d82a58250001551220a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a4476776657273696f6e013001551220a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a44768656c6c6f20776f726c640a"
+
+const testCarRoot = "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"
+
+// writeTestCars writes the test CAR file into dir, along with a truncated
+// copy, a copy with a corrupted block and a copy with an oversized section
+// length, and returns their paths by name.
+func writeTestCars(t *testing.T, dir string) map[string]string {
+	data, e := hex.DecodeString(testCarHex)
+	if e != nil {
+		t.Fatal(e)
+	}
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	// The section of the block starts right after the header of 0x3a bytes,
+	// replace its length of 0x30 bytes with 2^35.
+	oversized := append(append(append([]byte{}, data[:0x3b]...), 0x80, 0x80, 0x80, 0x80, 0x80, 0x01), data[0x3c:]...)
+
+	cars := map[string][]byte{
+		"good":      data,
+		"truncated": data[:len(data)-5],
+		"corrupted": corrupted,
+		"oversized": oversized,
+		"empty":     nil,
+	}
+	carPaths := make(map[string]string)
+	for name, carData := range cars {
+		carDir := filepath.Join(dir, name)
+		if e = os.Mkdir(carDir, 0755); e != nil {
+			t.Fatal(e)
+		}
+		carPath := filepath.Join(carDir, testCarRoot+".car")
+		if e = ioutil.WriteFile(carPath, carData, 0644); e != nil {
+			t.Fatal(e)
+		}
+		carPaths[name] = carPath
+	}
+	return carPaths
+}
+
+func TestLoadCarIndex(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-inspect")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	carPaths := writeTestCars(t, dir)
+
+	index, err := loadCarIndex(carPaths["good"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.roots) != 1 || index.roots[0].String() != testCarRoot {
+		t.Errorf("expected root %s, got %v", testCarRoot, index.roots)
+	}
+	if len(index.blocks) != 1 || index.blockSize != 12 {
+		t.Errorf("expected 1 block of 12 bytes, got %d blocks of %d bytes", len(index.blocks), index.blockSize)
+	}
+	if tree := index.tree(); len(tree) != 1 || tree[0].Cid != testCarRoot || tree[0].Size != 12 || tree[0].IsDir {
+		t.Errorf("unexpected tree %+v", tree)
+	}
+	if missing := index.missingBlocks(); len(missing) != 0 {
+		t.Errorf("expected no missing blocks, got %v", missing)
+	}
+
+	for _, name := range []string{"truncated", "corrupted", "oversized", "empty"} {
+		if _, err = loadCarIndex(carPaths[name]); err == nil {
+			t.Errorf("expected an error for the %s CAR file", name)
+		}
+	}
+}
+
+func TestVerifyCar(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-verify")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	carPaths := writeTestCars(t, dir)
+
+	pieceCid, pieceSize, err := computeCommP(context.Background(), carPaths["good"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := "playload_cid,filename,piece_cid,piece_size\n" +
+		testCarRoot + ",hello," + pieceCid + ",128\n"
+	manifestPath := filepath.Join(dir, carManifestName)
+	if e = ioutil.WriteFile(manifestPath, []byte(manifest), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if pieceSize != 127 {
+		t.Errorf("expected piece size 127, got %d", pieceSize)
+	}
+
+	testCases := []struct {
+		name     string
+		manifest string
+		ok       bool
+	}{
+		{"good", manifestPath, true},
+		// No manifest next to the CAR file.
+		{"good", "", false},
+		{"truncated", manifestPath, false},
+		{"corrupted", manifestPath, false},
+		{"oversized", manifestPath, false},
+		{"empty", manifestPath, false},
+	}
+	for i, testCase := range testCases {
+		msg := verifyCar(context.Background(), carPaths[testCase.name], testCase.manifest, make(carManifests))
+		if ok := len(msg.Problems) == 0; ok != testCase.ok {
+			t.Errorf("Test %d: expected ok %v for the %s CAR file, got problems %v", i+1, testCase.ok, testCase.name, msg.Problems)
+		}
+	}
+
+	wrong := "playload_cid,filename,piece_cid,piece_size\n" +
+		testCarRoot + ",hello," + pieceCid + ",256\n"
+	if e = ioutil.WriteFile(manifestPath, []byte(wrong), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if msg := verifyCar(context.Background(), carPaths["good"], manifestPath, make(carManifests)); len(msg.Problems) != 1 {
+		t.Errorf("expected a piece size problem, got %v", msg.Problems)
+	}
+}
@@ -4,6 +4,9 @@ import "github.com/minio/cli"
 
 var carCmdSubcommands = []cli.Command{
 	carGenerateCmd,
+	carInspectCmd,
+	carVerifyCmd,
+	carExtractCmd,
 }
 
 var carCmd = cli.Command{
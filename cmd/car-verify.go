@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+)
+
+var carVerifyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "manifest",
+		Usage: "manifest written by `car generate --save-manifest`, default: manifest.csv next to each CAR file",
+	},
+}
+
+var carVerifyCmd = cli.Command{
+	Name:         "verify",
+	Usage:        "verify CAR files against their manifest",
+	Action:       mainCarVerify,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(carVerifyFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CAR-FILE | CAR-DIR [CAR-FILE | CAR-DIR...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Check that every block of a CAR file matches its CID and that the DAG is complete,
+  then recompute the data CID, piece CID and piece size and compare them with the
+  manifest. Exits with a non-zero status if any CAR file fails.
+
+EXAMPLES:
+  1. Verify all CAR files of a directory before sending deals.
+     {{.Prompt}} {{.HelpName}} /data/car
+
+  2. Verify a CAR file against a manifest stored elsewhere.
+     {{.Prompt}} {{.HelpName}} --manifest /data/manifest.csv /data/car/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi.car
+`,
+}
+
+// carVerifyMessage container for CAR verify messages.
+type carVerifyMessage struct {
+	Status    string   `json:"status"`
+	File      string   `json:"file"`
+	DataCid   string   `json:"dataCid,omitempty"`
+	PieceCid  string   `json:"pieceCid,omitempty"`
+	PieceSize uint64   `json:"pieceSize,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// JSON jsonified CAR verify message.
+func (c carVerifyMessage) JSON() string {
+	verifyJSONBytes, e := json.MarshalIndent(c, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(verifyJSONBytes)
+}
+
+// String colorized CAR verify message.
+func (c carVerifyMessage) String() string {
+	if len(c.Problems) == 0 {
+		return console.Colorize("VerifyOK", "OK     ") + c.File
+	}
+	return console.Colorize("VerifyFailed", "FAILED ") + c.File + "\n  " + strings.Join(c.Problems, "\n  ")
+}
+
+// paddedPieceSize returns the padded size of an unpadded piece size.
+func paddedPieceSize(unpadded uint64) uint64 {
+	return unpadded + unpadded/127
+}
+
+// expandCarPaths replaces directories with the CAR files they contain.
+func expandCarPaths(args []string) ([]string, *probe.Error) {
+	var carPaths []string
+	for _, arg := range args {
+		st, e := os.Stat(arg)
+		if e != nil {
+			return nil, probe.NewError(e).Trace(arg)
+		}
+		if !st.IsDir() {
+			carPaths = append(carPaths, arg)
+			continue
+		}
+		entries, e := ioutil.ReadDir(arg)
+		if e != nil {
+			return nil, probe.NewError(e).Trace(arg)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && filepath.Ext(entry.Name()) == ".car" {
+				carPaths = append(carPaths, filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	return carPaths, nil
+}
+
+// carManifests caches manifests by path, indexed by data CID.
+type carManifests map[string]map[string]*OfflineDeal
+
+func (m carManifests) lookup(manifestPath, dataCid string) (*OfflineDeal, *probe.Error) {
+	rows, ok := m[manifestPath]
+	if !ok {
+		deals, err := readDealCsv(manifestPath)
+		if err != nil {
+			return nil, err.Trace(manifestPath)
+		}
+		rows = make(map[string]*OfflineDeal)
+		for _, deal := range deals {
+			rows[deal.DataCid] = deal
+		}
+		m[manifestPath] = rows
+	}
+	return rows[dataCid], nil
+}
+
+// verifyCar checks a CAR file and compares it with its manifest entry.
+func verifyCar(ctx context.Context, carPath, manifestPath string, manifests carManifests) carVerifyMessage {
+	msg := carVerifyMessage{File: carPath}
+
+	index, err := loadCarIndex(carPath)
+	if err != nil {
+		msg.Problems = append(msg.Problems, err.ToGoError().Error())
+		return msg
+	}
+	if len(index.roots) != 1 {
+		msg.Problems = append(msg.Problems, fmt.Sprintf("expected 1 root, found %d", len(index.roots)))
+		return msg
+	}
+	msg.DataCid = index.roots[0].String()
+	if missing := index.missingBlocks(); len(missing) > 0 {
+		msg.Problems = append(msg.Problems, fmt.Sprintf("%d blocks of the DAG are missing, first missing block %s", len(missing), missing[0]))
+	}
+
+	msg.PieceCid, msg.PieceSize, err = computeCommP(ctx, carPath)
+	if err != nil {
+		msg.Problems = append(msg.Problems, "unable to compute piece CID: "+err.ToGoError().Error())
+		return msg
+	}
+
+	if manifestPath == "" {
+		manifestPath = filepath.Join(filepath.Dir(carPath), carManifestName)
+	}
+	entry, err := manifests.lookup(manifestPath, msg.DataCid)
+	switch {
+	case err != nil:
+		msg.Problems = append(msg.Problems, "unable to read manifest: "+err.ToGoError().Error())
+	case entry == nil:
+		msg.Problems = append(msg.Problems, "data CID "+msg.DataCid+" not found in "+manifestPath)
+	default:
+		if entry.PieceCid != msg.PieceCid {
+			msg.Problems = append(msg.Problems, "piece CID "+msg.PieceCid+" does not match manifest "+entry.PieceCid)
+		}
+		size, e := strconv.ParseUint(entry.PieceSize, 10, 64)
+		if e != nil || (size != msg.PieceSize && size != paddedPieceSize(msg.PieceSize)) {
+			msg.Problems = append(msg.Problems, fmt.Sprintf("piece size %d does not match manifest %s", msg.PieceSize, entry.PieceSize))
+		}
+	}
+	return msg
+}
+
+// mainCarVerify is the handle for "mc car verify" command.
+func mainCarVerify(cliCtx *cli.Context) error {
+	if !cliCtx.Args().Present() {
+		cli.ShowCommandHelpAndExit(cliCtx, "verify", globalErrorExitStatus)
+	}
+	ctx, cancelVerify := context.WithCancel(globalContext)
+	defer cancelVerify()
+
+	// Set colors.
+	console.SetColor("VerifyOK", color.New(color.FgGreen, color.Bold))
+	console.SetColor("VerifyFailed", color.New(color.FgRed, color.Bold))
+
+	carPaths, err := expandCarPaths(cliCtx.Args())
+	fatalIf(err, "Unable to find CAR files.")
+
+	manifestPath := cliCtx.String("manifest")
+	manifests := make(carManifests)
+	failed := false
+	for _, carPath := range carPaths {
+		msg := verifyCar(ctx, carPath, manifestPath, manifests)
+		msg.Status = "success"
+		if len(msg.Problems) > 0 {
+			msg.Status = "error"
+			failed = true
+		}
+		printMsg(msg)
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
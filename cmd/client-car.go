@@ -0,0 +1,615 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/replication"
+)
+
+// carAPIType names the CAR backend in APINotImplemented errors.
+const carAPIType = "CAR archive"
+
+// carFilePart is the part of a file stored in one CAR file.
+type carFilePart struct {
+	carPath string
+	index   *carIndex
+	cid     cid.Cid
+}
+
+// carEntry is a file or a directory of a CAR archive.
+type carEntry struct {
+	isDir    bool
+	size     int64
+	children []string
+	parts    []carFilePart
+}
+
+// carArchive is the file tree of a CAR file, or of the CAR slices listed in
+// the manifest of a directory, keyed by slash separated path.
+type carArchive struct {
+	modTime time.Time
+	entries map[string]*carEntry
+}
+
+// Archives are loaded once, cp opens a client for every object.
+var (
+	carArchivesMu sync.Mutex
+	carArchives   = make(map[string]*carArchive)
+)
+
+// splitCarPath splits a local path going into a CAR file, or into a
+// directory of CAR slices named *.car, at the archive.
+func splitCarPath(fpath string) (carPath, inner string, ok bool) {
+	slashPath := filepath.ToSlash(fpath)
+	for i := 0; i < len(slashPath); i++ {
+		if slashPath[i] != '/' || !strings.HasSuffix(slashPath[:i], ".car") {
+			continue
+		}
+		carPath = filepath.FromSlash(slashPath[:i])
+		st, e := os.Stat(carPath)
+		if e != nil {
+			return "", "", false
+		}
+		if !st.Mode().IsRegular() {
+			if _, e = os.Stat(filepath.Join(carPath, carManifestName)); e != nil {
+				continue
+			}
+		}
+		return carPath, cleanCarPath(slashPath[i:]), true
+	}
+	return "", "", false
+}
+
+// cleanCarPath returns the key of a path in a CAR archive.
+func cleanCarPath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// carNew returns a client on a path into a CAR archive, nil for any other path.
+func carNew(urlStr string) Client {
+	fpath := normalizePath(urlStr)
+	carPath, inner, ok := splitCarPath(fpath)
+	if !ok {
+		return nil
+	}
+	return &carClient{
+		PathURL: newClientURL(fpath),
+		carPath: carPath,
+		inner:   inner,
+	}
+}
+
+// loadCarArchive returns the file tree of a CAR file or of a directory of
+// CAR slices.
+func loadCarArchive(carPath string) (*carArchive, *probe.Error) {
+	carArchivesMu.Lock()
+	defer carArchivesMu.Unlock()
+	if archive, ok := carArchives[carPath]; ok {
+		return archive, nil
+	}
+
+	st, e := os.Stat(carPath)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(carPath)
+	}
+	archive := &carArchive{
+		modTime: st.ModTime(),
+		entries: map[string]*carEntry{"": {isDir: true}},
+	}
+
+	slices := []string{carPath}
+	if st.IsDir() {
+		// Files spread over slices are rebuilt in the order of the manifest.
+		manifestPath := filepath.Join(carPath, carManifestName)
+		deals, err := readDealCsv(manifestPath)
+		if err != nil {
+			return nil, err.Trace(manifestPath)
+		}
+		slices = slices[:0]
+		for _, deal := range deals {
+			slicePath := findSliceCar(carPath, deal)
+			if slicePath == "" {
+				return nil, probe.NewError(PathNotFound{Path: filepath.Join(carPath, deal.DataCid+".car")})
+			}
+			slices = append(slices, slicePath)
+		}
+	}
+	for _, slicePath := range slices {
+		index, err := loadCarIndex(slicePath)
+		if err != nil {
+			return nil, err.Trace(slicePath)
+		}
+		if err = archive.addSlice(slicePath, index, st.IsDir()); err != nil {
+			return nil, err.Trace(slicePath)
+		}
+	}
+	for _, entry := range archive.entries {
+		sort.Strings(entry.children)
+	}
+
+	carArchives[carPath] = archive
+	return archive, nil
+}
+
+// addSlice adds the files of a CAR file to the tree, appending the parts of
+// the files continuing from a previous slice. With joinParts, the parts
+// graphsplit names after the index of the part are joined into their file.
+func (a *carArchive) addSlice(carPath string, index *carIndex, joinParts bool) *probe.Error {
+	for _, treeEntry := range index.tree() {
+		if treeEntry.Path == "" {
+			continue
+		}
+		name := cleanCarPath(treeEntry.Path)
+		if joinParts && !treeEntry.IsDir {
+			name, _ = graphsplitFileName(name)
+		}
+		if treeEntry.IsDir {
+			a.addDir(name)
+			continue
+		}
+		c, e := cid.Decode(treeEntry.Cid)
+		if e != nil {
+			return probe.NewError(e).Trace(treeEntry.Cid)
+		}
+		entry, ok := a.entries[name]
+		if !ok {
+			entry = &carEntry{}
+			a.entries[name] = entry
+			a.addChild(name)
+		}
+		entry.parts = append(entry.parts, carFilePart{carPath: carPath, index: index, cid: c})
+		entry.size += int64(treeEntry.Size)
+	}
+	return nil
+}
+
+// addDir adds a directory and its parents to the tree.
+func (a *carArchive) addDir(name string) {
+	if _, ok := a.entries[name]; ok {
+		return
+	}
+	a.entries[name] = &carEntry{isDir: true}
+	a.addChild(name)
+}
+
+// addChild links an entry to its parent directory.
+func (a *carArchive) addChild(name string) {
+	parent := cleanCarPath(path.Dir(name))
+	a.addDir(parent)
+	a.entries[parent].children = append(a.entries[parent].children, path.Base(name))
+}
+
+// CAR archive client
+type carClient struct {
+	PathURL *ClientURL
+	carPath string
+	inner   string
+}
+
+// URL get url.
+func (c *carClient) GetURL() ClientURL {
+	return *c.PathURL
+}
+
+// entryURL returns the URL of a path of the archive.
+func (c *carClient) entryURL(name string) ClientURL {
+	if name == "" {
+		// The archive itself is only opened with a trailing separator.
+		return *newClientURL(c.carPath + string(filepath.Separator))
+	}
+	return *newClientURL(filepath.Join(c.carPath, filepath.FromSlash(name)))
+}
+
+// content returns the client content of an entry of the archive.
+func (c *carClient) content(archive *carArchive, name string, entry *carEntry) *ClientContent {
+	content := &ClientContent{
+		URL:  c.entryURL(name),
+		Time: archive.modTime,
+		Size: entry.size,
+		Type: os.FileMode(0444),
+	}
+	if entry.isDir {
+		content.Type = os.ModeDir | 0555
+	}
+	return content
+}
+
+// Stat - get metadata of a path of the archive.
+func (c *carClient) Stat(ctx context.Context, opts StatOptions) (*ClientContent, *probe.Error) {
+	archive, err := loadCarArchive(c.carPath)
+	if err != nil {
+		return nil, err.Trace(c.PathURL.String())
+	}
+	entry, ok := archive.entries[c.inner]
+	if !ok {
+		return nil, probe.NewError(PathNotFound{Path: c.PathURL.Path})
+	}
+	content := c.content(archive, c.inner, entry)
+	content.URL = *c.PathURL
+	content.Metadata = map[string]string{
+		"Content-Type": guessURLContentType(c.PathURL.Path),
+	}
+	return content, nil
+}
+
+// List - list files and folders of the archive.
+func (c *carClient) List(ctx context.Context, opts ListOptions) <-chan *ClientContent {
+	contentCh := make(chan *ClientContent)
+	go func() {
+		defer close(contentCh)
+		archive, err := loadCarArchive(c.carPath)
+		if err != nil {
+			contentCh <- &ClientContent{Err: err.Trace(c.PathURL.String())}
+			return
+		}
+
+		entry, ok := archive.entries[c.inner]
+		isDir := ok && entry.isDir
+		hasSeparator := strings.HasSuffix(c.PathURL.Path, string(c.PathURL.Separator))
+		switch {
+		case isDir && opts.Recursive:
+			c.walk(contentCh, archive, c.inner, opts.ShowDir)
+		case isDir && (hasSeparator || c.inner == ""):
+			for _, child := range entry.children {
+				name := path.Join(c.inner, child)
+				contentCh <- c.content(archive, name, archive.entries[name])
+			}
+		case ok && !isDir:
+			contentCh <- c.content(archive, c.inner, entry)
+		default:
+			// Treat the path like a prefix of the entries of its directory.
+			parent := cleanCarPath(path.Dir(c.inner))
+			prefix := path.Base(c.inner)
+			if hasSeparator {
+				prefix = ""
+			}
+			parentEntry, ok := archive.entries[parent]
+			if !ok || !parentEntry.isDir {
+				return
+			}
+			for _, child := range parentEntry.children {
+				if !strings.HasPrefix(child, prefix) {
+					continue
+				}
+				name := path.Join(parent, child)
+				if opts.Recursive {
+					c.walk(contentCh, archive, name, opts.ShowDir)
+				} else {
+					contentCh <- c.content(archive, name, archive.entries[name])
+				}
+			}
+		}
+	}()
+	return contentCh
+}
+
+// walk sends the files under a path, with its directories as in dirOpt.
+func (c *carClient) walk(contentCh chan<- *ClientContent, archive *carArchive, name string, dirOpt DirOpt) {
+	entry := archive.entries[name]
+	if !entry.isDir {
+		contentCh <- c.content(archive, name, entry)
+		return
+	}
+	if dirOpt == DirFirst {
+		contentCh <- c.content(archive, name, entry)
+	}
+	for _, child := range entry.children {
+		c.walk(contentCh, archive, path.Join(name, child), dirOpt)
+	}
+	if dirOpt == DirLast {
+		contentCh <- c.content(archive, name, entry)
+	}
+}
+
+// Get returns a reader of a file of the archive, verifying its blocks.
+func (c *carClient) Get(ctx context.Context, opts GetOptions) (io.ReadCloser, *probe.Error) {
+	archive, err := loadCarArchive(c.carPath)
+	if err != nil {
+		return nil, err.Trace(c.PathURL.String())
+	}
+	entry, ok := archive.entries[c.inner]
+	if !ok {
+		return nil, probe.NewError(PathNotFound{Path: c.PathURL.Path})
+	}
+	if entry.isDir {
+		return nil, probe.NewError(PathIsNotRegular{Path: c.PathURL.Path})
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		for _, part := range entry.parts {
+			file, e := os.Open(part.carPath)
+			if e != nil {
+				writer.CloseWithError(e)
+				return
+			}
+			_, err := part.index.writeFile(file, part.cid, writer)
+			file.Close()
+			if err != nil {
+				writer.CloseWithError(err.ToGoError())
+				return
+			}
+		}
+		writer.Close()
+	}()
+	return reader, nil
+}
+
+// Put - CAR archives are read-only.
+func (c *carClient) Put(ctx context.Context, reader io.Reader, size int64, progress io.Reader, opts PutOptions) (int64, *probe.Error) {
+	return 0, probe.NewError(APINotImplemented{
+		API:     "Put",
+		APIType: carAPIType,
+	})
+}
+
+// Copy - CAR archives are read-only.
+func (c *carClient) Copy(ctx context.Context, source string, opts CopyOptions, progress io.Reader) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "Copy",
+		APIType: carAPIType,
+	})
+}
+
+// Remove - CAR archives are read-only.
+func (c *carClient) Remove(ctx context.Context, isIncomplete, isRemoveBucket, isBypass bool, contentCh <-chan *ClientContent) <-chan *probe.Error {
+	errorCh := make(chan *probe.Error, 1)
+	errorCh <- probe.NewError(APINotImplemented{
+		API:     "Remove",
+		APIType: carAPIType,
+	})
+	close(errorCh)
+	return errorCh
+}
+
+// Select - not implemented for CAR archives.
+func (c *carClient) Select(ctx context.Context, expression string, sse encrypt.ServerSide, opts SelectObjectOpts) (io.ReadCloser, *probe.Error) {
+	return nil, probe.NewError(APINotImplemented{
+		API:     "Select",
+		APIType: carAPIType,
+	})
+}
+
+// Watch - CAR archives do not change.
+func (c *carClient) Watch(ctx context.Context, options WatchOptions) (*WatchObject, *probe.Error) {
+	return nil, probe.NewError(APINotImplemented{
+		API:     "Watch",
+		APIType: carAPIType,
+	})
+}
+
+// ShareDownload - not implemented for CAR archives.
+func (c *carClient) ShareDownload(ctx context.Context, versionID string, expires time.Duration) (string, *probe.Error) {
+	return "", probe.NewError(APINotImplemented{
+		API:     "ShareDownload",
+		APIType: carAPIType,
+	})
+}
+
+// ShareUpload - not implemented for CAR archives.
+func (c *carClient) ShareUpload(ctx context.Context, startsWith bool, expires time.Duration, contentType string) (string, map[string]string, *probe.Error) {
+	return "", nil, probe.NewError(APINotImplemented{
+		API:     "ShareUpload",
+		APIType: carAPIType,
+	})
+}
+
+// MakeBucket - CAR archives are read-only.
+func (c *carClient) MakeBucket(ctx context.Context, region string, ignoreExisting, withLock bool) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "MakeBucket",
+		APIType: carAPIType,
+	})
+}
+
+// SetObjectLockConfig - not implemented for CAR archives.
+func (c *carClient) SetObjectLockConfig(ctx context.Context, mode minio.RetentionMode, validity uint64, unit minio.ValidityUnit) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetObjectLockConfig",
+		APIType: carAPIType,
+	})
+}
+
+// GetObjectLockConfig - not implemented for CAR archives.
+func (c *carClient) GetObjectLockConfig(ctx context.Context) (string, minio.RetentionMode, uint64, minio.ValidityUnit, *probe.Error) {
+	return "", "", 0, "", probe.NewError(APINotImplemented{
+		API:     "GetObjectLockConfig",
+		APIType: carAPIType,
+	})
+}
+
+// GetAccess - not implemented for CAR archives.
+func (c *carClient) GetAccess(ctx context.Context) (string, string, *probe.Error) {
+	return "", "", probe.NewError(APINotImplemented{
+		API:     "GetAccess",
+		APIType: carAPIType,
+	})
+}
+
+// GetAccessRules - not implemented for CAR archives.
+func (c *carClient) GetAccessRules(ctx context.Context) (map[string]string, *probe.Error) {
+	return map[string]string{}, probe.NewError(APINotImplemented{
+		API:     "GetAccessRules",
+		APIType: carAPIType,
+	})
+}
+
+// SetAccess - not implemented for CAR archives.
+func (c *carClient) SetAccess(ctx context.Context, access string, isJSON bool) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetAccess",
+		APIType: carAPIType,
+	})
+}
+
+// PutObjectRetention - not implemented for CAR archives.
+func (c *carClient) PutObjectRetention(ctx context.Context, versionID string, mode minio.RetentionMode, retainUntilDate time.Time, bypassGovernance bool) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "PutObjectRetention",
+		APIType: carAPIType,
+	})
+}
+
+// GetObjectRetention - not implemented for CAR archives.
+func (c *carClient) GetObjectRetention(ctx context.Context, versionID string) (minio.RetentionMode, time.Time, *probe.Error) {
+	return "", time.Time{}, probe.NewError(APINotImplemented{
+		API:     "GetObjectRetention",
+		APIType: carAPIType,
+	})
+}
+
+// PutObjectLegalHold - not implemented for CAR archives.
+func (c *carClient) PutObjectLegalHold(ctx context.Context, versionID string, lhold minio.LegalHoldStatus) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "PutObjectLegalHold",
+		APIType: carAPIType,
+	})
+}
+
+// GetObjectLegalHold - not implemented for CAR archives.
+func (c *carClient) GetObjectLegalHold(ctx context.Context, versionID string) (minio.LegalHoldStatus, *probe.Error) {
+	return "", probe.NewError(APINotImplemented{
+		API:     "GetObjectLegalHold",
+		APIType: carAPIType,
+	})
+}
+
+func (c *carClient) AddUserAgent(_, _ string) {
+}
+
+// GetTags - not implemented for CAR archives.
+func (c *carClient) GetTags(ctx context.Context, versionID string) (map[string]string, *probe.Error) {
+	return nil, probe.NewError(APINotImplemented{
+		API:     "GetObjectTagging",
+		APIType: carAPIType,
+	})
+}
+
+// SetTags - not implemented for CAR archives.
+func (c *carClient) SetTags(ctx context.Context, versionID, tags string) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetObjectTagging",
+		APIType: carAPIType,
+	})
+}
+
+// DeleteTags - not implemented for CAR archives.
+func (c *carClient) DeleteTags(ctx context.Context, versionID string) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "DeleteObjectTagging",
+		APIType: carAPIType,
+	})
+}
+
+// GetLifecycle - not implemented for CAR archives.
+func (c *carClient) GetLifecycle(ctx context.Context) (*lifecycle.Configuration, *probe.Error) {
+	return nil, probe.NewError(APINotImplemented{
+		API:     "GetLifecycle",
+		APIType: carAPIType,
+	})
+}
+
+// SetLifecycle - not implemented for CAR archives.
+func (c *carClient) SetLifecycle(ctx context.Context, _ *lifecycle.Configuration) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetLifecycle",
+		APIType: carAPIType,
+	})
+}
+
+// GetVersion - not implemented for CAR archives.
+func (c *carClient) GetVersion(ctx context.Context) (minio.BucketVersioningConfiguration, *probe.Error) {
+	return minio.BucketVersioningConfiguration{}, probe.NewError(APINotImplemented{
+		API:     "GetVersion",
+		APIType: carAPIType,
+	})
+}
+
+// SetVersion - not implemented for CAR archives.
+func (c *carClient) SetVersion(ctx context.Context, status string) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetVersion",
+		APIType: carAPIType,
+	})
+}
+
+// GetReplication - not implemented for CAR archives.
+func (c *carClient) GetReplication(ctx context.Context) (replication.Config, *probe.Error) {
+	return replication.Config{}, probe.NewError(APINotImplemented{
+		API:     "GetReplication",
+		APIType: carAPIType,
+	})
+}
+
+// SetReplication - not implemented for CAR archives.
+func (c *carClient) SetReplication(ctx context.Context, cfg *replication.Config, opts replication.Options) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetReplication",
+		APIType: carAPIType,
+	})
+}
+
+// RemoveReplication - not implemented for CAR archives.
+func (c *carClient) RemoveReplication(ctx context.Context) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "RemoveReplication",
+		APIType: carAPIType,
+	})
+}
+
+// GetReplicationMetrics - not implemented for CAR archives.
+func (c *carClient) GetReplicationMetrics(ctx context.Context) (replication.Metrics, *probe.Error) {
+	return replication.Metrics{}, probe.NewError(APINotImplemented{
+		API:     "GetReplicationMetrics",
+		APIType: carAPIType,
+	})
+}
+
+// GetEncryption - not implemented for CAR archives.
+func (c *carClient) GetEncryption(ctx context.Context) (string, string, *probe.Error) {
+	return "", "", probe.NewError(APINotImplemented{
+		API:     "GetEncryption",
+		APIType: carAPIType,
+	})
+}
+
+// SetEncryption - not implemented for CAR archives.
+func (c *carClient) SetEncryption(ctx context.Context, algorithm, keyID string) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "SetEncryption",
+		APIType: carAPIType,
+	})
+}
+
+// DeleteEncryption - not implemented for CAR archives.
+func (c *carClient) DeleteEncryption(ctx context.Context) *probe.Error {
+	return probe.NewError(APINotImplemented{
+		API:     "DeleteEncryption",
+		APIType: carAPIType,
+	})
+}
+
+// GetBucketInfo - not implemented for CAR archives.
+func (c *carClient) GetBucketInfo(ctx context.Context) (BucketInfo, *probe.Error) {
+	return BucketInfo{}, probe.NewError(APINotImplemented{
+		API:     "GetBucketInfo",
+		APIType: carAPIType,
+	})
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+)
+
+func TestSplitCarPath(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-car-client")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	carFile := filepath.Join(dir, "file.car")
+	slicesDir := filepath.Join(dir, "slices.car")
+	plainDir := filepath.Join(dir, "plain.car")
+	if e = ioutil.WriteFile(carFile, []byte("car"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	for _, d := range []string{slicesDir, plainDir} {
+		if e = os.Mkdir(d, 0755); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e = ioutil.WriteFile(filepath.Join(slicesDir, carManifestName), []byte(""), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	testCases := []struct {
+		fpath   string
+		carPath string
+		inner   string
+		ok      bool
+	}{
+		{filepath.Join(dir, "file.car") + string(filepath.Separator), carFile, "", true},
+		{filepath.Join(dir, "file.car", "dir", "obj.csv"), carFile, "dir/obj.csv", true},
+		{filepath.Join(dir, "slices.car", "dir") + string(filepath.Separator), slicesDir, "dir", true},
+		// A CAR file itself is a file of the filesystem.
+		{carFile, "", "", false},
+		{filepath.Join(dir, "plain.car", "file.car"), "", "", false},
+		{filepath.Join(dir, "missing.car", "obj"), "", "", false},
+	}
+	for i, testCase := range testCases {
+		carPath, inner, ok := splitCarPath(testCase.fpath)
+		if carPath != testCase.carPath || inner != testCase.inner || ok != testCase.ok {
+			t.Errorf("Test %d: expected (%q, %q, %v), got (%q, %q, %v)", i+1,
+				testCase.carPath, testCase.inner, testCase.ok, carPath, inner, ok)
+		}
+	}
+}
+
+// newTestCarIndex returns an index with a directory tree and no block data.
+func newTestCarIndex(t *testing.T, root string, blocks map[string]*carBlock) *carIndex {
+	index := &carIndex{blocks: make(map[cid.Cid]*carBlock)}
+	c, e := cid.Decode(root)
+	if e != nil {
+		t.Fatal(e)
+	}
+	index.roots = []cid.Cid{c}
+	for key, block := range blocks {
+		c, e := cid.Decode(key)
+		if e != nil {
+			t.Fatal(e)
+		}
+		index.blocks[c] = block
+	}
+	return index
+}
+
+func testCarLink(t *testing.T, name, key string) carLink {
+	c, e := cid.Decode(key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return carLink{Name: name, Cid: c}
+}
+
+func TestCarClientList(t *testing.T) {
+	const (
+		rootCid = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hdA3Nn"
+		dirCid  = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+		fileA   = "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+		fileB   = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+	)
+	// big.csv is spread over the two slices, with the part names of graphsplit.
+	first := newTestCarIndex(t, rootCid, map[string]*carBlock{
+		rootCid: {isDir: true, links: []carLink{testCarLink(t, "top.txt", fileB), testCarLink(t, "dir", dirCid)}},
+		dirCid:  {isDir: true, links: []carLink{testCarLink(t, "big.csv.00000000", fileA)}},
+		fileA:   {fileSize: 10},
+		fileB:   {fileSize: 5},
+	})
+	second := newTestCarIndex(t, rootCid, map[string]*carBlock{
+		rootCid: {isDir: true, links: []carLink{testCarLink(t, "dir", dirCid)}},
+		dirCid:  {isDir: true, links: []carLink{testCarLink(t, "big.csv.00000001", fileA), testCarLink(t, "a.csv", fileB)}},
+		fileA:   {fileSize: 6},
+		fileB:   {fileSize: 3},
+	})
+
+	// The parts of a single CAR file keep their name.
+	single := &carArchive{entries: map[string]*carEntry{"": {isDir: true}}}
+	if err := single.addSlice("second.car", second, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := single.entries["dir/big.csv.00000001"]; !ok {
+		t.Error("expected dir/big.csv.00000001 in a single CAR file")
+	}
+
+	carPath := filepath.Join(os.TempDir(), "mc-test-slices.car")
+	archive := &carArchive{entries: map[string]*carEntry{"": {isDir: true}}}
+	if err := archive.addSlice(filepath.Join(carPath, "first.car"), first, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.addSlice(filepath.Join(carPath, "second.car"), second, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range archive.entries {
+		sort.Strings(entry.children)
+	}
+	carArchivesMu.Lock()
+	carArchives[carPath] = archive
+	carArchivesMu.Unlock()
+	defer func() {
+		carArchivesMu.Lock()
+		delete(carArchives, carPath)
+		carArchivesMu.Unlock()
+	}()
+
+	if big := archive.entries["dir/big.csv"]; big.size != 16 || len(big.parts) != 2 {
+		t.Fatalf("expected dir/big.csv of 16 bytes in 2 parts, got %d bytes in %d parts", big.size, len(big.parts))
+	}
+
+	sep := string(filepath.Separator)
+	testCases := []struct {
+		urlStr string
+		opts   ListOptions
+		paths  []string
+	}{
+		{carPath + sep, ListOptions{}, []string{"dir", "top.txt"}},
+		{filepath.Join(carPath, "dir") + sep, ListOptions{}, []string{"dir/a.csv", "dir/big.csv"}},
+		{filepath.Join(carPath, "dir", "b"), ListOptions{}, []string{"dir/big.csv"}},
+		{carPath + sep, ListOptions{Recursive: true}, []string{"dir/a.csv", "dir/big.csv", "top.txt"}},
+		{carPath + sep, ListOptions{Recursive: true, ShowDir: DirFirst}, []string{"", "dir", "dir/a.csv", "dir/big.csv", "top.txt"}},
+		{filepath.Join(carPath, "top.txt"), ListOptions{Recursive: true}, []string{"top.txt"}},
+	}
+	for i, testCase := range testCases {
+		clnt := carNewFromCache(t, carPath, testCase.urlStr)
+		var paths []string
+		for content := range clnt.List(context.Background(), testCase.opts) {
+			if content.Err != nil {
+				t.Fatalf("Test %d: %v", i+1, content.Err)
+			}
+			rel, e := filepath.Rel(carPath, content.URL.Path)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if rel == "." {
+				rel = ""
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(paths, testCase.paths) {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.paths, paths)
+		}
+	}
+
+	content, err := carNewFromCache(t, carPath, filepath.Join(carPath, "dir")).Stat(context.Background(), StatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !content.Type.IsDir() {
+		t.Errorf("expected dir to be a directory, got %v", content.Type)
+	}
+	if _, err = carNewFromCache(t, carPath, filepath.Join(carPath, "missing")).Stat(context.Background(), StatOptions{}); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+	if _, err = carNewFromCache(t, carPath, filepath.Join(carPath, "top.txt")).Put(context.Background(), nil, 0, nil, PutOptions{}); err == nil {
+		t.Error("expected Put to be not implemented")
+	}
+}
+
+// carNewFromCache returns a client on a cached archive which is not on disk.
+func carNewFromCache(t *testing.T, carPath, urlStr string) Client {
+	rel, e := filepath.Rel(carPath, urlStr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &carClient{
+		PathURL: newClientURL(urlStr),
+		carPath: carPath,
+		inner:   cleanCarPath(filepath.ToSlash(rel)),
+	}
+}
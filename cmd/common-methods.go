@@ -467,8 +467,13 @@ func uploadSourceToTargetURL(ctx context.Context, urls URLs, progress io.Reader,
 		metadata[http.CanonicalHeaderKey(k)] = v
 	}
 
-	// Optimize for server side copy if the host is same.
-	if sourceAlias == targetAlias {
+	// Optimize for server side copy if the host is same, files in
+	// CAR archives are always streamed.
+	isCarSource := false
+	if sourceURL.Type == fileSystem {
+		_, _, isCarSource = splitCarPath(sourceURL.Path)
+	}
+	if sourceAlias == targetAlias && !isCarSource {
 		// preserve new metadata and save existing ones.
 		if preserve {
 			currentMetadata, err := getAllMetadata(ctx, sourceAlias, sourceURL.String(), srcSSE, urls)
@@ -587,7 +592,10 @@ func newClientFromAlias(alias, urlStr string) (Client, *probe.Error) {
 
 	if hostCfg == nil {
 		// No matching host config. So we treat it like a
-		// filesystem.
+		// filesystem, or a CAR archive on it.
+		if carClnt := carNew(urlStr); carClnt != nil {
+			return carClnt, nil
+		}
 		fsClient, fsErr := fsNew(urlStr)
 		if fsErr != nil {
 			return nil, fsErr.Trace(alias, urlStr)
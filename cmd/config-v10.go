@@ -27,7 +27,6 @@ import (
 const (
 	defaultAccessKey = "YOUR-ACCESS-KEY-HERE"
 	defaultSecretKey = "YOUR-SECRET-KEY-HERE"
-	defaultVolumeAddress = "~/minio-data"
 )
 
 var (
@@ -47,10 +46,38 @@ type aliasConfigV10 struct {
 	Path         string `json:"path"`
 }
 
+// lotusConfigV10 Lotus full node API used for deal making.
+type lotusConfigV10 struct {
+	API   string `json:"api"`
+	Token string `json:"token,omitempty"`
+}
+
+// swanConfigV10 Swan API used to list miners and create tasks. Timeout and
+// cache TTL are durations like "5s" or "10m", a cache TTL of "0s" disables
+// the cache.
+type swanConfigV10 struct {
+	API      string `json:"api"`
+	Token    string `json:"token,omitempty"`
+	Timeout  string `json:"timeout,omitempty"`
+	CacheTTL string `json:"cacheTTL,omitempty"`
+}
+
+// networkConfigV10 chain parameters of a Filecoin network. Times are in
+// seconds, default deal start and duration in days.
+type networkConfigV10 struct {
+	GenesisTime     int64 `json:"genesisTime"`
+	BlockTime       int64 `json:"blockTime"`
+	DefaultStart    uint  `json:"defaultStart,omitempty"`
+	DefaultDuration uint  `json:"defaultDuration,omitempty"`
+}
+
 // configV10 config version.
 type configV10 struct {
-	Version string                    `json:"version"`
-	Aliases map[string]aliasConfigV10 `json:"aliases"`
+	Version  string                      `json:"version"`
+	Aliases  map[string]aliasConfigV10   `json:"aliases"`
+	Lotus    *lotusConfigV10             `json:"lotus,omitempty"`
+	Networks map[string]networkConfigV10 `json:"networks,omitempty"`
+	Swan     *swanConfigV10              `json:"swan,omitempty"`
 }
 
 // newConfigV10 - new config version.
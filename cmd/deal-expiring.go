@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+	"maze.io/x/duration"
+)
+
+var dealExpiringFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "within",
+		Value: "30d",
+		Usage: "report the deals ending within this duration, such as 30d or 12h, default: 30d",
+	},
+	cli.StringFlag{
+		Name:   "network",
+		EnvVar: networkEnv,
+		Value:  defaultNetwork,
+		Usage:  "specify the network profile used to compute epochs, mainnet, calibnet or one of the config file",
+	},
+}
+
+var dealExpiringCmd = cli.Command{
+	Name:         "expiring",
+	Usage:        "list the storage deals approaching their end epoch",
+	Action:       mainDealExpiring,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(dealExpiringFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] [CSV-FILE...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Report the active and published deals which end within --within of the chain head,
+  from dealMetadata CSVs written by 'send', or from all the deals of the lotus node
+  when no CSV is given. Renew them with 'deal renew'.
+
+EXAMPLES:
+  1. List the deals of the lotus node ending within 30 days.
+     {{.Prompt}} {{.HelpName}}
+
+  2. List the deals of a batch ending within 60 days, in JSON format.
+     {{.Prompt}} {{.HelpName}} --json --within 60d /data/car/dealMetadata-5a3c8f21.csv
+`,
+}
+
+// dealExpiringMessage container for expiring deal messages.
+type dealExpiringMessage struct {
+	Status   string    `json:"status"`
+	DealCid  string    `json:"dealCid"`
+	DataCid  string    `json:"dataCid,omitempty"`
+	PieceCid string    `json:"pieceCid,omitempty"`
+	Miner    string    `json:"miner"`
+	DealID   uint64    `json:"dealId"`
+	State    string    `json:"state"`
+	EndEpoch int64     `json:"endEpoch"`
+	EndTime  time.Time `json:"endTime"`
+	CsvFile  string    `json:"csvFile,omitempty"`
+}
+
+func formatDealExpiringRow(dealCid, miner, dealID, endEpoch, endTime, remaining string) string {
+	return fmt.Sprintf("%*s %*s %*s %*s %*s %s",
+		-64, dealCid,
+		-10, miner,
+		-10, dealID,
+		-10, endEpoch,
+		-24, endTime,
+		remaining)
+}
+
+// JSON jsonified expiring deal message.
+func (d dealExpiringMessage) JSON() string {
+	dealJSONBytes, e := json.MarshalIndent(d, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(dealJSONBytes)
+}
+
+// String colorized expiring deal message.
+func (d dealExpiringMessage) String() string {
+	remaining := timeDurationToHumanizedDuration(time.Until(d.EndTime)).StringShort()
+	return formatDealExpiringRow(d.DealCid, d.Miner, strconv.FormatUint(d.DealID, 10),
+		strconv.FormatInt(d.EndEpoch, 10), d.EndTime.UTC().Format(printDate), remaining)
+}
+
+// parseWithin returns the number of epochs of a duration such as 30d.
+func parseWithin(network networkConfigV10, within string) (int64, *probe.Error) {
+	d, e := duration.ParseDuration(within)
+	if e != nil {
+		return 0, probe.NewError(e).Trace(within)
+	}
+	if d <= 0 {
+		return 0, errInvalidArgument().Trace(within)
+	}
+	return int64(time.Duration(d).Seconds()) / network.BlockTime, nil
+}
+
+// isDealExpiring returns true if a live deal ends within the given number of
+// epochs of the chain height.
+func isDealExpiring(msg dealStatusMessage, height, withinEpochs int64) bool {
+	if msg.State != dealStateActive && msg.State != dealStatePublished {
+		return false
+	}
+	return msg.EndEpoch > height && msg.EndEpoch-height <= withinEpochs
+}
+
+// lotusDealStatuses looks up the state of all the deals of the lotus node.
+func lotusDealStatuses(ctx context.Context, api *lotusClient, height int64) ([]dealStatusMessage, *probe.Error) {
+	infos, err := api.ClientListDeals(ctx)
+	if err != nil {
+		return nil, err.Trace()
+	}
+	var msgs []dealStatusMessage
+	for i := range infos {
+		info := &infos[i]
+		if info.DealID == 0 {
+			// Never published, it has no end epoch.
+			continue
+		}
+		msg := dealStatusMessage{
+			Status:  "success",
+			DealCid: info.ProposalCid.Root,
+			State:   dealStateUnknown,
+		}
+		if info.DataRef != nil {
+			msg.DataCid = info.DataRef.Root.Root
+		}
+		msgs = append(msgs, dealStatusFromInfo(ctx, api, height, msg, info))
+	}
+	return msgs, nil
+}
+
+// newDealExpiringMessage returns the expiring deal message of a deal status.
+func newDealExpiringMessage(network networkConfigV10, msg dealStatusMessage, csvFile string) dealExpiringMessage {
+	return dealExpiringMessage{
+		Status:   "success",
+		DealCid:  msg.DealCid,
+		DataCid:  msg.DataCid,
+		PieceCid: msg.PieceCid,
+		Miner:    msg.Miner,
+		DealID:   msg.DealID,
+		State:    msg.State,
+		EndEpoch: msg.EndEpoch,
+		EndTime:  network.timeAt(msg.EndEpoch),
+		CsvFile:  csvFile,
+	}
+}
+
+// mainDealExpiring is the handle for "mc deal expiring" command.
+func mainDealExpiring(cliCtx *cli.Context) error {
+	ctx, cancelExpiring := context.WithCancel(globalContext)
+	defer cancelExpiring()
+
+	for _, arg := range cliCtx.Args() {
+		if _, e := os.Stat(strings.TrimSpace(arg)); e != nil {
+			fatalIf(probe.NewError(e).Trace(arg), "Unable to find the deal csv `"+arg+"`.")
+		}
+	}
+
+	network, err := loadNetwork(cliCtx.String("network"))
+	fatalIf(err, "Unable to load the network profile.")
+	withinEpochs, err := parseWithin(network, cliCtx.String("within"))
+	fatalIf(err, "Please provide a valid duration, such as 30d.")
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+	head, err := api.ChainHead(ctx)
+	fatalIf(err, "Unable to get chain head.")
+
+	var expiring []dealExpiringMessage
+	if len(cliCtx.Args()) == 0 {
+		msgs, err := lotusDealStatuses(ctx, api, head.Height)
+		fatalIf(err, "Unable to list the deals of lotus.")
+		for _, msg := range msgs {
+			if isDealExpiring(msg, head.Height, withinEpochs) {
+				expiring = append(expiring, newDealExpiringMessage(network, msg, ""))
+			}
+		}
+	}
+	for _, arg := range cliCtx.Args() {
+		csvFile := strings.TrimSpace(arg)
+		deals, err := readDealCsv(csvFile)
+		fatalIf(err, "Unable to read deals from `"+csvFile+"`.")
+		for _, deal := range deals {
+			if deal.DealCid == "" {
+				continue
+			}
+			msg := getDealStatus(ctx, api, head.Height, deal)
+			if msg.Status != "success" {
+				errorIf(probe.NewError(errors.New(msg.Message)).Trace(deal.DealCid), "Unable to get the state of deal `"+deal.DealCid+"`.")
+				continue
+			}
+			if isDealExpiring(msg, head.Height, withinEpochs) {
+				expiring = append(expiring, newDealExpiringMessage(network, msg, csvFile))
+			}
+		}
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].EndEpoch < expiring[j].EndEpoch
+	})
+	if !globalJSON && len(expiring) > 0 {
+		console.Println(formatDealExpiringRow("Deal CID", "Miner", "Deal ID", "End Epoch", "End Time", "Remaining"))
+	}
+	for _, msg := range expiring {
+		printMsg(msg)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseWithin(t *testing.T) {
+	network := networkConfigV10{BlockTime: 30}
+	testCases := []struct {
+		within   string
+		epochs   int64
+		hasError bool
+	}{
+		{"30d", 86400, false},
+		{"1h", 120, false},
+		{"0d", 0, true},
+		{"soon", 0, true},
+	}
+	for i, testCase := range testCases {
+		epochs, err := parseWithin(network, testCase.within)
+		if testCase.hasError {
+			if err == nil {
+				t.Errorf("Test %d: expected %s to be rejected", i+1, testCase.within)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if epochs != testCase.epochs {
+			t.Errorf("Test %d: expected %d epochs, got %d", i+1, testCase.epochs, epochs)
+		}
+	}
+}
+
+func TestIsDealExpiring(t *testing.T) {
+	testCases := []struct {
+		state    string
+		endEpoch int64
+		expiring bool
+	}{
+		{dealStateActive, 1500, true},
+		{dealStatePublished, 1100, true},
+		{dealStateActive, 1600, false},
+		{dealStateActive, 1000, false},
+		{dealStateSlashed, 1500, false},
+		{dealStateProposed, 0, false},
+	}
+	for i, testCase := range testCases {
+		msg := dealStatusMessage{State: testCase.state, EndEpoch: testCase.endEpoch}
+		if expiring := isDealExpiring(msg, 1000, 500); expiring != testCase.expiring {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.expiring, expiring)
+		}
+	}
+}
+
+func TestLotusDealStatuses(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientListDeals": []map[string]interface{}{
+			{
+				"ProposalCid": map[string]string{"/": "bafyreideal"},
+				"State":       storageDealActive,
+				"Provider":    "f01234",
+				"DataRef":     map[string]interface{}{"Root": map[string]string{"/": "bafybeidata"}},
+				"DealID":      42,
+			},
+			{
+				"ProposalCid": map[string]string{"/": "bafyreiproposed"},
+				"State":       17,
+				"Provider":    "f01234",
+			},
+		},
+		"Filecoin.StateMarketStorageDeal": map[string]interface{}{
+			"Proposal": map[string]interface{}{"StartEpoch": 1000, "EndEpoch": 2000},
+			"State":    map[string]interface{}{"SectorStartEpoch": 1100, "SlashEpoch": -1},
+		},
+	})
+	defer server.Close()
+
+	msgs, err := lotusDealStatuses(context.Background(), newLotusClient(server.URL, ""), 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 published deal, got %d", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.DealCid != "bafyreideal" || msg.DataCid != "bafybeidata" || msg.State != dealStateActive || msg.EndEpoch != 2000 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import "github.com/minio/cli"
+
+var dealCmdSubcommands = []cli.Command{
+	dealStatusCmd,
+	dealExpiringCmd,
+	dealRenewCmd,
+}
+
+var dealCmd = cli.Command{
+	Name:            "deal",
+	Usage:           "manage filecoin storage deals",
+	Action:          mainDeal,
+	Before:          setGlobalsFromContext,
+	Flags:           globalFlags,
+	HideHelpCommand: true,
+	Subcommands:     dealCmdSubcommands,
+}
+
+// mainDeal is the handle for "mc deal" command.
+func mainDeal(ctx *cli.Context) error {
+	commandNotFound(ctx, dealCmdSubcommands)
+	return nil
+}
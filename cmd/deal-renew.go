@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+)
+
+var dealRenewFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "from",
+		EnvVar: "FIL_WALLET",
+		Usage:  "specify filecoin wallet to use, default $FIL_WALLET",
+	},
+	cli.StringFlag{
+		Name:  "within",
+		Value: "30d",
+		Usage: "renew the deals ending within this duration, such as 30d or 12h, default: 30d",
+	},
+	cli.StringFlag{
+		Name:  "miner",
+		Usage: "specify the miner of the new deals, default: the miner of the expiring deal",
+	},
+	cli.StringFlag{
+		Name:  "price",
+		Value: "0",
+		Usage: "specify the deal price for each GiB of file in FIL, or with a unit like '500 nanoFIL', default: 0",
+	},
+	cli.UintFlag{
+		Name:  "start",
+		Value: uint(defaultStart),
+		Usage: "specify days for miner to process the file, default: 7 or the default of the network",
+	},
+	cli.UintFlag{
+		Name:  "duration",
+		Value: uint(defaultDuration),
+		Usage: "specify length in day to store the file, default: 360 or the default of the network",
+	},
+	cli.StringFlag{
+		Name:   "network",
+		EnvVar: networkEnv,
+		Value:  defaultNetwork,
+		Usage:  "specify the network profile used to compute epochs, mainnet, calibnet or one of the config file",
+	},
+	cli.BoolFlag{
+		Name:  "verified",
+		Usage: "propose verified deals",
+	},
+	cli.IntFlag{
+		Name:  "max-retries",
+		Value: 3,
+		Usage: "specify how many times to retry a failed proposal with an exponential backoff, default: 3",
+	},
+	cli.DurationFlag{
+		Name:  "miner-interval",
+		Value: time.Second,
+		Usage: "specify the minimum time between two deals proposed to the same miner, default: 1s",
+	},
+}
+
+var dealRenewCmd = cli.Command{
+	Name:         "renew",
+	Usage:        "propose new deals for the storage deals approaching their end epoch",
+	Action:       mainDealRenew,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(dealRenewFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CSV-FILE
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Re-propose the piece of every deal of a dealMetadata CSV written by 'send' which ends
+  within --within of the chain head, to the same miner or to --miner, with a new start
+  epoch. The CAR URL of the expiring deal is reused, it must still be reachable by the
+  miner. The new deals are appended to the CSV, so that running the command again does
+  not renew a deal twice.
+
+EXAMPLES:
+  1. Renew the deals of a batch ending within 30 days with the same miners.
+     {{.Prompt}} {{.HelpName}} --from f3rv...xyz /data/car/dealMetadata-5a3c8f21.csv
+
+  2. Move the deals of a batch ending within 60 days to another miner.
+     {{.Prompt}} {{.HelpName}} --from f3rv...xyz --within 60d --miner f01276 --price 0.0000005 /data/car/dealMetadata-5a3c8f21.csv
+`,
+}
+
+// dealRenewMessage container for deal renewal messages.
+type dealRenewMessage struct {
+	Status     string `json:"status"`
+	DataCid    string `json:"dataCid"`
+	Miner      string `json:"miner"`
+	DealCid    string `json:"dealCid"`
+	Renews     string `json:"renews"`
+	StartEpoch string `json:"startEpoch"`
+}
+
+// JSON jsonified deal renewal message.
+func (d dealRenewMessage) JSON() string {
+	dealJSONBytes, e := json.MarshalIndent(d, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(dealJSONBytes)
+}
+
+// String colorized deal renewal message.
+func (d dealRenewMessage) String() string {
+	return fmt.Sprintf("DataCid: %s, Miner: %s, DealCid: %s, Renews: %s", d.DataCid, d.Miner, d.DealCid, d.Renews)
+}
+
+// renewKey identifies the deals of a piece with a miner.
+func renewKey(dataCid, miner string) string {
+	return dataCid + "/" + miner
+}
+
+// renewedDeal returns the new deal of an expiring deal, with the given miner
+// or the one of the expiring deal.
+func renewedDeal(expiring *OfflineDeal, miner string) OfflineDeal {
+	deal := *expiring
+	if miner != "" {
+		deal.MinerId = miner
+	}
+	// The new deal is not part of the swan task of the expiring one.
+	deal.DealCid = ""
+	deal.TaskId = ""
+	return deal
+}
+
+// isRenewed tells whether the csv already has a deal of the piece of an
+// expiring deal with the miner starting after it, whatever its state: a
+// renewal failing its status lookup must not be proposed again.
+func isRenewed(deals []*OfflineDeal, expiring *OfflineDeal, miner string) bool {
+	start, _ := strconv.ParseUint(expiring.StartEpoch, 10, 64)
+	for _, deal := range deals {
+		if deal.DataCid != expiring.DataCid || deal.MinerId != miner {
+			continue
+		}
+		if dealStart, e := strconv.ParseUint(deal.StartEpoch, 10, 64); e == nil && dealStart > start {
+			return true
+		}
+	}
+	return false
+}
+
+func checkDealRenewArgs(ctx *cli.Context) (string, string) {
+	args := ctx.Args()
+	if len(args) != 1 {
+		cli.ShowCommandHelpAndExit(ctx, "renew", globalErrorExitStatus)
+	}
+	csvPath := strings.TrimSpace(args[0])
+	if _, e := os.Stat(csvPath); e != nil {
+		fatalIf(probe.NewError(e).Trace(csvPath), "Unable to find the deal csv `"+csvPath+"`.")
+	}
+	wallet := strings.TrimSpace(ctx.String("from"))
+	if wallet == "" {
+		fatalIf(errInvalidArgument().Trace(wallet), "please provide a valid wallet")
+	}
+	if ctx.Uint("start") == 0 {
+		fatalIf(errInvalidArgument(), "please provide a valid length of start time in day")
+	}
+	if ctx.Uint("duration") == 0 {
+		fatalIf(errInvalidArgument(), "please provide a valid length of duration in day")
+	}
+	if ctx.Int("max-retries") < 0 {
+		fatalIf(errInvalidArgument().Trace(ctx.String("max-retries")), "please provide a valid number of retries")
+	}
+	return csvPath, wallet
+}
+
+// mainDealRenew is the handle for "mc deal renew" command.
+func mainDealRenew(cliCtx *cli.Context) error {
+	csvPath, wallet := checkDealRenewArgs(cliCtx)
+	ctx, cancelRenew := context.WithCancel(globalContext)
+	defer cancelRenew()
+
+	price, err := parseFIL(cliCtx.String("price"))
+	if err != nil || price.Sign() < 0 {
+		fatalIf(errInvalidArgument().Trace(cliCtx.String("price")), "please provide a valid price")
+	}
+	network, err := loadNetwork(cliCtx.String("network"))
+	fatalIf(err, "Unable to load the network profile.")
+	withinEpochs, err := parseWithin(network, cliCtx.String("within"))
+	fatalIf(err, "Please provide a valid duration, such as 30d.")
+	start, duration := cliCtx.Uint("start"), cliCtx.Uint("duration")
+	if !cliCtx.IsSet("start") && network.DefaultStart > 0 {
+		start = network.DefaultStart
+	}
+	if !cliCtx.IsSet("duration") && network.DefaultDuration > 0 {
+		duration = network.DefaultDuration
+	}
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+	head, err := api.ChainHead(ctx)
+	fatalIf(err, "Unable to get chain head.")
+
+	deals, err := readDealCsv(csvPath)
+	fatalIf(err, "Unable to read deals from `"+csvPath+"`.")
+
+	// A piece is renewed with a miner unless the csv already has a deal of
+	// the piece with the miner which is not about to end, or which starts
+	// after the expiring one.
+	var expiring []*OfflineDeal
+	live := make(map[string]bool)
+	for _, deal := range deals {
+		if deal.DealCid == "" {
+			continue
+		}
+		msg := getDealStatus(ctx, api, head.Height, deal)
+		switch {
+		case isDealExpiring(msg, head.Height, withinEpochs):
+			expiring = append(expiring, deal)
+		case msg.State == dealStateProposed, msg.State == dealStatePublished, msg.State == dealStateActive:
+			live[renewKey(deal.DataCid, deal.MinerId)] = true
+		}
+	}
+
+	miner := strings.TrimSpace(cliCtx.String("miner"))
+	preflight := newDealPreflight(network, api)
+	limiter := newMinerRateLimiter(cliCtx.Duration("miner-interval"))
+	failed := false
+	for _, expiringDeal := range expiring {
+		deal := renewedDeal(expiringDeal, miner)
+		key := renewKey(deal.DataCid, deal.MinerId)
+		if live[key] || isRenewed(deals, expiringDeal, deal.MinerId) {
+			continue
+		}
+
+		epochPrice, err := calculateCost(price, deal.PieceSize)
+		if err != nil {
+			errorIf(err.Trace(deal.DataCid), "Unable to compute the price of `"+deal.DataCid+"`.")
+			failed = true
+			continue
+		}
+		deal.SenderWallet = wallet
+		deal.VerifiedDeal = cliCtx.Bool("verified")
+		deal.StartEpoch = strconv.FormatUint(uint64(calculateStartEpoch(network, start)), 10)
+		deal.Duration = strconv.FormatUint(uint64(calculateDuration(network, duration)), 10)
+		deal.Cost = formatFIL(epochPrice)
+
+		if violations := preflight.check(ctx, deal, MinerMessage{MinerID: deal.MinerId}); len(violations) > 0 {
+			errorIf(errInvalidArgument().Trace(deal.DataCid, deal.MinerId), "Unable to renew `"+deal.DataCid+"` with miner `"+deal.MinerId+"`: "+strings.Join(violations, ", ")+".")
+			failed = true
+			continue
+		}
+		if err = proposeOfflineDealWithRetry(ctx, api, limiter, &deal, cliCtx.Int("max-retries")); err != nil {
+			errorIf(err, "Unable to propose deal for `"+deal.DataCid+"` to miner `"+deal.MinerId+"`.")
+			failed = true
+			continue
+		}
+		writeCsv(csvPath, deal)
+		live[key] = true
+
+		printMsg(dealRenewMessage{
+			Status:     "success",
+			DataCid:    deal.DataCid,
+			Miner:      deal.MinerId,
+			DealCid:    deal.DealCid,
+			Renews:     expiringDeal.DealCid,
+			StartEpoch: deal.StartEpoch,
+		})
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
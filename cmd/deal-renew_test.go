@@ -0,0 +1,64 @@
+package cmd
+
+import "testing"
+
+func TestRenewedDeal(t *testing.T) {
+	expiring := &OfflineDeal{
+		DataCid:   "bafybeidata",
+		PieceCid:  "baga6ea4seaqpiece",
+		PieceSize: "34091302912",
+		DealCid:   "bafyreideal",
+		MinerId:   "f01234",
+		CarUrl:    "https://fs3.example.com/swan/bafybeidata.car",
+		TaskId:    "42",
+	}
+	testCases := []struct {
+		miner    string
+		expected string
+	}{
+		{"", "f01234"},
+		{"f01276", "f01276"},
+	}
+	for i, testCase := range testCases {
+		deal := renewedDeal(expiring, testCase.miner)
+		if deal.MinerId != testCase.expected {
+			t.Errorf("Test %d: expected miner %s, got %s", i+1, testCase.expected, deal.MinerId)
+		}
+		if deal.DealCid != "" || deal.TaskId != "" {
+			t.Errorf("Test %d: expected a new deal, got %+v", i+1, deal)
+		}
+		if deal.PieceCid != expiring.PieceCid || deal.DataCid != expiring.DataCid || deal.CarUrl != expiring.CarUrl {
+			t.Errorf("Test %d: expected the piece of the expiring deal, got %+v", i+1, deal)
+		}
+	}
+	if expiring.DealCid != "bafyreideal" {
+		t.Errorf("expiring deal was modified: %+v", expiring)
+	}
+}
+
+func TestIsRenewed(t *testing.T) {
+	expiring := &OfflineDeal{DataCid: "bafybeidata", MinerId: "f01234", StartEpoch: "1000", DealCid: "bafyreideal"}
+	deals := []*OfflineDeal{
+		expiring,
+		{DataCid: "bafybeidata", MinerId: "f01276", StartEpoch: "900", DealCid: "bafyreiold"},
+		{DataCid: "bafybeidata", MinerId: "f01234", StartEpoch: "5000", DealCid: "bafyreinew"},
+		{DataCid: "bafybeiother", MinerId: "f01300", StartEpoch: "5000", DealCid: "bafyreiother"},
+	}
+	testCases := []struct {
+		miner    string
+		expected bool
+	}{
+		// A renewal of the same miner, whatever its state.
+		{"f01234", true},
+		// An older deal with the miner is no renewal.
+		{"f01276", false},
+		// A later deal of another piece is no renewal.
+		{"f01300", false},
+		{"f01400", false},
+	}
+	for i, testCase := range testCases {
+		if renewed := isRenewed(deals, expiring, testCase.miner); renewed != testCase.expected {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.expected, renewed)
+		}
+	}
+}
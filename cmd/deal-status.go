@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+)
+
+var dealStatusFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "watch, w",
+		Usage: "keep polling until every deal is active, failed, slashed or expired",
+	},
+	cli.DurationFlag{
+		Name:  "interval",
+		Value: 5 * time.Minute,
+		Usage: "polling interval in watch mode",
+	},
+}
+
+var dealStatusCmd = cli.Command{
+	Name:         "status",
+	Usage:        "show the state of storage deals",
+	Action:       mainDealStatus,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(dealStatusFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CSV-FILE | DEAL-CID [CSV-FILE | DEAL-CID...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Look up the state of deals listed in a dealMetadata CSV written by 'send', or of
+  single deal CIDs, through the lotus API. A deal is reported as proposed, published,
+  active, slashed, expired or failed. In watch mode a deal whose lookup fails 3 times
+  in a row is no longer polled.
+
+EXAMPLES:
+  1. Show the state of all deals of a batch.
+     {{.Prompt}} {{.HelpName}} /data/car/dealMetadata-5a3c8f21.csv
+
+  2. Show the state of a single deal in JSON format.
+     {{.Prompt}} {{.HelpName}} --json bafyreihg4rxzbxeo3xezfxpsgjpcgrdqv5c7nxhmmfmtdlgqxdabd6fanu
+
+  3. Poll every 10 minutes until all deals of a batch are terminal.
+     {{.Prompt}} {{.HelpName}} --watch --interval 10m /data/car/dealMetadata-5a3c8f21.csv
+`,
+}
+
+// Storage deal states as reported by ClientGetDealInfo.
+const (
+	storageDealProposalNotFound = 1
+	storageDealProposalRejected = 2
+	storageDealActive           = 7
+	storageDealExpired          = 8
+	storageDealSlashed          = 9
+	storageDealFailing          = 11
+	storageDealError            = 26
+)
+
+// storageDealStates names the storage deal states of go-fil-markets.
+var storageDealStates = []string{
+	"StorageDealUnknown",
+	"StorageDealProposalNotFound",
+	"StorageDealProposalRejected",
+	"StorageDealProposalAccepted",
+	"StorageDealStaged",
+	"StorageDealSealing",
+	"StorageDealFinalizing",
+	"StorageDealActive",
+	"StorageDealExpired",
+	"StorageDealSlashed",
+	"StorageDealRejecting",
+	"StorageDealFailing",
+	"StorageDealFundsReserved",
+	"StorageDealCheckForAcceptance",
+	"StorageDealValidating",
+	"StorageDealAcceptWait",
+	"StorageDealStartDataTransfer",
+	"StorageDealTransferring",
+	"StorageDealWaitingForData",
+	"StorageDealVerifyData",
+	"StorageDealReserveProviderFunds",
+	"StorageDealReserveClientFunds",
+	"StorageDealProviderFunding",
+	"StorageDealClientFunding",
+	"StorageDealPublish",
+	"StorageDealPublishing",
+	"StorageDealError",
+	"StorageDealProviderTransferAwaitRestart",
+	"StorageDealClientTransferRestart",
+	"StorageDealAwaitingPreCommit",
+}
+
+// Deal states reported by `mc deal status`.
+const (
+	dealStateProposed  = "proposed"
+	dealStatePublished = "published"
+	dealStateActive    = "active"
+	dealStateSlashed   = "slashed"
+	dealStateExpired   = "expired"
+	dealStateFailed    = "failed"
+	dealStateUnknown   = "unknown"
+)
+
+// dealStatusMessage container for deal status messages.
+type dealStatusMessage struct {
+	Status     string `json:"status"`
+	DealCid    string `json:"dealCid"`
+	DataCid    string `json:"dataCid,omitempty"`
+	PieceCid   string `json:"pieceCid,omitempty"`
+	Miner      string `json:"miner,omitempty"`
+	DealID     uint64 `json:"dealId,omitempty"`
+	State      string `json:"state"`
+	DealState  string `json:"dealState,omitempty"`
+	StartEpoch int64  `json:"startEpoch,omitempty"`
+	EndEpoch   int64  `json:"endEpoch,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func formatDealStatusRow(dealCid, miner, dealID, state, endEpoch, dealState string) string {
+	return fmt.Sprintf("%*s %*s %*s %*s %*s %s",
+		-64, dealCid,
+		-10, miner,
+		-10, dealID,
+		-10, state,
+		-10, endEpoch,
+		dealState)
+}
+
+// JSON jsonified deal status message.
+func (d dealStatusMessage) JSON() string {
+	dealJSONBytes, e := json.MarshalIndent(d, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(dealJSONBytes)
+}
+
+// String colorized deal status message.
+func (d dealStatusMessage) String() string {
+	dealID, endEpoch := "", ""
+	if d.DealID != 0 {
+		dealID = strconv.FormatUint(d.DealID, 10)
+	}
+	if d.EndEpoch != 0 {
+		endEpoch = strconv.FormatInt(d.EndEpoch, 10)
+	}
+	dealState := d.DealState
+	if d.Message != "" {
+		dealState = strings.TrimSpace(dealState + " " + d.Message)
+	}
+	return formatDealStatusRow(d.DealCid, d.Miner, dealID, d.State, endEpoch, dealState)
+}
+
+// isDealStateTerminal returns true if the deal state will not change
+// without further action.
+func isDealStateTerminal(state string) bool {
+	switch state {
+	case dealStateActive, dealStateSlashed, dealStateExpired, dealStateFailed:
+		return true
+	}
+	return false
+}
+
+// maxDealLookupErrors is the number of consecutive failed lookups after
+// which a deal is no longer polled in watch mode.
+const maxDealLookupErrors = 3
+
+// isDealStatusFinal returns true if a deal needs no further polling, when
+// its state is terminal or its lookup failed too many times in a row.
+func isDealStatusFinal(state string, lookupErrors int) bool {
+	return isDealStateTerminal(state) || lookupErrors >= maxDealLookupErrors
+}
+
+// classifyDeal derives the deal state from the client deal info and, for
+// published deals, the on-chain market deal at the given chain height.
+func classifyDeal(info *lotusDealInfo, market *lotusMarketDeal, height int64) string {
+	if market != nil {
+		switch {
+		case market.State.SlashEpoch > -1:
+			return dealStateSlashed
+		case market.Proposal.EndEpoch <= height:
+			return dealStateExpired
+		case market.State.SectorStartEpoch > -1:
+			return dealStateActive
+		}
+	}
+	switch info.State {
+	case storageDealSlashed:
+		return dealStateSlashed
+	case storageDealExpired:
+		return dealStateExpired
+	case storageDealActive:
+		return dealStateActive
+	case storageDealProposalNotFound, storageDealProposalRejected, storageDealFailing, storageDealError:
+		return dealStateFailed
+	}
+	if info.DealID != 0 {
+		return dealStatePublished
+	}
+	return dealStateProposed
+}
+
+// getDealStatus looks up the state of a deal on the lotus node.
+func getDealStatus(ctx context.Context, api *lotusClient, height int64, deal *OfflineDeal) dealStatusMessage {
+	msg := dealStatusMessage{
+		Status:   "success",
+		DealCid:  deal.DealCid,
+		DataCid:  deal.DataCid,
+		PieceCid: deal.PieceCid,
+		Miner:    deal.MinerId,
+		State:    dealStateUnknown,
+	}
+	if deal.DealCid == "" {
+		msg.State = dealStateFailed
+		msg.Message = "no deal CID recorded"
+		return msg
+	}
+
+	info, err := api.ClientGetDealInfo(ctx, deal.DealCid)
+	if err != nil {
+		msg.Status = "error"
+		msg.Message = err.ToGoError().Error()
+		return msg
+	}
+	return dealStatusFromInfo(ctx, api, height, msg, info)
+}
+
+// dealStatusFromInfo completes a deal status message from the client deal
+// info and the on-chain market deal.
+func dealStatusFromInfo(ctx context.Context, api *lotusClient, height int64, msg dealStatusMessage, info *lotusDealInfo) dealStatusMessage {
+	if info.State < uint64(len(storageDealStates)) {
+		msg.DealState = storageDealStates[info.State]
+	}
+	if msg.Miner == "" {
+		msg.Miner = info.Provider
+	}
+	if msg.PieceCid == "" {
+		msg.PieceCid = info.PieceCID.String()
+	}
+	msg.DealID = info.DealID
+	if info.Message != "" {
+		msg.Message = info.Message
+	}
+
+	var market *lotusMarketDeal
+	if info.DealID != 0 {
+		var err *probe.Error
+		market, err = api.StateMarketStorageDeal(ctx, info.DealID)
+		if err != nil {
+			// Deals are removed from the market actor once they expire
+			// or get slashed, fall back to the client state.
+			market = nil
+		} else {
+			msg.StartEpoch = market.Proposal.StartEpoch
+			msg.EndEpoch = market.Proposal.EndEpoch
+		}
+	}
+	msg.State = classifyDeal(info, market, height)
+	return msg
+}
+
+// dealStatusArg reads the deals to look up from an argument, a dealMetadata
+// CSV file or a deal CID.
+func dealStatusArg(arg string) ([]*OfflineDeal, *probe.Error) {
+	if strings.HasSuffix(strings.ToLower(arg), ".csv") || strings.ContainsRune(arg, os.PathSeparator) {
+		if _, e := os.Stat(arg); e != nil {
+			return nil, probe.NewError(e)
+		}
+		return readDealCsv(arg)
+	}
+	if _, e := cid.Decode(arg); e != nil {
+		return nil, probe.NewError(fmt.Errorf("%s is neither a CSV file nor a deal CID: %v", arg, e))
+	}
+	deal := NewOfflineDeal()
+	deal.DealCid = arg
+	return []*OfflineDeal{deal}, nil
+}
+
+// parseDealStatusArgs reads the deals to look up from CSV files and deal CIDs.
+func parseDealStatusArgs(ctx *cli.Context) []*OfflineDeal {
+	if len(ctx.Args()) == 0 {
+		cli.ShowCommandHelpAndExit(ctx, "status", globalErrorExitStatus)
+	}
+
+	var deals []*OfflineDeal
+	for _, arg := range ctx.Args() {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			fatalIf(errInvalidArgument().Trace(ctx.Args()...), "Unable to validate empty argument.")
+		}
+		argDeals, err := dealStatusArg(arg)
+		fatalIf(err.Trace(arg), "Unable to read deals from `"+arg+"`.")
+		deals = append(deals, argDeals...)
+	}
+	return deals
+}
+
+// mainDealStatus is the handle for "mc deal status" command.
+func mainDealStatus(cliCtx *cli.Context) error {
+	ctx, cancelStatus := context.WithCancel(globalContext)
+	defer cancelStatus()
+
+	deals := parseDealStatusArgs(cliCtx)
+	watch := cliCtx.Bool("watch")
+	interval := cliCtx.Duration("interval")
+	if watch && interval <= 0 {
+		fatalIf(errInvalidArgument().Trace(interval.String()), "Please provide a positive polling interval.")
+	}
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	if !globalJSON {
+		console.Println(formatDealStatusRow("Deal CID", "Miner", "Deal ID", "State", "End Epoch", "Deal State"))
+	}
+
+	lastState := make(map[int]string)
+	lookupErrors := make(map[int]int)
+	for {
+		head, err := api.ChainHead(ctx)
+		fatalIf(err, "Unable to get chain head.")
+
+		pending := 0
+		for i, deal := range deals {
+			if isDealStatusFinal(lastState[i], lookupErrors[i]) {
+				continue
+			}
+			msg := getDealStatus(ctx, api, head.Height, deal)
+			if msg.Status == "error" {
+				lookupErrors[i]++
+			} else {
+				lookupErrors[i] = 0
+			}
+			if msg.State != lastState[i] || msg.Status == "error" || !watch {
+				printMsg(msg)
+			}
+			lastState[i] = msg.State
+			if !isDealStatusFinal(msg.State, lookupErrors[i]) {
+				pending++
+			}
+		}
+		if !watch || pending == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+
+	// The deals whose last lookup failed are not known, with --watch after
+	// maxDealLookupErrors failures in a row.
+	for _, errs := range lookupErrors {
+		if errs > 0 {
+			return exitStatus(globalErrorExitStatus)
+		}
+	}
+	return nil
+}
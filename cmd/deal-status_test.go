@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/cli"
+)
+
+func TestGetDealStatus(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientGetDealInfo": map[string]interface{}{
+			"ProposalCid": map[string]string{"/": "bafyreideal"},
+			"State":       storageDealActive,
+			"Provider":    "f01234",
+			"DealID":      42,
+		},
+		"Filecoin.StateMarketStorageDeal": map[string]interface{}{
+			"Proposal": map[string]interface{}{"StartEpoch": 1000, "EndEpoch": 2000},
+			"State":    map[string]interface{}{"SectorStartEpoch": 1100, "SlashEpoch": -1},
+		},
+	})
+	defer server.Close()
+	api := newLotusClient(server.URL, "")
+
+	testCases := []struct {
+		dealCid string
+		height  int64
+		state   string
+	}{
+		{"bafyreideal", 1500, dealStateActive},
+		{"bafyreideal", 2000, dealStateExpired},
+		{"", 1500, dealStateFailed},
+	}
+	for i, testCase := range testCases {
+		deal := NewOfflineDeal()
+		deal.DealCid = testCase.dealCid
+		msg := getDealStatus(context.Background(), api, testCase.height, deal)
+		if msg.State != testCase.state {
+			t.Errorf("Test %d: expected state %s, got %s", i+1, testCase.state, msg.State)
+		}
+		if testCase.dealCid != "" && (msg.Miner != "f01234" || msg.DealID != 42 || msg.EndEpoch != 2000) {
+			t.Errorf("Test %d: unexpected message %+v", i+1, msg)
+		}
+	}
+}
+
+func TestClassifyDeal(t *testing.T) {
+	published := &lotusMarketDeal{}
+	published.Proposal.EndEpoch = 2000
+	published.State.SectorStartEpoch = -1
+	published.State.SlashEpoch = -1
+
+	slashed := &lotusMarketDeal{}
+	slashed.Proposal.EndEpoch = 2000
+	slashed.State.SectorStartEpoch = 1100
+	slashed.State.SlashEpoch = 1200
+
+	testCases := []struct {
+		info   lotusDealInfo
+		market *lotusMarketDeal
+		state  string
+	}{
+		{lotusDealInfo{State: 17}, nil, dealStateProposed},
+		{lotusDealInfo{State: 25, DealID: 7}, published, dealStatePublished},
+		{lotusDealInfo{State: storageDealActive, DealID: 7}, slashed, dealStateSlashed},
+		{lotusDealInfo{State: storageDealError}, nil, dealStateFailed},
+		{lotusDealInfo{State: storageDealExpired, DealID: 7}, nil, dealStateExpired},
+	}
+	for i, testCase := range testCases {
+		if state := classifyDeal(&testCase.info, testCase.market, 1500); state != testCase.state {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.state, state)
+		}
+	}
+}
+
+func TestDealStatusArg(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-deal-status")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	csvPath := filepath.Join(dir, "dealMetadata.csv")
+	deal := NewOfflineDeal()
+	deal.DealCid = "bafyreihg4rxzbxeo3xezfxpsgjpcgrdqv5c7nxhmmfmtdlgqxdabd6fanu"
+	writeCsv(csvPath, *deal)
+	writeCsv(csvPath, *deal)
+
+	testCases := []struct {
+		arg   string
+		deals int
+		fail  bool
+	}{
+		{csvPath, 2, false},
+		{"bafyreihg4rxzbxeo3xezfxpsgjpcgrdqv5c7nxhmmfmtdlgqxdabd6fanu", 1, false},
+		{filepath.Join(dir, "missing.csv"), 0, true},
+		{"dealMetadata-missing.csv", 0, true},
+		{"not-a-cid", 0, true},
+	}
+	for i, testCase := range testCases {
+		deals, err := dealStatusArg(testCase.arg)
+		if testCase.fail != (err != nil) {
+			t.Errorf("Test %d: expected failure %v, got %v", i+1, testCase.fail, err)
+		}
+		if len(deals) != testCase.deals {
+			t.Errorf("Test %d: expected %d deals, got %d", i+1, testCase.deals, len(deals))
+		}
+	}
+}
+
+func TestIsDealStatusFinal(t *testing.T) {
+	testCases := []struct {
+		state        string
+		lookupErrors int
+		final        bool
+	}{
+		{dealStateActive, 0, true},
+		{dealStatePublished, 0, false},
+		{dealStateUnknown, 1, false},
+		{dealStateUnknown, maxDealLookupErrors, true},
+	}
+	for i, testCase := range testCases {
+		if final := isDealStatusFinal(testCase.state, testCase.lookupErrors); final != testCase.final {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.final, final)
+		}
+	}
+}
+
+func TestMainDealStatusExitStatus(t *testing.T) {
+	const dealCid = "bafyreihg4rxzbxeo3xezfxpsgjpcgrdqv5c7nxhmmfmtdlgqxdabd6fanu"
+	const unknownCid = "bafyreidgw6z6rxxpaqa3kxmr5ltd6nyjjw3z42x5tkmgu4q5j5b55lnbnq"
+	server, handler := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ChainHead": map[string]interface{}{"Height": 1500},
+		"Filecoin.ClientGetDealInfo": func(params []json.RawMessage) interface{} {
+			if !strings.Contains(string(params[0]), dealCid) {
+				return &lotusRPCError{Code: 1, Message: "getting deal info: datastore: key not found"}
+			}
+			return map[string]interface{}{
+				"ProposalCid": map[string]string{"/": dealCid},
+				"State":       storageDealActive,
+				"Provider":    "f01234",
+			}
+		},
+	})
+	defer server.Close()
+
+	savedAPIInfo, savedJSON := os.Getenv(lotusAPIInfoEnv), globalJSON
+	os.Setenv(lotusAPIInfoEnv, server.URL)
+	globalJSON = true
+	defer func() {
+		os.Setenv(lotusAPIInfoEnv, savedAPIInfo)
+		globalJSON = savedJSON
+	}()
+
+	testCases := []struct {
+		args   []string
+		status int
+	}{
+		{[]string{dealCid}, 0},
+		{[]string{dealCid, unknownCid}, globalErrorExitStatus},
+		// The lookup is given up after failing maxDealLookupErrors times.
+		{[]string{"--watch", "--interval", "1ms", dealCid, unknownCid}, globalErrorExitStatus},
+	}
+	for i, testCase := range testCases {
+		flagSet := flag.NewFlagSet("status", flag.ContinueOnError)
+		flagSet.Bool("watch", false, "")
+		flagSet.Duration("interval", time.Minute, "")
+		if e := flagSet.Parse(testCase.args); e != nil {
+			t.Fatal(e)
+		}
+		status := 0
+		if e := mainDealStatus(cli.NewContext(cli.NewApp(), flagSet, nil)); e != nil {
+			exitErr, ok := e.(cli.ExitCoder)
+			if !ok {
+				t.Fatalf("Test %d: unexpected error %v", i+1, e)
+			}
+			status = exitErr.ExitCode()
+		}
+		if status != testCase.status {
+			t.Errorf("Test %d: expected exit status %d, got %d", i+1, testCase.status, status)
+		}
+	}
+	if _, ok := handler.params["Filecoin.ClientGetDealInfo"]; !ok {
+		t.Error("expected the deals to be looked up")
+	}
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+// Tags written on the source objects of a deal.
+const (
+	filDataCidTag  = "fil-data-cid"
+	filPieceCidTag = "fil-piece-cid"
+	filDealCidTag  = "fil-deal-cid"
+	filMinerTag    = "fil-miner"
+	filSlicesTag   = "fil-slices"
+	filDealCsvTag  = "fil-deal-csv"
+)
+
+// maxTagValueLength is the longest value of an object tag.
+const maxTagValueLength = 256
+
+// maxObjectTags is the most tags an object holds.
+const maxObjectTags = 10
+
+// objectTagOrder is the order in which the tags of mc are set when an object
+// has no room for all of them, the most useful first.
+var objectTagOrder = []string{
+	filDataCidTag,
+	filPieceCidTag,
+	filDealCidTag,
+	filMinerTag,
+	filUnixfsCidTag,
+	filUnixfsChunkTag,
+	filDealCsvTag,
+	filSlicesTag,
+}
+
+// graphsplitNode is the file tree of a slice, as written by graphsplit in the
+// detail column of its manifest.
+type graphsplitNode struct {
+	Name string
+	Hash string
+	Size uint64
+	Link []graphsplitNode
+}
+
+// graphsplitPartName matches the names graphsplit gives to the parts of a
+// file split over several slices: the name of the file followed by the
+// index of the part on 8 digits.
+var graphsplitPartName = regexp.MustCompile(`^(.+)\.([0-9]{8})$`)
+
+// graphsplitFileName returns the name of the file a name of a slice belongs
+// to, and the index of its part, -1 for a file which is not split.
+func graphsplitFileName(name string) (string, int) {
+	match := graphsplitPartName.FindStringSubmatch(name)
+	if match == nil {
+		return name, -1
+	}
+	part, _ := strconv.Atoi(match[2])
+	return match[1], part
+}
+
+// tagDealObject merges the deal tags into the tags of an object, tags with an
+// empty value are left out.
+func tagDealObject(ctx context.Context, objectURL string, dealTags map[string]string) *probe.Error {
+	clnt, err := newClient(objectURL)
+	if err != nil {
+		return err.Trace(objectURL)
+	}
+	return mergeObjectTags(ctx, clnt, "", dealTags).Trace(objectURL)
+}
+
+// mergeObjectTags merges tags into the tags of an object version, tags with
+// an empty value are left out. The existing tags are kept, and the new tags
+// which do not fit in maxObjectTags are left out in the reverse order of
+// objectTagOrder and reported in the returned error.
+func mergeObjectTags(ctx context.Context, clnt Client, versionID string, tags map[string]string) *probe.Error {
+	objectTags, err := clnt.GetTags(ctx, versionID)
+	if err != nil {
+		return err.Trace(versionID)
+	}
+
+	values := make(url.Values)
+	for key, value := range objectTags {
+		values.Set(key, value)
+	}
+	var keys []string
+	for key, value := range tags {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sortObjectTags(keys)
+	var dropped []string
+	for _, key := range keys {
+		if _, ok := values[key]; !ok && len(values) >= maxObjectTags {
+			dropped = append(dropped, key)
+			continue
+		}
+		values.Set(key, tags[key])
+	}
+	if err = clnt.SetTags(ctx, versionID, values.Encode()); err != nil {
+		return err.Trace(versionID)
+	}
+	if len(dropped) > 0 {
+		return errTooManyTags(dropped).Trace(versionID)
+	}
+	return nil
+}
+
+// sortObjectTags sorts tag keys in objectTagOrder, followed by the other keys
+// in alphabetical order.
+func sortObjectTags(keys []string) {
+	rank := func(key string) int {
+		for i, ordered := range objectTagOrder {
+			if key == ordered {
+				return i
+			}
+		}
+		return len(objectTagOrder)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rankI, rankJ := rank(keys[i]), rank(keys[j]); rankI != rankJ {
+			return rankI < rankJ
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// sliceFiles returns the paths of the files of a slice, relative to the
+// source the slice was generated from, the parts of split files are named
+// after their file. They come from the detail column of the manifest when
+// present, from the CAR file of the slice in carDir else.
+func sliceFiles(carDir string, deal *OfflineDeal) ([]string, *probe.Error) {
+	if deal.Detail != "" {
+		var root graphsplitNode
+		if e := json.Unmarshal([]byte(deal.Detail), &root); e != nil {
+			return nil, probe.NewError(e).Trace(deal.DataCid)
+		}
+		var files []string
+		var walk func(node graphsplitNode, name string)
+		walk = func(node graphsplitNode, name string) {
+			if len(node.Link) == 0 {
+				fileName, _ := graphsplitFileName(name)
+				files = append(files, fileName)
+				return
+			}
+			for _, link := range node.Link {
+				walk(link, path.Join(name, link.Name))
+			}
+		}
+		walk(root, "")
+		return files, nil
+	}
+
+	carPath := findSliceCar(carDir, deal)
+	if carPath == "" {
+		return nil, errInvalidArgument().Trace(filepath.Join(carDir, deal.DataCid+".car"))
+	}
+	index, err := loadCarIndex(carPath)
+	if err != nil {
+		return nil, err.Trace(carPath)
+	}
+	var files []string
+	for _, entry := range index.tree() {
+		if !entry.IsDir && entry.Path != "" {
+			fileName, _ := graphsplitFileName(entry.Path)
+			files = append(files, fileName)
+		}
+	}
+	return files, nil
+}
+
+// joinTagValue joins values with spaces into a tag value, the values which
+// do not fit in a tag are left out.
+func joinTagValue(values []string) string {
+	var joined string
+	for _, value := range values {
+		next := value
+		if joined != "" {
+			next = joined + " " + value
+		}
+		if len(next) > maxTagValueLength {
+			break
+		}
+		joined = next
+	}
+	return joined
+}
+
+// sourceObject is a source object of the pieces of a batch, with the slices
+// holding its data in the order of the batch and their deals.
+type sourceObject struct {
+	name     string
+	slices   []*OfflineDeal
+	dealCids []string
+	miners   []string
+	hasMiner map[string]bool
+	tag      bool
+}
+
+// tags returns the deal tags of a source object. The data and piece CID are
+// those of its first slice, the deal CSV lists the deals of every slice when
+// the object is split, or has more deals than fit in a tag.
+func (o *sourceObject) tags(dealCsv string) map[string]string {
+	if len(dealCsv) > maxTagValueLength {
+		dealCsv = filepath.Base(dealCsv)
+	}
+	return map[string]string{
+		filDataCidTag:  o.slices[0].DataCid,
+		filPieceCidTag: o.slices[0].PieceCid,
+		filDealCidTag:  joinTagValue(o.dealCids),
+		filMinerTag:    joinTagValue(o.miners),
+		filSlicesTag:   strconv.Itoa(len(o.slices)),
+		filDealCsvTag:  dealCsv,
+	}
+}
+
+// collectSourceObjects returns the source objects of the pieces with deals,
+// sorted by name. A piece without a file tree in its detail column, nor a
+// carDir to read it from, is a single object named "". The objects of the
+// pieces sent before resumedRows are only tagged again when they continue in
+// a piece sent afterwards.
+func collectSourceObjects(carDir string, deals []*OfflineDeal, summaries []sendReplicaMessage, resumedRows int) ([]*sourceObject, *probe.Error) {
+	objects := make(map[string]*sourceObject)
+	for row, deal := range deals {
+		if summaries[row].Replicas == 0 {
+			continue
+		}
+		files := []string{""}
+		if carDir != "" || deal.Detail != "" {
+			var err *probe.Error
+			if files, err = sliceFiles(carDir, deal); err != nil {
+				return nil, err.Trace(deal.DataCid)
+			}
+		}
+		for _, file := range files {
+			object, ok := objects[file]
+			if !ok {
+				object = &sourceObject{name: file, hasMiner: make(map[string]bool)}
+				objects[file] = object
+			}
+			object.slices = append(object.slices, deal)
+			object.dealCids = append(object.dealCids, summaries[row].DealCids...)
+			for _, miner := range summaries[row].Miners {
+				if !object.hasMiner[miner] {
+					object.hasMiner[miner] = true
+					object.miners = append(object.miners, miner)
+				}
+			}
+			if row >= resumedRows {
+				object.tag = true
+			}
+		}
+	}
+
+	sorted := make([]*sourceObject, 0, len(objects))
+	for _, object := range objects {
+		sorted = append(sorted, object)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted, nil
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+func TestSliceFilesFromDetail(t *testing.T) {
+	deal := &OfflineDeal{
+		DataCid: "bafy",
+		Detail: `{"Name":"","Hash":"bafy","Size":30,"Link":[` +
+			`{"Name":"a.txt","Hash":"bafya","Size":10},` +
+			`{"Name":"dir","Hash":"bafyd","Size":20,"Link":[` +
+			`{"Name":"b.txt","Hash":"bafyb","Size":10},` +
+			`{"Name":"c.txt","Hash":"bafyc","Size":10}]}]}`,
+	}
+	files, err := sliceFiles("", deal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.txt", "dir/b.txt", "dir/c.txt"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	// The parts of a file split by graphsplit are named after the file.
+	deal.Detail = `{"Link":[{"Name":"big.csv.00000001","Hash":"bafyp","Size":10},{"Name":"b.00000001.txt","Hash":"bafyb","Size":10}]}`
+	if files, err = sliceFiles("", deal); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"big.csv", "b.00000001.txt"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	deal.Detail = "{"
+	if _, err = sliceFiles("", deal); err == nil {
+		t.Error("expected an error for an invalid detail")
+	}
+}
+
+func TestJoinTagValue(t *testing.T) {
+	dealCid := "bafyreihg4rxzbxeo3xezfxpsgjpcgrdqv5c7nxhmmfmtdlgqxdabd6fanu"
+	testCases := []struct {
+		values []string
+		count  int
+	}{
+		{nil, 0},
+		{[]string{dealCid}, 1},
+		{[]string{dealCid, dealCid, dealCid, dealCid}, 4},
+		// 5 deal CIDs and their separators take 299 characters.
+		{[]string{dealCid, dealCid, dealCid, dealCid, dealCid}, 4},
+	}
+	for i, testCase := range testCases {
+		value := joinTagValue(testCase.values)
+		if len(value) > maxTagValueLength {
+			t.Errorf("Test %d: tag value of %d characters", i+1, len(value))
+		}
+		count := 0
+		if value != "" {
+			count = len(strings.Split(value, " "))
+		}
+		if count != testCase.count {
+			t.Errorf("Test %d: expected %d values, got %d", i+1, testCase.count, count)
+		}
+	}
+}
+
+func TestCollectSourceObjects(t *testing.T) {
+	// big.csv is split over the first two slices.
+	deals := []*OfflineDeal{
+		{DataCid: "bafy1", PieceCid: "baga1", Detail: `{"Link":[{"Name":"big.csv"},{"Name":"a.txt"}]}`},
+		{DataCid: "bafy2", PieceCid: "baga2", Detail: `{"Link":[{"Name":"big.csv"}]}`},
+		{DataCid: "bafy3", PieceCid: "baga3", Detail: `{"Link":[{"Name":"b.txt"}]}`},
+		{DataCid: "bafy4", PieceCid: "baga4", Detail: `{"Link":[{"Name":"c.txt"}]}`},
+	}
+	summaries := []sendReplicaMessage{
+		{Replicas: 2, Miners: []string{"f01", "f02"}, DealCids: []string{"deal1a", "deal1b"}},
+		{Replicas: 1, Miners: []string{"f01"}, DealCids: []string{"deal2"}},
+		{Replicas: 1, Miners: []string{"f03"}, DealCids: []string{"deal3"}},
+		// Every proposal of the last piece failed.
+		{Replicas: 0},
+	}
+
+	// The first slice was sent before the batch was resumed.
+	objects, err := collectSourceObjects("", deals, summaries, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tags := make(map[string]map[string]string)
+	for _, object := range objects {
+		names = append(names, object.name)
+		if object.tag {
+			tags[object.name] = object.tags("/data/car/dealMetadata-5a3c8f21.csv")
+		}
+	}
+	if expected := []string{"a.txt", "b.txt", "big.csv"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected objects %v, got %v", expected, names)
+	}
+	if _, ok := tags["a.txt"]; ok {
+		t.Error("expected a.txt of a resumed slice not to be tagged again")
+	}
+	expected := map[string]string{
+		filDataCidTag:  "bafy1",
+		filPieceCidTag: "baga1",
+		filDealCidTag:  "deal1a deal1b deal2",
+		filMinerTag:    "f01 f02",
+		filSlicesTag:   "2",
+		filDealCsvTag:  "/data/car/dealMetadata-5a3c8f21.csv",
+	}
+	if !reflect.DeepEqual(tags["big.csv"], expected) {
+		t.Errorf("expected tags %v, got %v", expected, tags["big.csv"])
+	}
+	if tags["b.txt"][filDataCidTag] != "bafy3" || tags["b.txt"][filSlicesTag] != "1" {
+		t.Errorf("unexpected tags %v", tags["b.txt"])
+	}
+}
+
+// tagsClient is a Client holding the tags of a single object.
+type tagsClient struct {
+	Client
+	tags map[string]string
+}
+
+func (c *tagsClient) GetTags(ctx context.Context, versionID string) (map[string]string, *probe.Error) {
+	return c.tags, nil
+}
+
+func (c *tagsClient) SetTags(ctx context.Context, versionID, tags string) *probe.Error {
+	values, e := url.ParseQuery(tags)
+	if e != nil {
+		return probe.NewError(e)
+	}
+	c.tags = make(map[string]string)
+	for key := range values {
+		c.tags[key] = values.Get(key)
+	}
+	return nil
+}
+
+func TestMergeObjectTags(t *testing.T) {
+	dealTags := (&sourceObject{
+		slices:   []*OfflineDeal{{DataCid: "bafy1", PieceCid: "baga1"}},
+		dealCids: []string{"deal1"},
+		miners:   []string{"f01"},
+	}).tags("minio/swan/dealMetadata-5a3c8f21.csv")
+
+	// The deal tags are merged into the tags of the object.
+	clnt := &tagsClient{tags: map[string]string{"owner": "alice", filMinerTag: "f09"}}
+	if err := mergeObjectTags(context.Background(), clnt, "", dealTags); err != nil {
+		t.Fatal(err)
+	}
+	if len(clnt.tags) != 7 || clnt.tags["owner"] != "alice" || clnt.tags[filMinerTag] != "f01" {
+		t.Errorf("unexpected tags %v", clnt.tags)
+	}
+
+	// The CID tags fill the object up to 10 tags, the existing tags are kept.
+	clnt.tags["project"] = "dataset"
+	cidTags := map[string]string{filUnixfsCidTag: "bafyfile", filUnixfsChunkTag: "1048576"}
+	if err := mergeObjectTags(context.Background(), clnt, "", cidTags); err != nil {
+		t.Fatal(err)
+	}
+	if len(clnt.tags) != maxObjectTags {
+		t.Errorf("expected %d tags, got %v", maxObjectTags, clnt.tags)
+	}
+
+	// The tags which do not fit are left out, the least useful first, and
+	// reported, the tags already set are updated.
+	clnt.tags = map[string]string{filDataCidTag: "bafy0"}
+	for i := 0; i < 6; i++ {
+		clnt.tags["user-"+strconv.Itoa(i)] = "value"
+	}
+	err := mergeObjectTags(context.Background(), clnt, "", dealTags)
+	if err == nil {
+		t.Fatal("expected an error for the tags left out")
+	}
+	if _, ok := err.ToGoError().(tooManyTagsErr); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, key := range []string{filDealCsvTag, filSlicesTag} {
+		if _, ok := clnt.tags[key]; ok || !strings.Contains(err.ToGoError().Error(), key) {
+			t.Errorf("expected %s left out and reported, got %v and %v", key, clnt.tags, err)
+		}
+	}
+	if len(clnt.tags) != maxObjectTags || clnt.tags[filDataCidTag] != "bafy1" || clnt.tags[filDealCidTag] != "deal1" || clnt.tags[filMinerTag] != "f01" {
+		t.Errorf("unexpected tags %v", clnt.tags)
+	}
+}
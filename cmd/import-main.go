@@ -1,23 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"github.com/filswan/fs3-mc/logs"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/filswan/fs3-mc/pkg/probe"
 	"github.com/minio/cli"
-	"strings"
+	json "github.com/minio/colorjson"
 )
 
-type ImportOnlineDealData struct {
-	Bucket string
-	Object string
-}
-
-//func NewOnlineDealData() *ImportOnlineDealData {
-//return &ImportOnlineDealData{}
-//}
-
 var importCmd = cli.Command{
 	Name:         "import",
 	Usage:        "import online deal data",
@@ -25,67 +20,227 @@ var importCmd = cli.Command{
 	OnUsageError: onUsageError,
 	Before:       setGlobalsFromContext,
 	Subcommands:  nil,
-	Flags:        importFlags,
-}
+	Flags:        append(importFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
 
-func mainImport(ctx *cli.Context) error {
-	bucket, object := checkImportArgs(ctx)
+USAGE:
+  {{.HelpName}} [FLAGS] SOURCE [SOURCE...]
 
-	importConfigs := ImportOnlineDealData{
-		Bucket: bucket,
-		Object: object,
-	}
-	proposeImportData(importConfigs)
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Import files into the client store of the lotus node and print their data CID.
+  SOURCE is a local file or directory, read by the lotus node from the same path, or
+  any mc URL such as myminio/bucket/object. Remote objects are downloaded into
+  --staging-dir first, which the lotus node must be able to read. Lotus keeps
+  reading the staged files of its imports, do not remove them before the deals
+  are made.
 
-	return nil
+EXAMPLES:
+  1. Import an object of an FS3 server.
+     {{.Prompt}} {{.HelpName}} myminio/testbucket/test.zip
+
+  2. Import all the objects under a prefix into a directory shared with the lotus node.
+     {{.Prompt}} {{.HelpName}} --recursive --staging-dir /mnt/lotus-import myminio/testbucket/2021
+
+  3. Import an object and tag it with its data CID.
+     {{.Prompt}} {{.HelpName}} --tag myminio/testbucket/test.zip
+`,
 }
 
 var importFlags = []cli.Flag{
-	cli.StringFlag{
-		Name:  "bucket",
-		Usage: "specify which bucket to import",
+	cli.BoolFlag{
+		Name:  "recursive, r",
+		Usage: "import all the objects under a prefix, one data-cid for each object",
 	},
 	cli.StringFlag{
-		Name:  "object",
-		Usage: "specify which object to import",
+		Name:  "staging-dir",
+		Usage: "specify where remote objects are downloaded for the lotus node, default: the system temporary directory",
 	},
+	cli.BoolFlag{
+		Name:  "tag",
+		Usage: "tag the imported objects with their data-cid",
+	},
+}
+
+// importMessage container for import messages.
+type importMessage struct {
+	Status     string `json:"status"`
+	Source     string `json:"source"`
+	DataCid    string `json:"dataCid"`
+	StagedFile string `json:"stagedFile,omitempty"`
+}
+
+// JSON jsonified import message.
+func (i importMessage) JSON() string {
+	importJSONBytes, e := json.MarshalIndent(i, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(importJSONBytes)
+}
+
+// String colorized import message.
+func (i importMessage) String() string {
+	return fmt.Sprintf("Source: %s, DataCid: %s", i.Source, i.DataCid)
 }
 
-func checkImportArgs(ctx *cli.Context) (string, string) {
+func checkImportArgs(ctx *cli.Context) ([]string, string) {
 	args := ctx.Args()
+	if len(args) == 0 {
+		cli.ShowCommandHelpAndExit(ctx, "import", globalErrorExitStatus)
+	}
 	for _, arg := range args {
 		if strings.TrimSpace(arg) == "" {
 			fatalIf(errInvalidArgument().Trace(args...), "Unable to validate empty argument.")
-			return "", ""
 		}
 	}
-	bucket := strings.TrimSpace(ctx.String("bucket"))
-	object := strings.TrimSpace(ctx.String("object"))
-	if len(bucket) == 0 {
-		fatalIf(errInvalidArgument(), "please provide a valid bucket name")
-		return "", ""
+
+	stagingDir := strings.TrimSpace(ctx.String("staging-dir"))
+	if stagingDir == "" {
+		stagingDir = filepath.Join(os.TempDir(), "mc-import")
 	}
-	if len(object) == 0 {
-		fatalIf(errInvalidArgument(), "please provide a valid objective name")
-		return "", ""
+	stagingDir, e := filepath.Abs(stagingDir)
+	if e != nil {
+		fatalIf(probe.NewError(e).Trace(stagingDir), "Unable to find the staging directory.")
 	}
 
-	return bucket, object
+	return args, stagingDir
+}
+
+// stagedPath returns where an object is downloaded in the staging
+// directory, under its alias and full path.
+func stagedPath(stagingDir, alias string, content *ClientContent) (string, *probe.Error) {
+	filePath := filepath.Join(stagingDir, alias, filepath.FromSlash(content.URL.Path))
+	if !strings.HasPrefix(filePath, stagingDir+string(filepath.Separator)) {
+		return "", errInvalidSource(content.URL.String())
+	}
+	return filePath, nil
 }
 
-func proposeImportData(config ImportOnlineDealData) {
-	fs3VolumeAddress := defaultVolumeAddress
-	objectPath := filepath.Join(fs3VolumeAddress, config.Bucket, config.Object)
-	//commandArgs = []string{"client", "import", objectPath}
-	//dataCID, err := exec.Command("lotus",commandArgs...).Output()
-	commandLine := "lotus " + "client " + "import " + objectPath
-	dataCID, err := ExecCommand(commandLine)
+// stageObject downloads an object into a local file.
+func stageObject(ctx context.Context, alias string, content *ClientContent, filePath string) *probe.Error {
+	clnt, err := newClientFromAlias(alias, content.URL.String())
+	if err != nil {
+		return err.Trace(content.URL.String())
+	}
+	reader, err := clnt.Get(ctx, GetOptions{VersionID: content.VersionID})
 	if err != nil {
-		logs.GetLogger().Error(err)
-		return
+		return err.Trace(content.URL.String())
+	}
+	defer reader.Close()
+
+	if e := os.MkdirAll(filepath.Dir(filePath), 0700); e != nil {
+		return probe.NewError(e).Trace(filePath)
+	}
+	file, e := os.Create(filePath)
+	if e != nil {
+		return probe.NewError(e).Trace(filePath)
+	}
+	defer file.Close()
+
+	if _, e = io.Copy(file, reader); e != nil {
+		return probe.NewError(e).Trace(content.URL.String())
 	}
-	outStr := strings.Fields(string(dataCID))
-	dataCIDStr := outStr[len(outStr)-1]
-	fmt.Println(fmt.Sprintf("Bucket: %s, Object: %s, DataCid: %s", config.Bucket, config.Object, dataCIDStr))
-	return
+	return nil
+}
+
+// importContent imports a file into the lotus node, the objects of an alias
+// are downloaded into the staging directory first.
+func importContent(ctx context.Context, api *lotusClient, alias string, content *ClientContent, stagingDir string) (importMessage, *probe.Error) {
+	msg := importMessage{Status: "success", Source: content.URL.String()}
+	filePath := content.URL.Path
+	if alias == "" {
+		absPath, e := filepath.Abs(filePath)
+		if e != nil {
+			return msg, probe.NewError(e).Trace(filePath)
+		}
+		filePath = absPath
+	} else {
+		msg.Source = alias + content.URL.Path
+		var err *probe.Error
+		if filePath, err = stagedPath(stagingDir, alias, content); err != nil {
+			return msg, err.Trace(msg.Source)
+		}
+		if err = stageObject(ctx, alias, content, filePath); err != nil {
+			return msg, err.Trace(msg.Source)
+		}
+		msg.StagedFile = filePath
+	}
+
+	res, err := api.ClientImport(ctx, lotusFileRef{Path: filePath})
+	if err != nil {
+		return msg, err.Trace(msg.Source)
+	}
+	msg.DataCid = res.Root.String()
+	return msg, nil
+}
+
+// importURL imports an mc URL, every object under it if recursive.
+func importURL(ctx context.Context, api *lotusClient, sourceURL, stagingDir string, recursive, tag bool) bool {
+	alias, _, hostCfg, err := expandAlias(sourceURL)
+	fatalIf(err, "Unable to expand `"+sourceURL+"`.")
+	if hostCfg == nil {
+		// A local path, the lotus node reads it from disk.
+		alias = ""
+	}
+	clnt, err := newClient(sourceURL)
+	fatalIf(err, "Unable to initialize `"+sourceURL+"`.")
+
+	var contents []*ClientContent
+	if recursive {
+		for content := range clnt.List(ctx, ListOptions{Recursive: true, ShowDir: DirNone}) {
+			if content.Err != nil {
+				errorIf(content.Err.Trace(sourceURL), "Unable to list `"+sourceURL+"`.")
+				return false
+			}
+			if !content.Type.IsDir() {
+				contents = append(contents, content)
+			}
+		}
+	} else {
+		content, err := clnt.Stat(ctx, StatOptions{})
+		fatalIf(err, "Unable to stat `"+sourceURL+"`.")
+		if content.Type.IsDir() {
+			fatalIf(errInvalidArgument().Trace(sourceURL), "`"+sourceURL+"` is a folder, use --recursive to import the objects under it.")
+		}
+		contents = append(contents, content)
+	}
+
+	ok := true
+	for _, content := range contents {
+		msg, err := importContent(ctx, api, alias, content, stagingDir)
+		if err != nil {
+			errorIf(err, "Unable to import `"+msg.Source+"`.")
+			ok = false
+			continue
+		}
+		printMsg(msg)
+		if tag {
+			errorIf(tagDealObject(ctx, msg.Source, map[string]string{filDataCidTag: msg.DataCid}), "Unable to tag `"+msg.Source+"`.")
+		}
+	}
+	return ok
+}
+
+func mainImport(ctx *cli.Context) error {
+	sourceURLs, stagingDir := checkImportArgs(ctx)
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	importCtx, cancelImport := context.WithCancel(globalContext)
+	defer cancelImport()
+
+	failed := false
+	for _, sourceURL := range sourceURLs {
+		if !importURL(importCtx, api, sourceURL, stagingDir, ctx.Bool("recursive"), ctx.Bool("tag")) {
+			failed = true
+		}
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setTestConfigDir points mc to an empty config directory, so that local
+// paths are not taken for aliases, and returns a function restoring it.
+func setTestConfigDir(t *testing.T) func() {
+	configDir, e := ioutil.TempDir("", "mc-config")
+	if e != nil {
+		t.Fatal(e)
+	}
+	savedConfigDir, savedLoadConfig := mcCustomConfigDir, loadMcConfig
+	mcCustomConfigDir = configDir
+	loadMcConfig = loadMcConfigFactory()
+	return func() {
+		mcCustomConfigDir, loadMcConfig = savedConfigDir, savedLoadConfig
+		os.RemoveAll(configDir)
+	}
+}
+
+func TestImportContent(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	server, handler := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientImport": map[string]interface{}{
+			"Root":     map[string]string{"/": "bafk2bzacea"},
+			"ImportID": 1,
+		},
+	})
+	defer server.Close()
+
+	dir, e := ioutil.TempDir("", "mc-import")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "test.zip")
+	if e = ioutil.WriteFile(filePath, []byte("data"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	clnt, err := newClient(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := clnt.Stat(context.Background(), StatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := importContent(context.Background(), newLotusClient(server.URL, ""), "", content, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.DataCid != "bafk2bzacea" || msg.StagedFile != "" {
+		t.Errorf("unexpected import %+v", msg)
+	}
+	var ref lotusFileRef
+	if e = json.Unmarshal(handler.params["Filecoin.ClientImport"][0], &ref); e != nil {
+		t.Fatal(e)
+	}
+	if ref.Path != filePath {
+		t.Errorf("expected lotus to import %s, got %s", filePath, ref.Path)
+	}
+}
+
+func TestStagedPath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/bucket/object", filepath.Join("/staging", "myminio", "bucket", "object")},
+		{"/bucket/prefix/object", filepath.Join("/staging", "myminio", "bucket", "prefix", "object")},
+		{"/../../etc/passwd", ""},
+	}
+	for i, testCase := range testCases {
+		content := &ClientContent{URL: ClientURL{Type: objectStorage, Path: testCase.path, Separator: '/'}}
+		filePath, err := stagedPath("/staging", "myminio", content)
+		if testCase.expected == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected %s to be rejected, got %s", i+1, testCase.path, filePath)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if filePath != testCase.expected {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.expected, filePath)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	"github.com/minio/minio/pkg/console"
+)
+
+var listAskFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "network",
+		EnvVar: networkEnv,
+		Value:  defaultNetwork,
+		Usage:  "specify the filecoin network to compute the expiry time of the asks on",
+	},
+}
+
+var listAskCmd = cli.Command{
+	Name:         "ask",
+	Usage:        "query the live storage ask of miners through lotus",
+	Action:       mainListAsk,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(listAskFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] MINER-ID [MINER-ID...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Query the storage ask of miners through the lotus API, and show their price, verified
+  price, piece sizes and the expiry of the ask. Prices are in FIL for each GiB per epoch.
+  The values listed by swan are shown below, the ones differing from the ask are highlighted.
+
+EXAMPLES:
+  1. Show the asks of two miners.
+     {{.Prompt}} {{.HelpName}} f01234 f05678
+
+  2. Show the ask of a miner in JSON format.
+     {{.Prompt}} {{.HelpName}} --json f01234
+`,
+}
+
+// listAskMessage is the live storage ask of a miner, along with the values
+// listed by swan.
+type listAskMessage struct {
+	Status        string        `json:"status"`
+	MinerID       string        `json:"minerId"`
+	Price         string        `json:"price"`
+	VerifiedPrice string        `json:"verifiedPrice"`
+	MinPieceSize  uint64        `json:"minPieceSize"`
+	MaxPieceSize  uint64        `json:"maxPieceSize"`
+	Expiry        int64         `json:"expiry"`
+	ExpiryTime    time.Time     `json:"expiryTime"`
+	Swan          *MinerMessage `json:"swan,omitempty"`
+	Differences   []string      `json:"differences,omitempty"`
+}
+
+// JSON jsonified list ask message.
+func (l listAskMessage) JSON() string {
+	askJSONBytes, e := json.MarshalIndent(l, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(askJSONBytes)
+}
+
+// String colorized list ask message.
+func (l listAskMessage) String() string {
+	differs := make(map[string]bool)
+	for _, field := range l.Differences {
+		differs[field] = true
+	}
+	field := func(name string, width int, value string) string {
+		value = fmt.Sprintf("%*s", -width, value)
+		if differs[name] {
+			return console.Colorize("AskDifference", value)
+		}
+		return value
+	}
+
+	message := fmt.Sprintf("%*s %s %s %s %s %s",
+		-10, l.MinerID,
+		field("price", 30, l.Price+" FIL"),
+		field("verifiedPrice", 30, l.VerifiedPrice+" FIL"),
+		field("minPieceSize", 15, humanize.IBytes(l.MinPieceSize)),
+		field("maxPieceSize", 15, humanize.IBytes(l.MaxPieceSize)),
+		l.ExpiryTime.Local().Format(printDate)+" (epoch "+strconv.FormatInt(l.Expiry, 10)+")")
+	if l.Swan != nil {
+		message += fmt.Sprintf("\n%*s %*s %*s %*s %*s",
+			-10, "  swan",
+			-30, l.Swan.Price,
+			-30, l.Swan.VerifiedPrice,
+			-15, l.Swan.MinPieceSize,
+			-15, l.Swan.MaxPieceSize)
+	}
+	return message
+}
+
+// newListAskMessage builds the message of a storage ask, and compares it
+// with the values listed by swan when swan is not nil.
+func newListAskMessage(network networkConfigV10, ask *lotusStorageAsk, swan *MinerMessage) (listAskMessage, *probe.Error) {
+	price, ok := new(big.Int).SetString(ask.Price, 10)
+	if !ok {
+		return listAskMessage{}, errInvalidArgument().Trace(ask.Miner, ask.Price)
+	}
+	verifiedPrice, ok := new(big.Int).SetString(ask.VerifiedPrice, 10)
+	if !ok {
+		return listAskMessage{}, errInvalidArgument().Trace(ask.Miner, ask.VerifiedPrice)
+	}
+	message := listAskMessage{
+		Status:        "success",
+		MinerID:       ask.Miner,
+		Price:         formatFIL(price),
+		VerifiedPrice: formatFIL(verifiedPrice),
+		MinPieceSize:  ask.MinPieceSize,
+		MaxPieceSize:  ask.MaxPieceSize,
+		Expiry:        ask.Expiry,
+		ExpiryTime:    network.timeAt(ask.Expiry),
+		Swan:          swan,
+	}
+	if swan == nil {
+		return message, nil
+	}
+
+	// Values which swan does not list, or which can not be parsed, are
+	// reported as different.
+	priceDiffers := func(swanPrice string, askPrice *big.Int) bool {
+		listed, err := parseFIL(swanPrice)
+		return err != nil || listed.Cmp(askPrice) != 0
+	}
+	sizeDiffers := func(swanSize string, askSize uint64) bool {
+		listed, e := humanize.ParseBytes(swanSize)
+		return e != nil || listed != askSize
+	}
+	if priceDiffers(swan.Price, price) {
+		message.Differences = append(message.Differences, "price")
+	}
+	if priceDiffers(swan.VerifiedPrice, verifiedPrice) {
+		message.Differences = append(message.Differences, "verifiedPrice")
+	}
+	if sizeDiffers(swan.MinPieceSize, ask.MinPieceSize) {
+		message.Differences = append(message.Differences, "minPieceSize")
+	}
+	if sizeDiffers(swan.MaxPieceSize, ask.MaxPieceSize) {
+		message.Differences = append(message.Differences, "maxPieceSize")
+	}
+	return message, nil
+}
+
+// queryStorageAsk queries the storage ask of a miner through lotus.
+func queryStorageAsk(ctx context.Context, api *lotusClient, minerID string) (*lotusStorageAsk, *probe.Error) {
+	info, err := api.StateMinerInfo(ctx, minerID)
+	if err != nil {
+		return nil, err.Trace(minerID)
+	}
+	if info.PeerId == nil {
+		return nil, errInvalidArgument().Trace(minerID, "no peer ID")
+	}
+	ask, err := api.ClientQueryAsk(ctx, *info.PeerId, minerID)
+	if err != nil {
+		return nil, err.Trace(minerID)
+	}
+	return ask, nil
+}
+
+// mainListAsk is the handle for "mc list ask" command.
+func mainListAsk(cliCtx *cli.Context) error {
+	if len(cliCtx.Args()) == 0 {
+		cli.ShowCommandHelpAndExit(cliCtx, "ask", 1) // last argument is exit code
+	}
+	console.SetColor("AskDifference", color.New(color.FgYellow, color.Bold))
+
+	ctx, cancelList := context.WithCancel(globalContext)
+	defer cancelList()
+
+	network, err := loadNetwork(cliCtx.String("network"))
+	fatalIf(err, "Unable to load the network profile.")
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	minerIDs := make([]string, 0, len(cliCtx.Args()))
+	for _, minerID := range cliCtx.Args() {
+		minerIDs = append(minerIDs, strings.TrimSpace(minerID))
+	}
+	swanMiners, err := findSwanMiners(ctx, minerIDs)
+	errorIf(err, "Unable to get the miner list from swan, not comparing the asks with it.")
+
+	failed := false
+	for _, minerID := range minerIDs {
+		ask, err := queryStorageAsk(ctx, api, minerID)
+		if err != nil {
+			errorIf(err, "Unable to query the ask of miner `"+minerID+"`.")
+			failed = true
+			continue
+		}
+		message, err := newListAskMessage(network, ask, swanMiners[minerID])
+		if err != nil {
+			errorIf(err, "Unable to read the ask of miner `"+minerID+"`.")
+			failed = true
+			continue
+		}
+		printMsg(message)
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListAsk(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.StateMinerInfo": map[string]interface{}{"PeerId": "12D3KooW"},
+		"Filecoin.ClientQueryAsk": map[string]interface{}{
+			"Price":         "500000000",
+			"VerifiedPrice": "0",
+			"MinPieceSize":  256,
+			"MaxPieceSize":  34359738368,
+			"Miner":         "f01234",
+			"Expiry":        100,
+		},
+	})
+	defer server.Close()
+
+	ask, err := queryStorageAsk(context.Background(), newLotusClient(server.URL, ""), "f01234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network := builtinNetworks["mainnet"]
+	testCases := []struct {
+		swan        *MinerMessage
+		differences []string
+	}{
+		{nil, nil},
+		{&MinerMessage{Price: "0.0000000005", VerifiedPrice: "0", MinPieceSize: "256 B", MaxPieceSize: "32 GiB"}, nil},
+		{&MinerMessage{Price: "0.000000001", VerifiedPrice: "0", MinPieceSize: "1 GiB", MaxPieceSize: "32 GiB"}, []string{"price", "minPieceSize"}},
+		{&MinerMessage{}, []string{"price", "verifiedPrice", "minPieceSize", "maxPieceSize"}},
+	}
+	for i, testCase := range testCases {
+		message, err := newListAskMessage(network, ask, testCase.swan)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if message.Price != "0.0000000005" || message.MaxPieceSize != 34359738368 {
+			t.Errorf("Test %d: unexpected ask %v", i+1, message)
+		}
+		if message.ExpiryTime.Unix() != network.GenesisTime+100*network.BlockTime {
+			t.Errorf("Test %d: unexpected expiry time %s", i+1, message.ExpiryTime)
+		}
+		if !reflect.DeepEqual(message.Differences, testCase.differences) {
+			t.Errorf("Test %d: expected differences %v, got %v", i+1, testCase.differences, message.Differences)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import "github.com/minio/cli"
 
 var listCmdSubcommands = []cli.Command{
 	listMinerCmd,
+	listAskCmd,
 }
 
 var listCmd = cli.Command{
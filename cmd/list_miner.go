@@ -3,14 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/filswan/fs3-mc/pkg/probe"
 	"github.com/minio/cli"
 	json "github.com/minio/colorjson"
-	"github.com/filswan/fs3-mc/pkg/probe"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
-	"net/url"
-	"time"
+	"sort"
+	"strings"
 )
 
 var listFlags = []cli.Flag{
@@ -20,6 +22,39 @@ var listFlags = []cli.Flag{
 	},
 }
 
+var listMinerFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "limit",
+		Value: swanPageSize,
+		Usage: "specify how many miners to list",
+	},
+	cli.BoolFlag{
+		Name:  "all",
+		Usage: "list all the miners, page by page",
+	},
+	cli.StringFlag{
+		Name:  "sort-by",
+		Usage: "sort the miners by price, score or power",
+	},
+	cli.StringFlag{
+		Name:  "status",
+		Value: "Active",
+		Usage: "list miners with this status, all statuses if empty",
+	},
+	cli.StringFlag{
+		Name:  "max-price",
+		Usage: "only list miners asking at most this price for each GiB, in FIL or with a unit",
+	},
+	cli.BoolFlag{
+		Name:  "offline-only",
+		Usage: "only list miners accepting offline deals",
+	},
+	cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "query the swan API even when its response is cached",
+	},
+}
+
 type minerResponse struct {
 	Data struct {
 		Miner []MinerMessage `json:"miner"`
@@ -42,8 +77,36 @@ type MinerMessage struct {
 }
 
 func (m MinerMessage) JSON() string {
-	m.Status = "success"
-	jsonMessageBytes, e := json.MarshalIndent(m, "", " ")
+	// The status of the message is the result of the command, the status
+	// of the miner on swan has a field of its own.
+	jsonMessage := struct {
+		Status               string      `json:"status"`
+		AdjustedPower        string      `json:"adjusted_power"`
+		Location             string      `json:"location"`
+		MaxPieceSize         string      `json:"max_piece_size"`
+		MinPieceSize         string      `json:"min_piece_size"`
+		MinerID              string      `json:"miner_id"`
+		MinerStatus          string      `json:"miner_status"`
+		OfflineDealAvailable bool        `json:"offline_deal_available"`
+		Price                string      `json:"price"`
+		Score                interface{} `json:"score"`
+		UpdateTimeStr        string      `json:"update_time_str"`
+		VerifiedPrice        string      `json:"verified_price"`
+	}{
+		Status:               "success",
+		AdjustedPower:        m.AdjustedPower,
+		Location:             m.Location,
+		MaxPieceSize:         m.MaxPieceSize,
+		MinPieceSize:         m.MinPieceSize,
+		MinerID:              m.MinerID,
+		MinerStatus:          m.Status,
+		OfflineDealAvailable: m.OfflineDealAvailable,
+		Price:                m.Price,
+		Score:                m.Score,
+		UpdateTimeStr:        m.UpdateTimeStr,
+		VerifiedPrice:        m.VerifiedPrice,
+	}
+	jsonMessageBytes, e := json.MarshalIndent(jsonMessage, "", " ")
 	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
 
 	return string(jsonMessageBytes)
@@ -68,14 +131,40 @@ var (
 		Name:            "miner",
 		Usage:           "get miner info from swan",
 		Action:          mainSwanListMiner,
+		OnUsageError:    onUsageError,
 		Before:          setGlobalsFromContext,
 		HideHelpCommand: true,
-		Flags:           append(listFlags, globalFlags...),
-		Subcommands:     adminServiceSubcommands,
+		Flags:           append(append(listFlags, listMinerFlags...), globalFlags...),
+		CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  List the miners of the swan API, set with $SWAN_API or in the 'swan' entry of the
+  config file. Responses are cached on disk for 10 minutes by default.
+  With --sort-by, --max-price or --offline-only, all the miners are fetched, then
+  filtered and sorted, and the first --limit of them are listed.
+  In JSON format, "status" is the status of the command, the status of the miner
+  on swan is "miner_status".
+
+EXAMPLES:
+  1. List the 100 first active miners.
+     {{.Prompt}} {{.HelpName}}
+
+  2. List the cheapest miners in Asia accepting offline deals.
+     {{.Prompt}} {{.HelpName}} --all --region Asia --offline-only --sort-by price
+
+  3. List all the miners asking at most 500 nanoFIL in JSON format.
+     {{.Prompt}} {{.HelpName}} --all --max-price "500 nanoFIL" --json
+`,
 	}
-	validRegions     = []string{"Global", "Asia", "Africa", "NorthAmerica", "SouthAmerica", "Europe", "Oceania"}
-	swanMinerListUrl = "https://api.filswan.com/miners?limit=100&offset=0&status=Active&sort_by=score&order=ascending"
-	arg2Param        = map[string]string{
+	validRegions = []string{"Global", "Asia", "Africa", "NorthAmerica", "SouthAmerica", "Europe", "Oceania"}
+	arg2Param    = map[string]string{
 		"NorthAmerica": "North America",
 		"SouthAmerica": "South America",
 	}
@@ -118,31 +207,30 @@ func mainSwanListMiner(cliCtx *cli.Context) error {
 	defer cancelList()
 
 	region := checkListArgs(cliCtx)
-	if len(region) > 0 {
-		swanMinerListUrl = fmt.Sprintf("%s%s%s", swanMinerListUrl, "&location=", url.QueryEscape(region))
+	query := swanMinerQuery{
+		Region:  region,
+		Status:  strings.TrimSpace(cliCtx.String("status")),
+		Limit:   cliCtx.Int("limit"),
+		NoCache: cliCtx.Bool("no-cache"),
 	}
-
-	client := http.Client{Timeout: 5 * time.Second}
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, swanMinerListUrl, nil)
-	if err != nil {
-		return nil
+	if cliCtx.Bool("all") {
+		query.Limit = 0
+	} else if query.Limit <= 0 {
+		fatalIf(errInvalidArgument().Trace(cliCtx.String("limit")), "Please provide a positive --limit.")
 	}
-	resp, err := client.Do(request)
-	defer closeResponse(resp)
-	if err != nil {
-		return err
+	var maxPrice *big.Int
+	if price := cliCtx.String("max-price"); price != "" {
+		var err *probe.Error
+		maxPrice, err = parseFIL(price)
+		fatalIf(err, "Unable to parse --max-price `"+price+"`.")
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	sortBy := cliCtx.String("sort-by")
+	if _, ok := minerSorters[sortBy]; !ok && sortBy != "" {
+		fatalIf(errInvalidArgument().Trace(sortBy), "Please provide --sort-by as price, score or power.")
 	}
 
-	response := minerResponse{}
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return err
-	}
+	miners, err := listSwanMiners(ctx, query, maxPrice, cliCtx.Bool("offline-only"), sortBy)
+	fatalIf(err, "Unable to get the miner list from swan.")
 
 	messageTitle := MinerMessage{
 		MinerID:       "Miner",
@@ -155,11 +243,80 @@ func mainSwanListMiner(cliCtx *cli.Context) error {
 		MaxPieceSize:  "Max Piece Size",
 		Location:      "Region",
 	}
-	printMsg(messageTitle)
+	if !globalJSON {
+		printMsg(messageTitle)
+	}
 
-	for _, message := range response.Data.Miner {
+	for _, message := range miners {
 		printMsg(message)
 	}
 
 	return nil
 }
+
+// minerSorters order miners for --sort-by: the cheapest, the best scored or
+// the most powerful first.
+var minerSorters = map[string]func(a, b MinerMessage) bool{
+	"price": func(a, b MinerMessage) bool {
+		priceA, errA := parseFIL(a.Price)
+		priceB, errB := parseFIL(b.Price)
+		if errA != nil || errB != nil {
+			// Miners without a valid price go last.
+			return errA == nil && errB != nil
+		}
+		return priceA.Cmp(priceB) < 0
+	},
+	"score": func(a, b MinerMessage) bool {
+		return minerScore(a) > minerScore(b)
+	},
+	"power": func(a, b MinerMessage) bool {
+		powerA, _ := humanize.ParseBytes(a.AdjustedPower)
+		powerB, _ := humanize.ParseBytes(b.AdjustedPower)
+		return powerA > powerB
+	},
+}
+
+// listSwanMiners returns the first query.Limit miners of the swan API, all of
+// them when 0, asking at most maxPrice if not nil, accepting offline deals if
+// offlineOnly and sorted by sortBy if set. The swan API filters neither by
+// price nor by offline deals and does not sort by price or power: the whole
+// list is fetched before the first miners are kept.
+func listSwanMiners(ctx context.Context, query swanMinerQuery, maxPrice *big.Int, offlineOnly bool, sortBy string) ([]MinerMessage, *probe.Error) {
+	limit := query.Limit
+	if maxPrice != nil || offlineOnly || sortBy != "" {
+		query.Limit = 0
+	}
+	miners, err := fetchSwanMiners(ctx, query)
+	if err != nil {
+		return nil, err.Trace()
+	}
+	miners = filterMiners(miners, maxPrice, offlineOnly)
+	if sortBy != "" {
+		sort.SliceStable(miners, func(i, j int) bool {
+			return minerSorters[sortBy](miners[i], miners[j])
+		})
+	}
+	if limit > 0 && len(miners) > limit {
+		miners = miners[:limit]
+	}
+	return miners, nil
+}
+
+// filterMiners keeps the miners asking at most maxPrice, if not nil, and
+// accepting offline deals if offlineOnly.
+func filterMiners(miners []MinerMessage, maxPrice *big.Int, offlineOnly bool) []MinerMessage {
+	var filtered []MinerMessage
+	for _, m := range miners {
+		if offlineOnly && !m.OfflineDealAvailable {
+			continue
+		}
+		if maxPrice != nil {
+			price, err := parseFIL(m.Price)
+			if err != nil || price.Cmp(maxPrice) > 0 {
+				continue
+			}
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered
+}
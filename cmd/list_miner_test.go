@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMinerMessageJSON(t *testing.T) {
+	miner := MinerMessage{MinerID: "f01234", Status: "Offline", Price: "0.0000001", Score: 90.0}
+	var message map[string]interface{}
+	if e := json.Unmarshal([]byte(miner.JSON()), &message); e != nil {
+		t.Fatal(e)
+	}
+	if message["status"] != "success" {
+		t.Errorf("expected status success, got %v", message["status"])
+	}
+	if message["miner_status"] != "Offline" || message["miner_id"] != "f01234" || message["price"] != "0.0000001" {
+		t.Errorf("unexpected message %v", message)
+	}
+}
@@ -0,0 +1,465 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+const (
+	// lotusAPIInfoEnv is the environment variable used by lotus itself to
+	// locate the full node, in the form TOKEN:MULTIADDR.
+	lotusAPIInfoEnv = "FULLNODE_API_INFO"
+
+	lotusRPCPath = "/rpc/v0"
+)
+
+// lotusAPIInfoWithToken matches a JWT token prefix in FULLNODE_API_INFO.
+var lotusAPIInfoWithToken = regexp.MustCompile(`^[a-zA-Z0-9\-_]+?\.[a-zA-Z0-9\-_]+?\.([a-zA-Z0-9\-_]+)?:.+$`)
+
+// lotusClient talks to the Lotus full node JSON-RPC API.
+type lotusClient struct {
+	endpoint   string
+	token      string
+	httpClient *http.Client
+	lastID     int64
+}
+
+// lotusCid is the JSON encoding of a CID used by the Lotus API.
+type lotusCid struct {
+	Root string `json:"/"`
+}
+
+func (c *lotusCid) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.Root
+}
+
+// lotusFileRef is a reference to a file on the lotus node.
+type lotusFileRef struct {
+	Path  string
+	IsCAR bool
+}
+
+// lotusImportRes is returned by ClientImport.
+type lotusImportRes struct {
+	Root     lotusCid
+	ImportID uint64
+}
+
+// lotusDataRef describes the payload of a storage deal.
+type lotusDataRef struct {
+	TransferType string
+	Root         lotusCid
+	PieceCid     *lotusCid `json:",omitempty"`
+	PieceSize    uint64
+	RawBlockSize uint64
+}
+
+// lotusStartDealParams are the parameters of ClientStartDeal.
+type lotusStartDealParams struct {
+	Data               *lotusDataRef
+	Wallet             string
+	Miner              string
+	EpochPrice         string
+	MinBlocksDuration  uint64
+	ProviderCollateral string
+	DealStartEpoch     int64
+	FastRetrieval      bool
+	VerifiedDeal       bool
+}
+
+const (
+	lotusTransferGraphsync = "graphsync"
+	lotusTransferManual    = "manual"
+)
+
+type lotusRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type lotusRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lotusRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *lotusRPCError  `json:"error"`
+}
+
+// newLotusClient returns a client for the given endpoint URL and token.
+func newLotusClient(endpoint, token string) *lotusClient {
+	return &lotusClient{
+		endpoint:   endpoint,
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// newLotusClientFromConfig returns a client for the full node configured
+// through $FULLNODE_API_INFO, or the `lotus` entry of the mc config.
+func newLotusClientFromConfig() (*lotusClient, *probe.Error) {
+	apiInfo := strings.TrimSpace(os.Getenv(lotusAPIInfoEnv))
+	token := ""
+	if apiInfo == "" && isMcConfigExists() {
+		cfg, err := loadConfigV10()
+		if err != nil {
+			return nil, err.Trace()
+		}
+		if cfg.Lotus != nil {
+			apiInfo = cfg.Lotus.API
+			token = cfg.Lotus.Token
+		}
+	}
+	if apiInfo == "" {
+		return nil, errLotusNotConfigured().Trace()
+	}
+	endpoint, infoToken, err := parseLotusAPIInfo(apiInfo)
+	if err != nil {
+		return nil, err.Trace()
+	}
+	if infoToken != "" {
+		token = infoToken
+	}
+	return newLotusClient(endpoint, token), nil
+}
+
+// parseLotusAPIInfo parses a lotus API info string, either TOKEN:MULTIADDR
+// or a plain http(s) URL, into an RPC endpoint URL and a token.
+func parseLotusAPIInfo(apiInfo string) (string, string, *probe.Error) {
+	token := ""
+	if lotusAPIInfoWithToken.MatchString(apiInfo) {
+		sp := strings.SplitN(apiInfo, ":", 2)
+		token, apiInfo = sp[0], sp[1]
+	}
+
+	if strings.HasPrefix(apiInfo, "http://") || strings.HasPrefix(apiInfo, "https://") {
+		endpoint := strings.TrimSuffix(apiInfo, "/")
+		if !strings.HasSuffix(endpoint, lotusRPCPath) {
+			endpoint += lotusRPCPath
+		}
+		return endpoint, token, nil
+	}
+
+	// Multiaddr of the form /ip4/127.0.0.1/tcp/1234/http
+	parts := strings.Split(strings.Trim(apiInfo, "/"), "/")
+	if len(parts) < 4 || parts[2] != "tcp" {
+		return "", "", errInvalidLotusAPI(apiInfo).Trace()
+	}
+	var host string
+	switch parts[0] {
+	case "ip4", "ip6", "dns", "dns4", "dns6":
+		host = parts[1]
+	default:
+		return "", "", errInvalidLotusAPI(apiInfo).Trace()
+	}
+	scheme := "http"
+	if len(parts) > 4 {
+		switch parts[4] {
+		case "http", "ws":
+		case "https", "wss":
+			scheme = "https"
+		default:
+			return "", "", errInvalidLotusAPI(apiInfo).Trace()
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(host, parts[3]) + lotusRPCPath, token, nil
+}
+
+// call invokes a JSON-RPC method and decodes its result into result,
+// which may be nil if the result is not needed.
+func (c *lotusClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) *probe.Error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	reqBody, e := json.Marshal(lotusRPCRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddInt64(&c.lastID, 1),
+		Method:  "Filecoin." + method,
+		Params:  params,
+	})
+	if e != nil {
+		return probe.NewError(e)
+	}
+
+	req, e := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(reqBody))
+	if e != nil {
+		return probe.NewError(e)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, e := c.httpClient.Do(req)
+	defer closeResponse(resp)
+	if e != nil {
+		return probe.NewError(e).Trace(c.endpoint)
+	}
+	respBody, e := ioutil.ReadAll(resp.Body)
+	if e != nil {
+		return probe.NewError(e).Trace(c.endpoint)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errLotusAPI(method, fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))).Trace(c.endpoint)
+	}
+
+	var rpcResp lotusRPCResponse
+	if e = json.Unmarshal(respBody, &rpcResp); e != nil {
+		return probe.NewError(e).Trace(method)
+	}
+	if rpcResp.Error != nil {
+		return errLotusAPI(method, rpcResp.Error.Message).Trace(c.endpoint)
+	}
+	if result == nil {
+		return nil
+	}
+	if e = json.Unmarshal(rpcResp.Result, result); e != nil {
+		return probe.NewError(e).Trace(method)
+	}
+	return nil
+}
+
+// ClientImport imports a file on the lotus node into the client store and
+// returns its root data CID.
+func (c *lotusClient) ClientImport(ctx context.Context, ref lotusFileRef) (*lotusImportRes, *probe.Error) {
+	var res lotusImportRes
+	if err := c.call(ctx, "ClientImport", &res, ref); err != nil {
+		return nil, err.Trace(ref.Path)
+	}
+	return &res, nil
+}
+
+// ClientStartDeal proposes a storage deal and returns the proposal CID.
+func (c *lotusClient) ClientStartDeal(ctx context.Context, params *lotusStartDealParams) (*lotusCid, *probe.Error) {
+	var dealCid lotusCid
+	if err := c.call(ctx, "ClientStartDeal", &dealCid, params); err != nil {
+		return nil, err.Trace(params.Miner, params.Data.Root.Root)
+	}
+	return &dealCid, nil
+}
+
+// lotusTipSet is the subset of a tipset used by mc.
+type lotusTipSet struct {
+	Height int64
+}
+
+// lotusDealInfo is the client side state of a storage deal.
+type lotusDealInfo struct {
+	ProposalCid   lotusCid
+	State         uint64
+	Message       string
+	Provider      string
+	DataRef       *lotusDataRef
+	PieceCID      *lotusCid
+	Size          uint64
+	PricePerEpoch string
+	Duration      uint64
+	DealID        uint64
+	Verified      bool
+}
+
+// lotusMarketDeal is the on-chain state of a published storage deal.
+type lotusMarketDeal struct {
+	Proposal struct {
+		PieceCID             lotusCid
+		PieceSize            uint64
+		VerifiedDeal         bool
+		Client               string
+		Provider             string
+		StartEpoch           int64
+		EndEpoch             int64
+		StoragePricePerEpoch string
+	}
+	State struct {
+		SectorStartEpoch int64
+		LastUpdatedEpoch int64
+		SlashEpoch       int64
+	}
+}
+
+// ChainHead returns the current head of the chain.
+func (c *lotusClient) ChainHead(ctx context.Context) (*lotusTipSet, *probe.Error) {
+	var head lotusTipSet
+	if err := c.call(ctx, "ChainHead", &head); err != nil {
+		return nil, err.Trace()
+	}
+	return &head, nil
+}
+
+// ClientGetDealInfo returns the client side state of a deal proposal.
+func (c *lotusClient) ClientGetDealInfo(ctx context.Context, dealCid string) (*lotusDealInfo, *probe.Error) {
+	var info lotusDealInfo
+	if err := c.call(ctx, "ClientGetDealInfo", &info, lotusCid{Root: dealCid}); err != nil {
+		return nil, err.Trace(dealCid)
+	}
+	return &info, nil
+}
+
+// ClientListDeals returns the client side state of all the deals made by
+// the lotus node.
+func (c *lotusClient) ClientListDeals(ctx context.Context) ([]lotusDealInfo, *probe.Error) {
+	var deals []lotusDealInfo
+	if err := c.call(ctx, "ClientListDeals", &deals); err != nil {
+		return nil, err.Trace()
+	}
+	return deals, nil
+}
+
+// StateMarketStorageDeal returns the on-chain state of a published deal at
+// the head of the chain.
+func (c *lotusClient) StateMarketStorageDeal(ctx context.Context, dealID uint64) (*lotusMarketDeal, *probe.Error) {
+	var deal lotusMarketDeal
+	if err := c.call(ctx, "StateMarketStorageDeal", &deal, dealID, nil); err != nil {
+		return nil, err.Trace(strconv.FormatUint(dealID, 10))
+	}
+	return &deal, nil
+}
+
+// lotusMinerInfo is the subset of the miner info used by mc.
+type lotusMinerInfo struct {
+	PeerId *string
+}
+
+// StateMinerInfo returns the on-chain info of a miner at the head of the
+// chain.
+func (c *lotusClient) StateMinerInfo(ctx context.Context, minerID string) (*lotusMinerInfo, *probe.Error) {
+	var info lotusMinerInfo
+	if err := c.call(ctx, "StateMinerInfo", &info, minerID, nil); err != nil {
+		return nil, err.Trace(minerID)
+	}
+	return &info, nil
+}
+
+// lotusStorageAsk is the price and the piece sizes a miner accepts for
+// storage deals, prices are in attoFIL per GiB per epoch.
+type lotusStorageAsk struct {
+	Price         string
+	VerifiedPrice string
+	MinPieceSize  uint64
+	MaxPieceSize  uint64
+	Miner         string
+	Timestamp     int64
+	Expiry        int64
+	SeqNo         uint64
+}
+
+// ClientQueryAsk asks a miner for its current storage ask.
+func (c *lotusClient) ClientQueryAsk(ctx context.Context, peerID, minerID string) (*lotusStorageAsk, *probe.Error) {
+	var ask lotusStorageAsk
+	if err := c.call(ctx, "ClientQueryAsk", &ask, peerID, minerID); err != nil {
+		return nil, err.Trace(minerID)
+	}
+	return &ask, nil
+}
+
+// lotusRetrievalPeer is a miner serving retrievals.
+type lotusRetrievalPeer struct {
+	Address  string
+	ID       string
+	PieceCID *lotusCid `json:",omitempty"`
+}
+
+// lotusQueryOffer is the offer of a miner to retrieve some data, prices
+// are in attoFIL.
+type lotusQueryOffer struct {
+	Err                     string
+	Root                    lotusCid
+	Piece                   *lotusCid `json:",omitempty"`
+	Size                    uint64
+	MinPrice                string
+	UnsealPrice             string
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+	Miner                   string
+	MinerPeer               lotusRetrievalPeer
+}
+
+// lotusRetrievalOrder are the parameters of ClientRetrieve.
+type lotusRetrievalOrder struct {
+	Root                    lotusCid
+	Piece                   *lotusCid `json:",omitempty"`
+	Size                    uint64
+	Total                   string
+	UnsealPrice             string
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+	Client                  string
+	Miner                   string
+	MinerPeer               *lotusRetrievalPeer
+}
+
+// WalletDefaultAddress returns the default wallet of the lotus node.
+func (c *lotusClient) WalletDefaultAddress(ctx context.Context) (string, *probe.Error) {
+	var address string
+	if err := c.call(ctx, "WalletDefaultAddress", &address); err != nil {
+		return "", err.Trace()
+	}
+	return address, nil
+}
+
+// ClientFindData asks the miners storing some data for retrieval offers.
+func (c *lotusClient) ClientFindData(ctx context.Context, dataCid string, pieceCid *lotusCid) ([]lotusQueryOffer, *probe.Error) {
+	var offers []lotusQueryOffer
+	if err := c.call(ctx, "ClientFindData", &offers, lotusCid{Root: dataCid}, pieceCid); err != nil {
+		return nil, err.Trace(dataCid)
+	}
+	return offers, nil
+}
+
+// ClientMinerQueryOffer asks a miner for a retrieval offer.
+func (c *lotusClient) ClientMinerQueryOffer(ctx context.Context, minerID, dataCid string, pieceCid *lotusCid) (*lotusQueryOffer, *probe.Error) {
+	var offer lotusQueryOffer
+	if err := c.call(ctx, "ClientMinerQueryOffer", &offer, minerID, lotusCid{Root: dataCid}, pieceCid); err != nil {
+		return nil, err.Trace(minerID, dataCid)
+	}
+	return &offer, nil
+}
+
+// ClientRetrieve retrieves data into a file on the lotus node, it returns
+// once the retrieval is complete.
+func (c *lotusClient) ClientRetrieve(ctx context.Context, order *lotusRetrievalOrder, ref lotusFileRef) *probe.Error {
+	if err := c.call(ctx, "ClientRetrieve", nil, order, ref); err != nil {
+		return err.Trace(order.Miner, order.Root.Root)
+	}
+	return nil
+}
+
+// lotusRetrievalInfo is the state of a retrieval of the lotus node.
+type lotusRetrievalInfo struct {
+	PayloadCID    lotusCid
+	ID            uint64
+	Status        uint64
+	Message       string
+	Provider      string
+	BytesReceived uint64
+}
+
+// ClientListRetrievals returns the retrievals of the lotus node, with the
+// bytes received so far.
+func (c *lotusClient) ClientListRetrievals(ctx context.Context) ([]lotusRetrievalInfo, *probe.Error) {
+	var retrievals []lotusRetrievalInfo
+	if err := c.call(ctx, "ClientListRetrievals", &retrievals); err != nil {
+		return nil, err.Trace()
+	}
+	return retrievals, nil
+}
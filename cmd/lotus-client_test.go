@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeLotusHandler is a JSON-RPC handler answering with canned results per
+// method, or with the result of a func(params []json.RawMessage) interface{}.
+// A *lotusRPCError result is answered as an error.
+type fakeLotusHandler struct {
+	token   string
+	results map[string]interface{}
+	mutex   sync.Mutex
+	params  map[string][]json.RawMessage
+}
+
+func newFakeLotusServer(token string, results map[string]interface{}) (*httptest.Server, *fakeLotusHandler) {
+	h := &fakeLotusHandler{
+		token:   token,
+		results: results,
+		params:  make(map[string][]json.RawMessage),
+	}
+	return httptest.NewServer(h), h
+}
+
+func (h *fakeLotusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" && r.Header.Get("Authorization") != "Bearer "+h.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		ID     int64             `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.mutex.Lock()
+	h.params[req.Method] = req.Params
+	h.mutex.Unlock()
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if result, ok := h.results[req.Method]; ok {
+		if fn, ok := result.(func([]json.RawMessage) interface{}); ok {
+			result = fn(req.Params)
+		}
+		if rpcErr, ok := result.(*lotusRPCError); ok {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+	} else {
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method '" + req.Method + "' not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestParseLotusAPIInfo(t *testing.T) {
+	testCases := []struct {
+		apiInfo  string
+		endpoint string
+		token    string
+		success  bool
+	}{
+		{"/ip4/127.0.0.1/tcp/1234/http", "http://127.0.0.1:1234/rpc/v0", "", true},
+		{"eyJhbGci.eyJBbGxvdyI6.Wp9s-S_3D:/ip4/10.0.0.2/tcp/1234/http", "http://10.0.0.2:1234/rpc/v0", "eyJhbGci.eyJBbGxvdyI6.Wp9s-S_3D", true},
+		{"/dns4/lotus.example.com/tcp/443/wss", "https://lotus.example.com:443/rpc/v0", "", true},
+		{"/ip6/::1/tcp/1234", "http://[::1]:1234/rpc/v0", "", true},
+		{"http://127.0.0.1:1234", "http://127.0.0.1:1234/rpc/v0", "", true},
+		{"https://lotus.example.com/rpc/v0/", "https://lotus.example.com/rpc/v0", "", true},
+		{"/ip4/127.0.0.1/udp/1234", "", "", false},
+		{"/unix/lotus.sock/tcp/1", "", "", false},
+		{"localhost:1234", "", "", false},
+	}
+
+	for i, testCase := range testCases {
+		endpoint, token, err := parseLotusAPIInfo(testCase.apiInfo)
+		if testCase.success != (err == nil) {
+			t.Fatalf("Test %d: expected success %v, got error %v", i+1, testCase.success, err)
+		}
+		if endpoint != testCase.endpoint || token != testCase.token {
+			t.Errorf("Test %d: expected (%s, %s), got (%s, %s)", i+1, testCase.endpoint, testCase.token, endpoint, token)
+		}
+	}
+}
+
+func TestLotusClientImport(t *testing.T) {
+	server, handler := newFakeLotusServer("secret", map[string]interface{}{
+		"Filecoin.ClientImport": map[string]interface{}{
+			"Root":     map[string]string{"/": "bafykbzacedtest"},
+			"ImportID": 7,
+		},
+	})
+	defer server.Close()
+
+	api := newLotusClient(server.URL, "secret")
+	res, err := api.ClientImport(context.Background(), lotusFileRef{Path: "/data/bucket/object"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Root.String() != "bafykbzacedtest" || res.ImportID != 7 {
+		t.Errorf("Unexpected result: %+v", res)
+	}
+
+	params := handler.params["Filecoin.ClientImport"]
+	if len(params) != 1 {
+		t.Fatalf("Expected 1 parameter, got %d", len(params))
+	}
+	var ref lotusFileRef
+	if e := json.Unmarshal(params[0], &ref); e != nil || ref.Path != "/data/bucket/object" {
+		t.Errorf("Unexpected file ref %s", params[0])
+	}
+
+	// Wrong token is rejected by the node.
+	api = newLotusClient(server.URL, "wrong")
+	if _, err = api.ClientImport(context.Background(), lotusFileRef{Path: "/data/bucket/object"}); err == nil {
+		t.Error("Expected an error for an unauthorized request")
+	}
+}
+
+func TestLotusClientStartDeal(t *testing.T) {
+	server, handler := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientStartDeal": map[string]string{"/": "bafyreidealcid"},
+	})
+	defer server.Close()
+
+	api := newLotusClient(server.URL, "")
+	deal := NewOfflineDeal()
+	deal.MinerId = "f01234"
+	deal.SenderWallet = "f3wallet"
+	deal.DataCid = "bafkdatacid"
+	deal.PieceCid = "baga6piececid"
+	deal.PieceSize = "34091302912"
+	deal.StartEpoch = "1000"
+	deal.Duration = "1036800"
+	deal.Cost = "0.000000005"
+	if err := proposeOfflineDeal(context.Background(), api, deal); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if deal.DealCid != "bafyreidealcid" {
+		t.Errorf("Expected deal cid bafyreidealcid, got %s", deal.DealCid)
+	}
+
+	var params lotusStartDealParams
+	if e := json.Unmarshal(handler.params["Filecoin.ClientStartDeal"][0], &params); e != nil {
+		t.Fatal(e)
+	}
+	if params.Data.TransferType != lotusTransferManual || params.Data.PieceCid.String() != "baga6piececid" ||
+		params.Data.PieceSize != 34091302912 || params.EpochPrice != "5000000000" ||
+		params.DealStartEpoch != 1000 || params.MinBlocksDuration != 1036800 || !params.FastRetrieval {
+		t.Errorf("Unexpected deal params %+v", params)
+	}
+
+	// Errors reported by the node are returned to the caller.
+	if _, err := api.ClientImport(context.Background(), lotusFileRef{}); err == nil {
+		t.Error("Expected an error for an unknown method")
+	}
+}
@@ -63,7 +63,7 @@ var lsCmd = cli.Command{
 	Action:       mainList,
 	OnUsageError: onUsageError,
 	Before:       setGlobalsFromContext,
-	Flags:        append(lsFlags, globalFlags...),
+	Flags:        append(append(lsFlags, cidFlags...), globalFlags...),
 	CustomHelpTemplate: `NAME:
   {{.HelpName}} - {{.Usage}}
 
@@ -102,6 +102,9 @@ EXAMPLES:
 
   9. List all objects on mybucket, summarize the number of objects and total size.
      {{.Prompt}} {{.HelpName}} --summarize s3/mybucket/
+
+  10. List all objects on mybucket with the UnixFS CID they get in CAR files, and save it in their tags.
+     {{.Prompt}} {{.HelpName}} --recursive --cid --store-cid s3/mybucket/
 `,
 }
 
@@ -186,9 +189,11 @@ func mainList(cliCtx *cli.Context) error {
 	console.SetColor("Size", color.New(color.FgYellow))
 	console.SetColor("Time", color.New(color.FgGreen))
 	console.SetColor("Summarize", color.New(color.Bold))
+	console.SetColor("CID", color.New(color.FgHiBlue))
 
 	// check 'ls' cliCtx arguments.
 	args, isRecursive, isIncomplete, isSummary, timeRef, withOlderVersions := checkListSyntax(ctx, cliCtx)
+	cidOpts := parseCIDFlags(cliCtx)
 
 	var cErr error
 	for _, targetURL := range args {
@@ -203,7 +208,13 @@ func mainList(cliCtx *cli.Context) error {
 				fatalIf(err.Trace(targetURL), "Unable to initialize target `"+targetURL+"`.")
 			}
 		}
-		if e := doList(ctx, clnt, isRecursive, isIncomplete, isSummary, timeRef, withOlderVersions); e != nil {
+		var targetCIDOpts *objectCIDOptions
+		if cidOpts != nil {
+			opts := *cidOpts
+			opts.alias, _, _ = mustExpandAlias(targetURL)
+			targetCIDOpts = &opts
+		}
+		if e := doList(ctx, clnt, isRecursive, isIncomplete, isSummary, timeRef, withOlderVersions, targetCIDOpts); e != nil {
 			cErr = e
 		}
 	}
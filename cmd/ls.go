@@ -46,6 +46,7 @@ type contentMessage struct {
 	Key      string    `json:"key"`
 	ETag     string    `json:"etag"`
 	URL      string    `json:"url,omitempty"`
+	CID      string    `json:"cid,omitempty"`
 
 	VersionID      string `json:"versionId,omitempty"`
 	VersionOrd     int    `json:"versionOrdinal,omitempty"`
@@ -68,6 +69,10 @@ func (c contentMessage) String() string {
 		}
 	}
 
+	if c.CID != "" {
+		fileDesc += console.Colorize("CID", " "+c.CID)
+	}
+
 	fileDesc += " " + c.Key
 
 	if c.Filetype == "folder" {
@@ -192,17 +197,33 @@ func (s summaryMessage) JSON() string {
 	return string(jsonMessageBytes)
 }
 
-// Pretty print the list of versions belonging to one object
-func printObjectVersions(clntURL ClientURL, ctntVersions []*ClientContent, printAllVersions, isSummary bool) {
+// Pretty print the list of versions belonging to one object, with their
+// UnixFS CID when cidOpts is set.
+func printObjectVersions(ctx context.Context, clntURL ClientURL, ctntVersions []*ClientContent, printAllVersions, isSummary bool, cidOpts *objectCIDOptions) {
 	sortObjectVersions(ctntVersions)
+	cids := make(map[int]string)
+	if cidOpts != nil {
+		for i, c := range ctntVersions {
+			if i > 0 && !printAllVersions {
+				break
+			}
+			if c.Type.IsDir() || c.IsDeleteMarker {
+				continue
+			}
+			objectCid, err := objectCID(ctx, c.URL.String(), c.VersionID, nil, *cidOpts)
+			errorIf(err, "Unable to compute the CID of `"+c.URL.String()+"`.")
+			cids[i] = objectCid
+		}
+	}
 	msgs := generateContentMessages(clntURL, ctntVersions, printAllVersions)
-	for _, msg := range msgs {
+	for i, msg := range msgs {
+		msg.CID = cids[i]
 		printMsg(msg)
 	}
 }
 
 // doList - list all entities inside a folder.
-func doList(ctx context.Context, clnt Client, isRecursive, isIncomplete, isSummary bool, timeRef time.Time, withOlderVersions bool) error {
+func doList(ctx context.Context, clnt Client, isRecursive, isIncomplete, isSummary bool, timeRef time.Time, withOlderVersions bool, cidOpts *objectCIDOptions) error {
 
 	var (
 		lastPath          string
@@ -247,7 +268,7 @@ func doList(ctx context.Context, clnt Client, isRecursive, isIncomplete, isSumma
 
 		if lastPath != content.URL.Path {
 			// Print any object in the current list before reinitializing it
-			printObjectVersions(clnt.GetURL(), perObjectVersions, withOlderVersions, isSummary)
+			printObjectVersions(ctx, clnt.GetURL(), perObjectVersions, withOlderVersions, isSummary, cidOpts)
 			lastPath = content.URL.Path
 			perObjectVersions = []*ClientContent{}
 		}
@@ -257,7 +278,7 @@ func doList(ctx context.Context, clnt Client, isRecursive, isIncomplete, isSumma
 		totalObjects++
 	}
 
-	printObjectVersions(clnt.GetURL(), perObjectVersions, withOlderVersions, isSummary)
+	printObjectVersions(ctx, clnt.GetURL(), perObjectVersions, withOlderVersions, isSummary, cidOpts)
 
 	if isSummary {
 		printMsg(summaryMessage{
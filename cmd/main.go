@@ -443,6 +443,10 @@ var appCmds = []cli.Command{
 	sendCmd,
 	sendOnlineCmd,
 	importCmd,
+	retrieveCmd,
+	dealCmd,
+	swanCmd,
+	archiveCmd,
 }
 
 func registerApp(name string) *cli.App {
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+const (
+	networkEnv     = "FIL_NETWORK"
+	defaultNetwork = "mainnet"
+	secondsPerDay  = 24 * 3600
+	// maxEpochDrift is how many epochs the local clock may be off from the
+	// chain head before a warning is printed.
+	maxEpochDrift = 3
+)
+
+// builtinNetworks are known without configuration, a local devnet has to be
+// defined in `networks` of the config file, which may also override these.
+var builtinNetworks = map[string]networkConfigV10{
+	"mainnet": {
+		GenesisTime:     1598306471,
+		BlockTime:       30,
+		DefaultStart:    uint(defaultStart),
+		DefaultDuration: uint(defaultDuration),
+	},
+	"calibnet": {
+		GenesisTime:     1667326380,
+		BlockTime:       30,
+		DefaultStart:    uint(defaultStart),
+		DefaultDuration: uint(defaultDuration),
+	},
+}
+
+// loadNetwork returns the profile of a network, mainnet if name is empty.
+func loadNetwork(name string) (networkConfigV10, *probe.Error) {
+	if name == "" {
+		name = defaultNetwork
+	}
+	network, ok := builtinNetworks[name]
+	if isMcConfigExists() {
+		cfg, err := loadConfigV10()
+		if err != nil {
+			return networkConfigV10{}, err.Trace(name)
+		}
+		if configured, found := cfg.Networks[name]; found {
+			network, ok = configured, true
+		}
+	}
+	if !ok || network.BlockTime <= 0 {
+		return networkConfigV10{}, errInvalidNetwork(name).Trace(name)
+	}
+	return network, nil
+}
+
+// epochAt returns the epoch of the network at time t.
+func (n networkConfigV10) epochAt(t time.Time) int64 {
+	return (t.Unix() - n.GenesisTime) / n.BlockTime
+}
+
+// timeAt returns the time of an epoch of the network.
+func (n networkConfigV10) timeAt(epoch int64) time.Time {
+	return time.Unix(n.GenesisTime+epoch*n.BlockTime, 0)
+}
+
+func getCurrentEpoch(network networkConfigV10) uint {
+	return uint(network.epochAt(time.Now()))
+}
+
+func calculateStartEpoch(network networkConfigV10, start uint) uint {
+	return getCurrentEpoch(network) + calculateDuration(network, start)
+}
+
+func calculateDuration(network networkConfigV10, duration uint) uint {
+	return duration * secondsPerDay / uint(network.BlockTime)
+}
+
+// checkChainEpoch returns the epoch given by the local clock and the height
+// of the chain head.
+func checkChainEpoch(ctx context.Context, api *lotusClient, network networkConfigV10) (int64, int64, *probe.Error) {
+	head, err := api.ChainHead(ctx)
+	if err != nil {
+		return 0, 0, err.Trace()
+	}
+	return int64(getCurrentEpoch(network)), head.Height, nil
+}
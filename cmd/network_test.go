@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNetworkEpochs(t *testing.T) {
+	devnet := networkConfigV10{GenesisTime: time.Now().Unix() - 400, BlockTime: 4}
+	testCases := []struct {
+		network  networkConfigV10
+		duration uint
+		epochs   uint
+	}{
+		{builtinNetworks["mainnet"], 360, 1036800},
+		{builtinNetworks["calibnet"], 7, 20160},
+		{devnet, 1, 21600},
+	}
+	for i, testCase := range testCases {
+		if epochs := calculateDuration(testCase.network, testCase.duration); epochs != testCase.epochs {
+			t.Errorf("Test %d: expected %d epochs, got %d", i+1, testCase.epochs, epochs)
+		}
+	}
+
+	if epoch := builtinNetworks["mainnet"].epochAt(time.Unix(1598306471+3000, 0)); epoch != 100 {
+		t.Errorf("expected epoch 100, got %d", epoch)
+	}
+	if start := calculateStartEpoch(devnet, 1); start < 21700 || start > 21701 {
+		t.Errorf("expected start epoch 21700, got %d", start)
+	}
+
+	if _, err := loadNetwork("unknown"); err == nil {
+		t.Error("expected an error for an unknown network")
+	}
+	if network, err := loadNetwork(""); err != nil || network != builtinNetworks["mainnet"] {
+		t.Errorf("expected mainnet by default, got %v, %v", network, err)
+	}
+}
+
+func TestCheckChainEpoch(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ChainHead": map[string]interface{}{"Height": 90},
+	})
+	defer server.Close()
+
+	devnet := networkConfigV10{GenesisTime: time.Now().Unix() - 400, BlockTime: 4}
+	local, head, err := checkChainEpoch(context.Background(), newLotusClient(server.URL, ""), devnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != 90 || local < 100 || local > 101 {
+		t.Errorf("expected local epoch 100 and head 90, got %d and %d", local, head)
+	}
+}
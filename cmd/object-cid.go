@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/minio/cli"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// The DAG of an object is built like the files of the CAR files of 'car
+// generate', objects get the CIDs of their files in a slice.
+const (
+	defaultCIDChunkSize = 1 << 20
+	defaultCIDVersion   = 0
+	unixfsLinksPerLevel = 1 << 10
+)
+
+// Tags caching the UnixFS CID of an object, with the chunk size it was
+// computed with.
+const (
+	filUnixfsCidTag   = "fil-unixfs-cid"
+	filUnixfsChunkTag = "fil-unixfs-chunk-size"
+)
+
+// cidFlags are shared by the commands printing the UnixFS CID of objects.
+var cidFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "cid",
+		Usage: "compute the UnixFS CID of the objects, the same as in the CAR files of 'car generate'",
+	},
+	cli.Int64Flag{
+		Name:  "cid-chunk-size",
+		Value: defaultCIDChunkSize,
+		Usage: "with --cid, size of the chunks of the objects, default: 1MiB like 'car generate'",
+	},
+	cli.IntFlag{
+		Name:  "cid-version",
+		Value: defaultCIDVersion,
+		Usage: "with --cid, CID version 0, or 1 with raw leaves like 'ipfs add --cid-version 1', default: 0",
+	},
+	cli.BoolFlag{
+		Name:  "store-cid",
+		Usage: "with --cid, save the CID in the tags of the objects so that later calls do not read them",
+	},
+}
+
+// objectCIDOptions is how the UnixFS CID of objects is computed.
+type objectCIDOptions struct {
+	alias     string
+	chunkSize int64
+	version   int
+	store     bool
+}
+
+// parseCIDFlags returns the CID options of the command line, nil without --cid.
+func parseCIDFlags(cliCtx *cli.Context) *objectCIDOptions {
+	if !cliCtx.Bool("cid") {
+		return nil
+	}
+	opts := &objectCIDOptions{
+		chunkSize: cliCtx.Int64("cid-chunk-size"),
+		version:   cliCtx.Int("cid-version"),
+		store:     cliCtx.Bool("store-cid"),
+	}
+	if opts.chunkSize <= 0 {
+		fatalIf(errInvalidArgument().Trace(cliCtx.String("cid-chunk-size")), "Please provide a positive chunk size.")
+	}
+	if opts.version != 0 && opts.version != 1 {
+		fatalIf(errInvalidArgument().Trace(cliCtx.String("cid-version")), "Please provide a CID version of 0 or 1.")
+	}
+	return opts
+}
+
+// cidDAGService drops the nodes of a DAG, only its root CID is needed.
+type cidDAGService struct{}
+
+func (cidDAGService) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return nil, ipld.ErrNotFound
+}
+
+func (cidDAGService) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	nodes := make(chan *ipld.NodeOption)
+	close(nodes)
+	return nodes
+}
+
+func (cidDAGService) Add(ctx context.Context, node ipld.Node) error {
+	return nil
+}
+
+func (cidDAGService) AddMany(ctx context.Context, nodes []ipld.Node) error {
+	return nil
+}
+
+func (cidDAGService) Remove(ctx context.Context, c cid.Cid) error {
+	return nil
+}
+
+func (cidDAGService) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return nil
+}
+
+// buildUnixFSFile streams data through the UnixFS DAG builder, the nodes of
+// the DAG are added to dagServ, and returns its root.
+func buildUnixFSFile(reader io.Reader, chunkSize int64, version int, dagServ ipld.DAGService) (ipld.Node, *probe.Error) {
+	prefix, e := merkledag.PrefixForCidVersion(version)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(strconv.Itoa(version))
+	}
+	params := helpers.DagBuilderParams{
+		Maxlinks:   unixfsLinksPerLevel,
+		RawLeaves:  version == 1,
+		CidBuilder: prefix,
+		Dagserv:    dagServ,
+	}
+	db, e := params.New(chunker.NewSizeSplitter(reader, chunkSize))
+	if e != nil {
+		return nil, probe.NewError(e)
+	}
+	node, e := balanced.Layout(db)
+	if e != nil {
+		return nil, probe.NewError(e)
+	}
+	return node, nil
+}
+
+// computeUnixFSCID streams data through the UnixFS DAG builder and returns
+// the root CID.
+func computeUnixFSCID(reader io.Reader, chunkSize int64, version int) (string, *probe.Error) {
+	node, err := buildUnixFSFile(reader, chunkSize, version, cidDAGService{})
+	if err != nil {
+		return "", err
+	}
+	return node.Cid().String(), nil
+}
+
+// cachedObjectCID returns the CID in the tags of an object, when it was
+// computed with the same options.
+func cachedObjectCID(tags map[string]string, opts objectCIDOptions) string {
+	value := tags[filUnixfsCidTag]
+	if value == "" || tags[filUnixfsChunkTag] != strconv.FormatInt(opts.chunkSize, 10) {
+		return ""
+	}
+	c, e := cid.Decode(value)
+	if e != nil || c.Version() != uint64(opts.version) {
+		return ""
+	}
+	return value
+}
+
+// objectCID returns the UnixFS CID of an object version, from its tags when
+// cached there, by reading the object else.
+func objectCID(ctx context.Context, urlStr, versionID string, sse encrypt.ServerSide, opts objectCIDOptions) (string, *probe.Error) {
+	clnt, err := newClientFromAlias(opts.alias, urlStr)
+	if err != nil {
+		return "", err.Trace(urlStr)
+	}
+	// Tags are not supported by every backend, the CID is computed then.
+	if tags, err := clnt.GetTags(ctx, versionID); err == nil {
+		if value := cachedObjectCID(tags, opts); value != "" {
+			return value, nil
+		}
+	}
+
+	reader, err := clnt.Get(ctx, GetOptions{VersionID: versionID, SSE: sse})
+	if err != nil {
+		return "", err.Trace(urlStr)
+	}
+	defer reader.Close()
+	value, err := computeUnixFSCID(reader, opts.chunkSize, opts.version)
+	if err != nil {
+		return "", err.Trace(urlStr)
+	}
+
+	if opts.store {
+		err = mergeObjectTags(ctx, clnt, versionID, map[string]string{
+			filUnixfsCidTag:   value,
+			filUnixfsChunkTag: strconv.FormatInt(opts.chunkSize, 10),
+		})
+		errorIf(err.Trace(urlStr), "Unable to save the CID of `"+urlStr+"`.")
+	}
+	return value, nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComputeUnixFSCID(t *testing.T) {
+	testCases := []struct {
+		version  int
+		expected string
+	}{
+		{0, "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+		{1, "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"},
+	}
+	for i, testCase := range testCases {
+		value, err := computeUnixFSCID(strings.NewReader("hello world\n"), defaultCIDChunkSize, testCase.version)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if value != testCase.expected {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.expected, value)
+		}
+	}
+}
+
+func TestCachedObjectCID(t *testing.T) {
+	opts := objectCIDOptions{chunkSize: defaultCIDChunkSize}
+	testCases := []struct {
+		tags     map[string]string
+		version  int
+		expected string
+	}{
+		{map[string]string{filUnixfsCidTag: "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o", filUnixfsChunkTag: "1048576"}, 0, "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+		{map[string]string{filUnixfsCidTag: "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o", filUnixfsChunkTag: "1048576"}, 1, ""},
+		{map[string]string{filUnixfsCidTag: "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o", filUnixfsChunkTag: "262144"}, 0, ""},
+		{map[string]string{filDataCidTag: "bafybeidata"}, 0, ""},
+	}
+	for i, testCase := range testCases {
+		opts.version = testCase.version
+		if value := cachedObjectCID(testCase.tags, opts); value != testCase.expected {
+			t.Errorf("Test %d: expected %q, got %q", i+1, testCase.expected, value)
+		}
+	}
+}
+
+func TestStatObjectURL(t *testing.T) {
+	testCases := []struct {
+		targetURL string
+		path      string
+		expected  string
+	}{
+		{"myminio/bucket/object", "object", "myminio/bucket/object"},
+		{"myminio/bucket/", "prefix/object", "myminio/bucket/prefix/object"},
+		{"myminio/bucket", "bucket/object", "myminio/bucket/object"},
+	}
+	for i, testCase := range testCases {
+		content := &ClientContent{URL: ClientURL{Type: objectStorage, Path: testCase.path, Separator: '/'}}
+		if objectURL := statObjectURL(testCase.targetURL, content); objectURL != testCase.expected {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.expected, objectURL)
+		}
+	}
+}
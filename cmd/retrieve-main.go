@@ -0,0 +1,527 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+)
+
+var retrieveFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "from",
+		EnvVar: "FIL_WALLET",
+		Usage:  "specify filecoin wallet paying for the retrieval, default: $FIL_WALLET or the default wallet of lotus",
+	},
+	cli.StringFlag{
+		Name:  "miner",
+		Usage: "specify the miner to retrieve from, the cheapest offer is taken otherwise",
+	},
+	cli.StringFlag{
+		Name:  "max-price",
+		Usage: "specify the maximum price of a retrieval in FIL, or with a unit like '500 nanoFIL'",
+	},
+	cli.BoolFlag{
+		Name:  "car",
+		Usage: "keep the raw CAR file instead of the files it holds",
+	},
+	cli.StringFlag{
+		Name:  "input",
+		Usage: "specify a deal csv, every data-cid of it is retrieved under the TARGET prefix",
+	},
+	cli.StringFlag{
+		Name:  "staging-dir",
+		Usage: "specify where the lotus node writes the retrieved data, default: the system temporary directory",
+	},
+}
+
+var retrieveCmd = cli.Command{
+	Name:         "retrieve",
+	Usage:        "retrieve data from filecoin",
+	Action:       mainRetrieve,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(retrieveFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] DATA-CID TARGET
+  {{.HelpName}} [FLAGS] --input CSV-FILE TARGET
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Retrieve data through the lotus node and copy it to TARGET, a local path or any mc
+  URL. The lotus node writes the data into --staging-dir, which mc must be able to
+  read, it is removed once copied. A TARGET ending with '/' is a prefix the data is
+  copied under, named after its data CID. Data holding several files is always
+  copied under TARGET.
+
+  With --input, every data CID of a deal csv written by 'send' or of a manifest is
+  retrieved under the TARGET prefix, from the miner of its row unless --miner is set.
+  When that miner fails, the miners of the other rows of the same data CID are tried
+  in turn.
+
+EXAMPLES:
+  1. Retrieve a file into a bucket.
+     {{.Prompt}} {{.HelpName}} bafykbzacea4thudbvwcdy4qmhpaxobw7ytkhtx5vgzj5z2q6mzobqyyyfnvnk myminio/restore/test.zip
+
+  2. Retrieve the raw CAR file from a given miner, paying at most 0.001 FIL.
+     {{.Prompt}} {{.HelpName}} --car --miner f01234 --max-price 0.001 bafykbzacea4thudbvwcdy4qmhpaxobw7ytkhtx5vgzj5z2q6mzobqyyyfnvnk /data/restore/
+
+  3. Retrieve every piece of a batch to test its restore.
+     {{.Prompt}} {{.HelpName}} --input /data/car/dealMetadata-5a3c8f21.csv myminio/restore-test/
+`,
+}
+
+// retrieveMessage container for retrieve messages.
+type retrieveMessage struct {
+	Status  string `json:"status"`
+	DataCid string `json:"dataCid"`
+	Miner   string `json:"miner"`
+	Price   string `json:"price"`
+	Size    int64  `json:"size"`
+	Target  string `json:"target"`
+}
+
+// JSON jsonified retrieve message.
+func (r retrieveMessage) JSON() string {
+	retrieveJSONBytes, e := json.MarshalIndent(r, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(retrieveJSONBytes)
+}
+
+// String colorized retrieve message.
+func (r retrieveMessage) String() string {
+	return fmt.Sprintf("DataCid: %s, Miner: %s, Price: %s FIL, Size: %s, Target: %s", r.DataCid, r.Miner, r.Price, humanize.IBytes(uint64(r.Size)), r.Target)
+}
+
+// retrieveRequest is a retrieval of some data into a target.
+type retrieveRequest struct {
+	DataCid  string
+	PieceCid string
+	Miner    string
+	Wallet   string
+	MaxPrice *big.Int
+	Car      bool
+	Target   string
+	// Replicas are the other miners storing the data, tried in turn when
+	// the retrieval from Miner fails.
+	Replicas []string
+}
+
+// offerPrice returns the total price of a retrieval offer in attoFIL.
+func offerPrice(offer lotusQueryOffer) (*big.Int, *probe.Error) {
+	price := new(big.Int)
+	for _, amount := range []string{offer.MinPrice, offer.UnsealPrice} {
+		if amount == "" {
+			continue
+		}
+		attoFIL, ok := new(big.Int).SetString(amount, 10)
+		if !ok {
+			return nil, errInvalidArgument().Trace(amount)
+		}
+		price.Add(price, attoFIL)
+	}
+	return price, nil
+}
+
+// pickRetrievalOffer returns the cheapest offer costing at most maxPrice,
+// if not nil.
+func pickRetrievalOffer(dataCid string, offers []lotusQueryOffer, maxPrice *big.Int) (*lotusQueryOffer, *probe.Error) {
+	var best *lotusQueryOffer
+	var bestPrice *big.Int
+	reason := "no offer"
+	for i := range offers {
+		if offers[i].Err != "" {
+			reason = offers[i].Err
+			continue
+		}
+		price, err := offerPrice(offers[i])
+		if err != nil {
+			reason = "invalid price " + err.ToGoError().Error()
+			continue
+		}
+		if maxPrice != nil && price.Cmp(maxPrice) > 0 {
+			reason = "the offers exceed the maximum price of " + formatFIL(maxPrice) + " FIL"
+			continue
+		}
+		if best == nil || price.Cmp(bestPrice) < 0 {
+			best, bestPrice = &offers[i], price
+		}
+	}
+	if best == nil {
+		return nil, errNoRetrievalOffer(dataCid, reason).Trace(dataCid)
+	}
+	return best, nil
+}
+
+// newRetrievalOrder returns the order accepting an offer.
+func newRetrievalOrder(offer *lotusQueryOffer, wallet string) *lotusRetrievalOrder {
+	peer := offer.MinerPeer
+	return &lotusRetrievalOrder{
+		Root:                    offer.Root,
+		Piece:                   offer.Piece,
+		Size:                    offer.Size,
+		Total:                   offer.MinPrice,
+		UnsealPrice:             offer.UnsealPrice,
+		PaymentInterval:         offer.PaymentInterval,
+		PaymentIntervalIncrease: offer.PaymentIntervalIncrease,
+		Client:                  wallet,
+		Miner:                   offer.Miner,
+		MinerPeer:               &peer,
+	}
+}
+
+// putRetrievedFile copies a local file to a target URL with a progress bar.
+func putRetrievedFile(ctx context.Context, filePath, targetURL string) (int64, *probe.Error) {
+	file, e := os.Open(filePath)
+	if e != nil {
+		return 0, probe.NewError(e).Trace(filePath)
+	}
+	defer file.Close()
+	st, e := file.Stat()
+	if e != nil {
+		return 0, probe.NewError(e).Trace(filePath)
+	}
+
+	alias, urlStrFull, _, err := expandAlias(targetURL)
+	if err != nil {
+		return 0, err.Trace(targetURL)
+	}
+	// A nil *progressBar would not be a nil io.Reader.
+	var progress io.Reader
+	if !globalQuiet && !globalJSON {
+		bar := newProgressBar(st.Size())
+		bar.SetCaption(targetURL)
+		defer bar.Finish()
+		progress = bar
+	}
+	opts := PutOptions{metadata: map[string]string{"Content-Type": guessURLContentType(targetURL)}}
+	n, err := putTargetStream(ctx, alias, urlStrFull, "", "", "", file, st.Size(), progress, opts)
+	if err != nil {
+		return n, err.Trace(filePath)
+	}
+	return n, nil
+}
+
+// uploadRetrieved copies retrieved data to a target URL, the files of a
+// retrieved directory are copied under it.
+func uploadRetrieved(ctx context.Context, stagedPath, targetURL string) (int64, *probe.Error) {
+	st, e := os.Stat(stagedPath)
+	if e != nil {
+		return 0, probe.NewError(e).Trace(stagedPath)
+	}
+	if !st.IsDir() {
+		return putRetrievedFile(ctx, stagedPath, targetURL)
+	}
+
+	var size int64
+	var err *probe.Error
+	e = filepath.Walk(stagedPath, func(filePath string, info os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, e := filepath.Rel(stagedPath, filePath)
+		if e != nil {
+			return e
+		}
+		var n int64
+		n, err = putRetrievedFile(ctx, filePath, urlJoinPath(targetURL, filepath.ToSlash(relPath)))
+		size += n
+		if err != nil {
+			return err.ToGoError()
+		}
+		return nil
+	})
+	if err != nil {
+		return size, err.Trace(stagedPath)
+	}
+	if e != nil {
+		return size, probe.NewError(e).Trace(stagedPath)
+	}
+	return size, nil
+}
+
+// retrieveData retrieves data through lotus into the staging directory and
+// copies it to its target.
+func retrieveData(ctx context.Context, api *lotusClient, stagingDir string, req retrieveRequest) (retrieveMessage, *probe.Error) {
+	msg := retrieveMessage{Status: "success", DataCid: req.DataCid, Target: req.Target}
+	var pieceCid *lotusCid
+	if req.PieceCid != "" {
+		pieceCid = &lotusCid{Root: req.PieceCid}
+	}
+
+	var offers []lotusQueryOffer
+	if req.Miner != "" {
+		offer, err := api.ClientMinerQueryOffer(ctx, req.Miner, req.DataCid, pieceCid)
+		if err != nil {
+			return msg, err.Trace(req.DataCid)
+		}
+		offers = append(offers, *offer)
+	} else {
+		var err *probe.Error
+		if offers, err = api.ClientFindData(ctx, req.DataCid, pieceCid); err != nil {
+			return msg, err.Trace(req.DataCid)
+		}
+	}
+	offer, err := pickRetrievalOffer(req.DataCid, offers, req.MaxPrice)
+	if err != nil {
+		return msg, err.Trace(req.DataCid)
+	}
+	price, _ := offerPrice(*offer)
+	msg.Miner = offer.Miner
+	msg.Price = formatFIL(price)
+
+	stagedPath := filepath.Join(stagingDir, req.DataCid)
+	if req.Car {
+		stagedPath += ".car"
+	}
+	if e := os.MkdirAll(stagingDir, 0700); e != nil {
+		return msg, probe.NewError(e).Trace(stagingDir)
+	}
+	// Leftovers of an interrupted retrieval would be mixed with the data.
+	if e := os.RemoveAll(stagedPath); e != nil {
+		return msg, probe.NewError(e).Trace(stagedPath)
+	}
+	defer os.RemoveAll(stagedPath)
+
+	order := newRetrievalOrder(offer, req.Wallet)
+	stopProgress := showRetrievalProgress(ctx, api, req.DataCid, offer.MinerPeer.ID, offer.Size)
+	err = api.ClientRetrieve(ctx, order, lotusFileRef{Path: stagedPath, IsCAR: req.Car})
+	stopProgress()
+	if err != nil {
+		return msg, err.Trace(req.DataCid)
+	}
+	if msg.Size, err = uploadRetrieved(ctx, stagedPath, req.Target); err != nil {
+		return msg, err.Trace(req.DataCid)
+	}
+	return msg, nil
+}
+
+// retrieveFromReplicas retrieves data from the miner of the request, then
+// from the miners of its other replicas until one of them succeeds.
+func retrieveFromReplicas(ctx context.Context, api *lotusClient, stagingDir string, req retrieveRequest) (retrieveMessage, *probe.Error) {
+	msg, err := retrieveData(ctx, api, stagingDir, req)
+	for _, miner := range req.Replicas {
+		if err == nil {
+			break
+		}
+		errorIf(err, "Unable to retrieve `"+req.DataCid+"` from `"+req.Miner+"`, trying `"+miner+"`.")
+		req.Miner = miner
+		msg, err = retrieveData(ctx, api, stagingDir, req)
+	}
+	return msg, err
+}
+
+// retrievalPollInterval is how often the progress of a retrieval is polled.
+var retrievalPollInterval = time.Second
+
+// retrievalProgress returns the bytes received by the latest retrieval of
+// some data from a miner peer, any peer if empty.
+func retrievalProgress(retrievals []lotusRetrievalInfo, dataCid, peerID string) (uint64, bool) {
+	var latest *lotusRetrievalInfo
+	for i := range retrievals {
+		retrieval := &retrievals[i]
+		if retrieval.PayloadCID.Root != dataCid || (peerID != "" && retrieval.Provider != peerID) {
+			continue
+		}
+		if latest == nil || retrieval.ID > latest.ID {
+			latest = retrieval
+		}
+	}
+	if latest == nil {
+		return 0, false
+	}
+	return latest.BytesReceived, true
+}
+
+// showRetrievalProgress shows a progress bar of the bytes received by the
+// lotus node until the returned function is called. Lotus nodes without
+// ClientListRetrievals show no progress.
+func showRetrievalProgress(ctx context.Context, api *lotusClient, dataCid, peerID string, size uint64) func() {
+	if globalQuiet || globalJSON {
+		return func() {}
+	}
+	bar := newProgressBar(int64(size))
+	bar.SetCaption("retrieving " + dataCid)
+
+	doneCh := make(chan struct{})
+	stoppedCh := make(chan struct{})
+	go func() {
+		defer close(stoppedCh)
+		ticker := time.NewTicker(retrievalPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-doneCh:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			retrievals, err := api.ClientListRetrievals(ctx)
+			if err != nil {
+				return
+			}
+			if received, ok := retrievalProgress(retrievals, dataCid, peerID); ok {
+				bar.Set64(int64(received))
+			}
+		}
+	}()
+	return func() {
+		close(doneCh)
+		<-stoppedCh
+		bar.Finish()
+	}
+}
+
+// retrieveTarget returns where the data is copied, a target ending with a
+// separator is a prefix.
+func retrieveTarget(target, dataCid string, car bool) string {
+	if !strings.HasSuffix(target, "/") && !strings.HasSuffix(target, string(filepath.Separator)) {
+		return target
+	}
+	name := dataCid
+	if car {
+		name += ".car"
+	}
+	return urlJoinPath(target, name)
+}
+
+// checkRetrieveArgs returns the retrievals asked on the command line.
+func checkRetrieveArgs(ctx *cli.Context) ([]retrieveRequest, string) {
+	args := ctx.Args()
+	for _, arg := range args {
+		if strings.TrimSpace(arg) == "" {
+			fatalIf(errInvalidArgument().Trace(args...), "Unable to validate empty argument.")
+		}
+	}
+	input := strings.TrimSpace(ctx.String("input"))
+	if (input == "" && len(args) != 2) || (input != "" && len(args) != 1) {
+		cli.ShowCommandHelpAndExit(ctx, "retrieve", globalErrorExitStatus)
+	}
+
+	var maxPrice *big.Int
+	if price := strings.TrimSpace(ctx.String("max-price")); price != "" {
+		var err *probe.Error
+		maxPrice, err = parseFIL(price)
+		if err != nil || maxPrice.Sign() < 0 {
+			fatalIf(errInvalidArgument().Trace(price), "please provide a valid max-price")
+		}
+	}
+	car := ctx.Bool("car")
+	miner := strings.TrimSpace(ctx.String("miner"))
+
+	stagingDir := strings.TrimSpace(ctx.String("staging-dir"))
+	if stagingDir == "" {
+		stagingDir = filepath.Join(os.TempDir(), "mc-retrieve")
+	}
+	stagingDir, e := filepath.Abs(stagingDir)
+	if e != nil {
+		fatalIf(probe.NewError(e).Trace(stagingDir), "Unable to find the staging directory.")
+	}
+
+	if input == "" {
+		dataCid := strings.TrimSpace(args.Get(0))
+		return []retrieveRequest{{
+			DataCid:  dataCid,
+			Miner:    miner,
+			MaxPrice: maxPrice,
+			Car:      car,
+			Target:   retrieveTarget(args.Get(1), dataCid, car),
+		}}, stagingDir
+	}
+
+	deals, err := readDealCsv(input)
+	fatalIf(err, "Unable to read `"+input+"`.")
+	prefix := args.Get(0)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return retrieveRequestsFromDeals(deals, prefix, miner, maxPrice, car), stagingDir
+}
+
+// retrieveRequestsFromDeals returns the retrievals of the data CIDs of a
+// deal csv under a prefix. Replicas of a piece have their own row, it is
+// retrieved once, from the miner of its first row then from the others.
+func retrieveRequestsFromDeals(deals []*OfflineDeal, prefix, miner string, maxPrice *big.Int, car bool) []retrieveRequest {
+	var requests []retrieveRequest
+	rows := make(map[string]int)
+	miners := make(map[string]bool)
+	for _, deal := range deals {
+		if deal.DataCid == "" {
+			continue
+		}
+		if i, ok := rows[deal.DataCid]; ok {
+			if miner == "" && deal.MinerId != "" && !miners[deal.DataCid+"/"+deal.MinerId] {
+				miners[deal.DataCid+"/"+deal.MinerId] = true
+				requests[i].Replicas = append(requests[i].Replicas, deal.MinerId)
+			}
+			continue
+		}
+		rows[deal.DataCid] = len(requests)
+		miners[deal.DataCid+"/"+deal.MinerId] = true
+		req := retrieveRequest{
+			DataCid:  deal.DataCid,
+			PieceCid: deal.PieceCid,
+			Miner:    deal.MinerId,
+			MaxPrice: maxPrice,
+			Car:      car,
+			Target:   retrieveTarget(prefix, deal.DataCid, car),
+		}
+		if miner != "" {
+			req.Miner = miner
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// mainRetrieve is the handle for "mc retrieve" command.
+func mainRetrieve(cliCtx *cli.Context) error {
+	ctx, cancelRetrieve := context.WithCancel(globalContext)
+	defer cancelRetrieve()
+
+	requests, stagingDir := checkRetrieveArgs(cliCtx)
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	wallet := strings.TrimSpace(cliCtx.String("from"))
+	if wallet == "" {
+		wallet, err = api.WalletDefaultAddress(ctx)
+		fatalIf(err, "Unable to get the default wallet of lotus, please provide a wallet with --from.")
+	}
+
+	failed := false
+	for _, req := range requests {
+		req.Wallet = wallet
+		msg, err := retrieveFromReplicas(ctx, api, stagingDir, req)
+		if err != nil {
+			errorIf(err, "Unable to retrieve `"+req.DataCid+"`.")
+			failed = true
+			continue
+		}
+		printMsg(msg)
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
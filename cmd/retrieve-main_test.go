@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPickRetrievalOffer(t *testing.T) {
+	offers := []lotusQueryOffer{
+		{Miner: "f01000", Err: "miner is offline"},
+		{Miner: "f01001", MinPrice: "3000", UnsealPrice: "0"},
+		{Miner: "f01002", MinPrice: "1000", UnsealPrice: "1500"},
+	}
+	testCases := []struct {
+		offers   []lotusQueryOffer
+		maxPrice *big.Int
+		miner    string
+	}{
+		{offers, nil, "f01002"},
+		{offers, big.NewInt(2500), "f01002"},
+		{offers, big.NewInt(2000), ""},
+		{offers[:1], nil, ""},
+		{nil, nil, ""},
+	}
+	for i, testCase := range testCases {
+		offer, err := pickRetrievalOffer("bafk2bzacea", testCase.offers, testCase.maxPrice)
+		if testCase.miner == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected no offer, got %s", i+1, offer.Miner)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if offer.Miner != testCase.miner {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.miner, offer.Miner)
+		}
+	}
+}
+
+func TestRetrieveTarget(t *testing.T) {
+	testCases := []struct {
+		target   string
+		car      bool
+		expected string
+	}{
+		{"myminio/restore/test.zip", false, "myminio/restore/test.zip"},
+		{"myminio/restore/", false, "myminio/restore/bafk2bzacea"},
+		{"myminio/restore/", true, "myminio/restore/bafk2bzacea.car"},
+	}
+	for i, testCase := range testCases {
+		if target := retrieveTarget(testCase.target, "bafk2bzacea", testCase.car); target != testCase.expected {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.expected, target)
+		}
+	}
+}
+
+func TestUploadRetrieved(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	savedQuiet := globalQuiet
+	globalQuiet = true
+	defer func() { globalQuiet = savedQuiet }()
+
+	dir, e := ioutil.TempDir("", "mc-retrieve")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	stagedPath := filepath.Join(dir, "staging", "bafk2bzacea")
+	files := map[string]string{
+		"a.txt":     "hello",
+		"sub/b.txt": "world!",
+	}
+	for name, data := range files {
+		filePath := filepath.Join(stagedPath, filepath.FromSlash(name))
+		if e = os.MkdirAll(filepath.Dir(filePath), 0700); e != nil {
+			t.Fatal(e)
+		}
+		if e = ioutil.WriteFile(filePath, []byte(data), 0600); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	target := filepath.Join(dir, "restore")
+	size, err := uploadRetrieved(context.Background(), stagedPath, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 11 {
+		t.Errorf("expected 11 bytes copied, got %d", size)
+	}
+	for name, data := range files {
+		got, e := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if string(got) != data {
+			t.Errorf("expected %q in %s, got %q", data, name, got)
+		}
+	}
+}
+
+func TestRetrieveRequestsFromDeals(t *testing.T) {
+	deals := []*OfflineDeal{
+		{DataCid: "bafy1", MinerId: "f01000"},
+		{DataCid: "bafy2", MinerId: "f01000"},
+		{DataCid: "bafy1", MinerId: "f01001"},
+		{DataCid: "bafy1", MinerId: "f01000"},
+		{DataCid: "bafy1", MinerId: "f01002"},
+		{DataCid: ""},
+	}
+	requests := retrieveRequestsFromDeals(deals, "myminio/restore/", "", nil, false)
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 retrievals, got %d", len(requests))
+	}
+	if requests[0].Miner != "f01000" || !reflect.DeepEqual(requests[0].Replicas, []string{"f01001", "f01002"}) {
+		t.Errorf("unexpected retrieval %+v", requests[0])
+	}
+	if requests[1].Target != "myminio/restore/bafy2" || len(requests[1].Replicas) != 0 {
+		t.Errorf("unexpected retrieval %+v", requests[1])
+	}
+
+	// A miner set on the command line is the only one tried.
+	requests = retrieveRequestsFromDeals(deals, "myminio/restore/", "f09999", nil, false)
+	if requests[0].Miner != "f09999" || len(requests[0].Replicas) != 0 {
+		t.Errorf("unexpected retrieval %+v", requests[0])
+	}
+}
+
+func TestRetrievalProgress(t *testing.T) {
+	retrievals := []lotusRetrievalInfo{
+		{PayloadCID: lotusCid{Root: "bafy1"}, ID: 1, Provider: "12D3KooWA", BytesReceived: 100},
+		{PayloadCID: lotusCid{Root: "bafy1"}, ID: 3, Provider: "12D3KooWA", BytesReceived: 20},
+		{PayloadCID: lotusCid{Root: "bafy1"}, ID: 4, Provider: "12D3KooWB", BytesReceived: 50},
+		{PayloadCID: lotusCid{Root: "bafy2"}, ID: 5, Provider: "12D3KooWA", BytesReceived: 70},
+	}
+	testCases := []struct {
+		dataCid  string
+		peerID   string
+		received uint64
+		ok       bool
+	}{
+		{"bafy1", "12D3KooWA", 20, true},
+		{"bafy1", "", 50, true},
+		{"bafy2", "12D3KooWB", 0, false},
+		{"bafy3", "", 0, false},
+	}
+	for i, testCase := range testCases {
+		received, ok := retrievalProgress(retrievals, testCase.dataCid, testCase.peerID)
+		if received != testCase.received || ok != testCase.ok {
+			t.Errorf("Test %d: expected (%d, %v), got (%d, %v)", i+1, testCase.received, testCase.ok, received, ok)
+		}
+	}
+}
+
+func TestRetrieveFromReplicas(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	savedQuiet := globalQuiet
+	globalQuiet = true
+	defer func() { globalQuiet = savedQuiet }()
+
+	dir, e := ioutil.TempDir("", "mc-retrieve")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	// f01000 is offline, f01001 serves the data.
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientMinerQueryOffer": func(params []json.RawMessage) interface{} {
+			var miner string
+			json.Unmarshal(params[0], &miner)
+			if miner != "f01001" {
+				return lotusQueryOffer{Err: "miner is offline"}
+			}
+			return lotusQueryOffer{
+				Root:      lotusCid{Root: "bafy1"},
+				Size:      12,
+				MinPrice:  "0",
+				Miner:     miner,
+				MinerPeer: lotusRetrievalPeer{ID: "12D3KooWA"},
+			}
+		},
+		"Filecoin.ClientRetrieve": func(params []json.RawMessage) interface{} {
+			var ref lotusFileRef
+			json.Unmarshal(params[1], &ref)
+			ioutil.WriteFile(ref.Path, []byte("hello world\n"), 0600)
+			return nil
+		},
+	})
+	defer server.Close()
+	api := newLotusClient(server.URL, "")
+
+	testCases := []struct {
+		req   retrieveRequest
+		miner string
+	}{
+		{retrieveRequest{DataCid: "bafy1", Miner: "f01000", Replicas: []string{"f01002", "f01001"}}, "f01001"},
+		{retrieveRequest{DataCid: "bafy1", Miner: "f01001"}, "f01001"},
+		{retrieveRequest{DataCid: "bafy1", Miner: "f01000", Replicas: []string{"f01002"}}, ""},
+	}
+	for i, testCase := range testCases {
+		testCase.req.Target = filepath.Join(dir, "restore", string(rune('a'+i)))
+		msg, err := retrieveFromReplicas(context.Background(), api, filepath.Join(dir, "staging"), testCase.req)
+		if testCase.miner == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected the retrieval to fail, got %+v", i+1, msg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if msg.Miner != testCase.miner || msg.Size != 12 {
+			t.Errorf("Test %d: expected 12 bytes from %s, got %+v", i+1, testCase.miner, msg)
+		}
+		data, e := ioutil.ReadFile(testCase.req.Target)
+		if e != nil || string(data) != "hello world\n" {
+			t.Errorf("Test %d: unexpected data %q, %v", i+1, data, e)
+		}
+	}
+}
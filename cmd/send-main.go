@@ -2,29 +2,27 @@ package cmd
 
 import (
 	"context"
-	"flag"
 	"fmt"
-	"github.com/filswan/fs3-mc/logs"
 	"github.com/filswan/fs3-mc/pkg/probe"
 	"github.com/google/uuid"
 	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
 	csv "github.com/minio/minio/pkg/csvparser"
-	"io/ioutil"
 	"math/big"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 var (
 	defaultStart          = 7
 	defaultDuration       = 360
-	epochPerHour          = 120
 	GiBToByte             = 1024 * 1024 * 1024
-	aliasName             = "swanminio"
+	attoFILPerFIL         = big.NewInt(1000000000000000000)
+	deprecatedUploadAlias = "swanminio"
 	defaultOnlineDuration = "1036800"
 	defaultVerifiedDeal   = "false"
 	defaultFastRetrieval  = "true"
@@ -41,8 +39,13 @@ type OfflineDeal struct {
 	Duration      string
 	StartEpoch    string
 	FastRetrieval bool
+	VerifiedDeal  bool
 	DealCid       string
 	Filename      string
+	CarUrl        string
+	CarUrlExpiry  string
+	Detail        string
+	TaskId        string
 }
 
 type OnlineDeal struct {
@@ -70,7 +73,7 @@ var sendCmd = cli.Command{
 	OnUsageError: onUsageError,
 	Before:       setGlobalsFromContext,
 	Subcommands:  nil,
-	Flags:        sendFlags,
+	Flags:        append(append(sendFlags, sendAutoMinerFlags...), uploadFlags...),
 }
 
 var sendOnlineCmd = cli.Command{
@@ -95,19 +98,69 @@ func mainSendOnline(ctx *cli.Context) error {
 		Cost:          price,
 		Duration:      duration,
 	}
-	proposeOnlineDeal(onlineDealConfigs)
+
+	api, err := newLotusClientFromConfig()
+	fatalIf(err, "Unable to connect to lotus.")
+
+	sendCtx, cancelSend := context.WithCancel(globalContext)
+	defer cancelSend()
+
+	dealCid, err := proposeOnlineDeal(sendCtx, api, onlineDealConfigs)
+	fatalIf(err, "Unable to propose deal to miner `"+miner+"`.")
+
+	if tagSource := ctx.String("tag-source"); tagSource != "" {
+		err = tagDealObject(sendCtx, tagSource, map[string]string{
+			filDataCidTag: datacid,
+			filDealCidTag: dealCid,
+			filMinerTag:   miner,
+		})
+		fatalIf(err, "Unable to tag `"+tagSource+"`.")
+	}
 
 	return nil
 }
 
 func mainSend(ctx *cli.Context) error {
 
-	wallet, start, duration, miner, inputPath, price := checkSendArgs(ctx)
+	wallet, start, duration, minerIDs, inputPath, price, replicas := checkSendArgs(ctx)
+
+	// A dry run only prints the deals and their cost, lotus is not needed.
+	dryRun := ctx.Bool("dry-run")
+	var api *lotusClient
+	var err *probe.Error
+	if !dryRun {
+		api, err = newLotusClientFromConfig()
+		fatalIf(err, "Unable to connect to lotus.")
+	}
+
+	sendCtx, cancelSend := context.WithCancel(globalContext)
+	defer cancelSend()
+
+	network, err := loadNetwork(ctx.String("network"))
+	fatalIf(err, "Unable to load the network profile.")
+	if !ctx.IsSet("start") && network.DefaultStart > 0 {
+		start = network.DefaultStart
+	}
+	if !ctx.IsSet("duration") && network.DefaultDuration > 0 {
+		duration = network.DefaultDuration
+	}
+	if ctx.Bool("check-epoch") {
+		if api == nil {
+			api, err = newLotusClientFromConfig()
+			fatalIf(err, "Unable to connect to lotus.")
+		}
+		local, head, err := checkChainEpoch(sendCtx, api, network)
+		fatalIf(err, "Unable to get the chain head.")
+		if drift := local - head; drift > maxEpochDrift || drift < -maxEpochDrift {
+			errorIf(errEpochDrift(local, head).Trace(), "Local clock is off, check --network or the system time.")
+		}
+	}
 
 	var dealConfigs []*OfflineDeal
 	dealCsvPath := ""
 	if len(inputPath) != 0 {
-		dealConfigs = readCsv(inputPath)
+		dealConfigs, err = readDealCsv(inputPath)
+		fatalIf(err, "Unable to read `"+inputPath+"`.")
 		asbInputPath, err := filepath.Abs(inputPath)
 		if err != nil {
 			fatalIf(errInvalidArgument().Trace(inputPath), "please provide a valid input path")
@@ -127,26 +180,405 @@ func mainSend(ctx *cli.Context) error {
 		dealConfigs = []*OfflineDeal{deal}
 	}
 
-	for _, dealConfig := range dealConfigs {
-		dealConfig.MinerId = miner
-		dealConfig.SenderWallet = wallet
-		dealConfig.StartEpoch = strconv.FormatUint(uint64(calculateStartEpoch(start)), 10)
-		dealConfig.Duration = strconv.FormatUint(uint64(calculateDuration(duration)), 10)
-		dealConfig.Cost = calculateCost(price, dealConfig.PieceSize).String()
-		proposeOfflineDeal(dealConfig)
+	// With --continue the progress of the batch is kept in a session: the
+	// rows sent before an interruption are skipped, and the deals already in
+	// the deal csv of the session count as replicas of their piece.
+	var session *sessionV8
+	var sent map[string][]*OfflineDeal
+	if ctx.Bool("continue") && !dryRun {
+		session, err = newSendSession(ctx, dealCsvPath)
+		fatalIf(err, "Unable to load session.")
+		dealCsvPath = session.Header.CommandStringFlags["output"]
+		sent, err = sentDeals(dealCsvPath)
+		fatalIf(err, "Unable to read `"+dealCsvPath+"`.")
+	}
+
+	// The CAR files are uploaded before any deal is proposed, so that an
+	// interrupted upload is resumed by running the same command again.
+	if uploadTo := ctx.String("upload-to"); uploadTo != "" && !dryRun {
+		carDir := filepath.Dir(inputPath)
+		var carPaths []string
+		carDeals := make(map[string]*OfflineDeal)
+		for _, dealConfig := range dealConfigs {
+			carPath := findSliceCar(carDir, dealConfig)
+			if carPath == "" {
+				errorIf(errInvalidArgument().Trace(dealConfig.DataCid), "No CAR file for `"+dealConfig.DataCid+"` in `"+carDir+"`, not uploading it.")
+				continue
+			}
+			carPaths = append(carPaths, carPath)
+			carDeals[carPath] = dealConfig
+		}
+		if len(carPaths) > 0 {
+			err = uploadFiles(ctx, carPaths, uploadTo)
+			fatalIf(err, "Unable to upload CAR files to `"+uploadTo+"`.")
+
+			// Miners download the CAR files of offline deals from these URLs.
+			initShareConfig()
+			expiry := ctx.Duration("car-url-expire")
+			carURLs, err := shareUploadedFiles(sendCtx, carPaths, uploadTo, expiry)
+			fatalIf(err, "Unable to share CAR files uploaded to `"+uploadTo+"`.")
+			expiryTime := UTCNow().Add(expiry).Format(time.RFC3339)
+			for carPath, carURL := range carURLs {
+				carDeals[carPath].CarUrl = carURL
+				carDeals[carPath].CarUrlExpiry = expiryTime
+			}
+		}
+	}
+
+	tagSource := ctx.String("tag-source")
+	if tagSource != "" {
+		fatalIf(checkUploadTarget(tagSource), "Unable to tag `"+tagSource+"`.")
+	}
+
+	autoMiner := ctx.Bool("auto-miner")
+	var filter minerFilter
+	var miners []MinerMessage
+	if autoMiner {
+		filter = checkMinerFilterArgs(ctx)
+		miners, err = fetchSwanMiners(sendCtx, swanMinerQuery{Region: filter.region, Status: "Active"})
+		fatalIf(err, "Unable to get the miner list from swan.")
+	}
+
+	var candidates []MinerMessage
+	for _, minerID := range minerIDs {
+		candidates = append(candidates, MinerMessage{MinerID: minerID})
+	}
+
+	parallel := ctx.Int("parallel")
+	if dryRun {
+		// Keep the cost table in the order of the input csv.
+		parallel = 1
+	}
+	maxRetries := ctx.Int("max-retries")
+	limiter := newMinerRateLimiter(ctx.Duration("miner-interval"))
+
+	resumedRows := 0
+	if session != nil {
+		resumedRows = sentRows(session)
+	}
+	// makeDeal returns the deal of a piece with a candidate miner and its
+	// price per epoch.
+	makeDeal := func(dealConfig *OfflineDeal, candidate MinerMessage) (OfflineDeal, *big.Int, *probe.Error) {
+		deal := *dealConfig
+		deal.MinerId = candidate.MinerID
+		dealPrice := price
+		if autoMiner {
+			deal.VerifiedDeal = filter.verified
+			// Without an explicit --price, offer what the miner asks.
+			if !ctx.IsSet("price") {
+				dealPrice, _ = filter.minerPrice(candidate)
+			}
+		}
+		epochPrice, err := calculateCost(dealPrice, deal.PieceSize)
+		if err != nil {
+			return deal, nil, err.Trace(deal.DataCid)
+		}
+		deal.SenderWallet = wallet
+		deal.StartEpoch = strconv.FormatUint(uint64(calculateStartEpoch(network, start)), 10)
+		deal.Duration = strconv.FormatUint(uint64(calculateDuration(network, duration)), 10)
+		deal.Cost = formatFIL(epochPrice)
+		return deal, epochPrice, nil
+	}
+
+	// Check every deal against the constraints of the market and of its
+	// miner before proposing anything, the miners which would reject the
+	// deal of a piece are left out, as are the pieces without any miner.
+	preflight := newDealPreflight(network, api)
+	rowCandidates := make([][]MinerMessage, len(dealConfigs))
+	for row, dealConfig := range dealConfigs {
+		if row < resumedRows {
+			// Sent before the session was interrupted.
+			continue
+		}
+		pieceCandidates := candidates
+		if autoMiner {
+			pieceCandidates, err = selectMiners(miners, filter, dealConfig.PieceSize)
+			errorIf(err, "Unable to pick a miner for `"+dealConfig.DataCid+"`.")
+		}
+		report := sendPreflightMessage{Status: "success", DataCid: dealConfig.DataCid}
+		for _, candidate := range pieceCandidates {
+			deal, _, err := makeDeal(dealConfig, candidate)
+			var violations []string
+			if err != nil {
+				violations = []string{err.ToGoError().Error()}
+			} else {
+				violations = preflight.check(sendCtx, deal, candidate)
+			}
+			for _, violation := range violations {
+				report.Violations = append(report.Violations, candidate.MinerID+": "+violation)
+			}
+			if len(violations) == 0 {
+				rowCandidates[row] = append(rowCandidates[row], candidate)
+				report.Accepted = append(report.Accepted, candidate.MinerID)
+			}
+		}
+		if len(report.Violations) > 0 {
+			if len(report.Accepted) == 0 {
+				report.Status = "error"
+			}
+			printMsg(report)
+		}
+	}
+
+	if dryRun && !globalJSON {
+		printMsg(sendCostMessage{
+			DataCid:    "Data CID",
+			MinerID:    "Miner",
+			PieceSize:  "Piece Size",
+			StartEpoch: "Start Epoch",
+			Duration:   "Duration",
+			EpochPrice: "Epoch Price",
+			Cost:       "Cost",
+		})
+	}
+
+	// mutex guards the total cost, the deal csv and the session progress,
+	// which are shared by the workers.
+	var mutex sync.Mutex
+	doneRows := make([]bool, len(dealConfigs))
+	totalCost := new(big.Int)
+	sendPiece := func(row int, dealConfig *OfflineDeal) sendReplicaMessage {
+		summary := sendReplicaMessage{DataCid: dealConfig.DataCid, Requested: replicas}
+		usedMiners := make(map[string]bool)
+		for _, deal := range sent[dealConfig.DataCid] {
+			summary.Replicas++
+			summary.Miners = append(summary.Miners, deal.MinerId)
+			summary.DealCids = append(summary.DealCids, deal.DealCid)
+			usedMiners[deal.MinerId] = true
+		}
+		// Move on to the next candidate when a miner rejects the deal,
+		// until enough replicas are proposed.
+		for _, candidate := range rowCandidates[row] {
+			if summary.Replicas >= replicas {
+				break
+			}
+			if usedMiners[candidate.MinerID] {
+				continue
+			}
+			deal, epochPrice, err := makeDeal(dealConfig, candidate)
+			if err != nil {
+				errorIf(err, "Unable to calculate the cost of `"+deal.DataCid+"`.")
+				break
+			}
+			if dryRun {
+				cost := new(big.Int).Mul(epochPrice, big.NewInt(int64(calculateDuration(network, duration))))
+				mutex.Lock()
+				totalCost.Add(totalCost, cost)
+				mutex.Unlock()
+				printMsg(sendCostMessage{
+					Status:     "success",
+					DataCid:    deal.DataCid,
+					MinerID:    deal.MinerId,
+					PieceSize:  deal.PieceSize,
+					StartEpoch: deal.StartEpoch,
+					Duration:   deal.Duration,
+					EpochPrice: deal.Cost,
+					Cost:       formatFIL(cost),
+				})
+				summary.Replicas++
+				summary.Miners = append(summary.Miners, deal.MinerId)
+				continue
+			}
+			if err := proposeOfflineDealWithRetry(sendCtx, api, limiter, &deal, maxRetries); err != nil {
+				errorIf(err, "Unable to propose deal for `"+deal.DataCid+"` to miner `"+deal.MinerId+"`.")
+				continue
+			}
+			summary.Replicas++
+			summary.Miners = append(summary.Miners, deal.MinerId)
+			summary.DealCids = append(summary.DealCids, deal.DealCid)
+			if len(inputPath) != 0 {
+				mutex.Lock()
+				writeCsv(dealCsvPath, deal)
+				mutex.Unlock()
+			}
+		}
+		if session != nil && summary.Replicas > 0 {
+			// The session resumes after the rows sent without a gap, a
+			// row without any deal is sent again by a resumed batch.
+			mutex.Lock()
+			doneRows[row] = true
+			if rows := nextSentRows(sentRows(session), doneRows); rows > sentRows(session) {
+				fatalIf(setSentRows(session, rows), "Unable to save session.")
+			}
+			mutex.Unlock()
+		}
+		summary.Status = "success"
+		if summary.Replicas < replicas {
+			summary.Status = "error"
+		}
+		return summary
+	}
+
+	summaries := make([]sendReplicaMessage, len(dealConfigs))
+	rowCh := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rowCh {
+				summaries[row] = sendPiece(row, dealConfigs[row])
+			}
+		}()
+	}
+	for row := range dealConfigs {
+		rowCh <- row
+	}
+	close(rowCh)
+	wg.Wait()
+
+	// The source objects are tagged once all pieces are sent, so that a
+	// file split over several slices is tagged with all of them.
+	if tagSource != "" && !dryRun {
+		carDir, dealCsv := "", ""
 		if len(inputPath) != 0 {
-			writeCsv(dealCsvPath, *dealConfig)
+			carDir = filepath.Dir(inputPath)
+			dealCsv = dealCsvPath
+			if uploadTo := ctx.String("upload-to"); uploadTo != "" {
+				dealCsv = urlJoinPath(uploadTo, filepath.Base(dealCsvPath))
+			}
 		}
+		objects, err := collectSourceObjects(carDir, dealConfigs, summaries, resumedRows)
+		errorIf(err, "Unable to list the files of the pieces to tag them.")
+		for _, object := range objects {
+			if !object.tag {
+				continue
+			}
+			objectURL := tagSource
+			if object.name != "" {
+				objectURL = urlJoinPath(tagSource, object.name)
+			}
+			errorIf(tagDealObject(sendCtx, objectURL, object.tags(dealCsv)), "Unable to tag `"+objectURL+"`.")
+		}
+	}
+
+	failed := false
+	var failedDeals []*OfflineDeal
+	for row, summary := range summaries {
+		if summary.Replicas < summary.Requested {
+			failed = true
+			failedDeals = append(failedDeals, dealConfigs[row])
+		}
+	}
+
+	if dryRun {
+		printMsg(sendCostTotalMessage{Status: "success", Cost: formatFIL(totalCost)})
+		for _, summary := range summaries {
+			if summary.Replicas < summary.Requested {
+				printMsg(summary)
+			}
+		}
+		if failed {
+			return exitStatus(globalErrorExitStatus)
+		}
+		return nil
 	}
-	upload := ctx.Bool("upload")
-	if len(inputPath) != 0 && upload {
-		bucketName := ctx.String("minio-bucket")
-		uploadCsv(dealCsvPath, fmt.Sprintf("%s/%s", aliasName, bucketName), ctx)
+
+	// No deal CSV is written when every proposal failed.
+	if uploadTo := ctx.String("upload-to"); uploadTo != "" && dealCsvPath != "" {
+		if _, e := os.Stat(dealCsvPath); e == nil {
+			err = uploadFiles(ctx, []string{dealCsvPath}, uploadTo)
+			fatalIf(err, "Unable to upload `"+dealCsvPath+"` to `"+uploadTo+"`.")
+		}
 	}
 
+	// The pieces which fell short of replicas are written in the format of
+	// --input, so that they can be sent again.
+	if len(failedDeals) > 0 && len(inputPath) != 0 {
+		failedCsvPath := filepath.Join(filepath.Dir(dealCsvPath), strings.Replace(filepath.Base(dealCsvPath), "dealMetadata-", "failed-", 1))
+		for _, deal := range failedDeals {
+			writeCsv(failedCsvPath, *deal)
+		}
+		errorIf(errDummy().Trace(failedCsvPath), fmt.Sprintf("%d pieces fell short of %d replicas, they are listed in `%s`.", len(failedDeals), replicas, failedCsvPath))
+	}
+
+	if session != nil {
+		session.Delete()
+	}
+
+	for _, summary := range summaries {
+		printMsg(summary)
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
 	return nil
 }
 
+// sendReplicaMessage summarizes the deals proposed for a piece.
+type sendReplicaMessage struct {
+	Status    string   `json:"status"`
+	DataCid   string   `json:"dataCid"`
+	Replicas  int      `json:"replicas"`
+	Requested int      `json:"requested"`
+	Miners    []string `json:"miners"`
+	DealCids  []string `json:"dealCids,omitempty"`
+}
+
+// JSON jsonified send replica message.
+func (s sendReplicaMessage) JSON() string {
+	replicaJSONBytes, e := json.MarshalIndent(s, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(replicaJSONBytes)
+}
+
+// String colorized send replica message.
+func (s sendReplicaMessage) String() string {
+	return fmt.Sprintf("DataCid: %s, Replicas: %d/%d, Miners: %s", s.DataCid, s.Replicas, s.Requested, strings.Join(s.Miners, ","))
+}
+
+// sendCostMessage is a deal planned by `send --dry-run`, prices are in FIL.
+type sendCostMessage struct {
+	Status     string `json:"status"`
+	DataCid    string `json:"dataCid"`
+	MinerID    string `json:"minerId"`
+	PieceSize  string `json:"pieceSize"`
+	StartEpoch string `json:"startEpoch"`
+	Duration   string `json:"duration"`
+	EpochPrice string `json:"epochPrice"`
+	Cost       string `json:"cost"`
+}
+
+// JSON jsonified send cost message.
+func (s sendCostMessage) JSON() string {
+	costJSONBytes, e := json.MarshalIndent(s, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(costJSONBytes)
+}
+
+// String colorized send cost message.
+func (s sendCostMessage) String() string {
+	return fmt.Sprintf("%*s %*s %*s %*s %*s %*s %s",
+		-62, s.DataCid,
+		-10, s.MinerID,
+		-12, s.PieceSize,
+		-12, s.StartEpoch,
+		-10, s.Duration,
+		-22, s.EpochPrice,
+		s.Cost)
+}
+
+// sendCostTotalMessage is the total cost of the deals planned by `send --dry-run`.
+type sendCostTotalMessage struct {
+	Status string `json:"status"`
+	Cost   string `json:"totalCost"`
+}
+
+// JSON jsonified send cost total message.
+func (s sendCostTotalMessage) JSON() string {
+	totalJSONBytes, e := json.MarshalIndent(s, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(totalJSONBytes)
+}
+
+// String colorized send cost total message.
+func (s sendCostTotalMessage) String() string {
+	return "Total: " + s.Cost + " FIL"
+}
+
 var sendFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "from",
@@ -156,12 +588,22 @@ var sendFlags = []cli.Flag{
 	cli.UintFlag{
 		Name:  "start",
 		Value: uint(defaultStart),
-		Usage: "specify days for miner to process the file, default: 7",
+		Usage: "specify days for miner to process the file, default: 7 or the default of the network",
 	},
 	cli.UintFlag{
 		Name:  "duration",
 		Value: uint(defaultDuration),
-		Usage: "specify length in day to store the file, default: 365",
+		Usage: "specify length in day to store the file, default: 360 or the default of the network",
+	},
+	cli.StringFlag{
+		Name:   "network",
+		EnvVar: networkEnv,
+		Value:  defaultNetwork,
+		Usage:  "specify the network profile used to compute epochs, mainnet, calibnet or one of the config file",
+	},
+	cli.BoolFlag{
+		Name:  "check-epoch",
+		Usage: "compare the epoch of the local clock with the chain head and warn if they differ",
 	},
 	cli.StringFlag{
 		Name:  "input",
@@ -170,16 +612,7 @@ var sendFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:  "price",
 		Value: "0",
-		Usage: "specify the deal price for each GiB of file, default: 0",
-	},
-	cli.BoolFlag{
-		Name:  "upload",
-		Usage: "specify whether upload the generated csv to minio or not, default: false\nIn order to connect to your minio instance, you need to set environment variables of ACCESS_KEY, SECRET_KEY and ENDPOINT",
-	},
-	cli.StringFlag{
-		Name:  "minio-bucket",
-		Value: "swan",
-		Usage: "specify the bucket name used in minio, default: swan",
+		Usage: "specify the deal price for each GiB of file in FIL, or with a unit like '500 nanoFIL', default: 0",
 	},
 	cli.StringFlag{
 		Name: "piece-cid",
@@ -190,6 +623,54 @@ var sendFlags = []cli.Flag{
 	cli.StringFlag{
 		Name: "data-cid",
 	},
+	cli.StringFlag{
+		Name:  "tag-source",
+		Usage: "tag the source objects of each piece with its deals, the URL the CAR files were generated from",
+	},
+	cli.BoolFlag{
+		Name:   "upload",
+		Usage:  "[DEPRECATED] upload the deal csv to $ENDPOINT, use --upload-to instead",
+		Hidden: true,
+	},
+	cli.StringFlag{
+		Name:   "minio-bucket",
+		Value:  "swan",
+		Usage:  "[DEPRECATED] bucket of --upload, use --upload-to instead",
+		Hidden: true,
+	},
+	cli.DurationFlag{
+		Name:  "car-url-expire",
+		Value: shareDefaultExpiry,
+		Usage: "with --upload-to, expiry of the CAR download URLs written to the deal csv, default: 168h",
+	},
+	cli.BoolFlag{
+		Name:  "continue, c",
+		Usage: "create or resume a session, an interrupted batch resumes after the last piece sent",
+	},
+	cli.IntFlag{
+		Name:  "parallel",
+		Value: 1,
+		Usage: "specify how many pieces to propose deals for at the same time, default: 1",
+	},
+	cli.IntFlag{
+		Name:  "max-retries",
+		Value: 3,
+		Usage: "specify how many times to retry a proposal failed on a transport error or a timeout, with an exponential backoff, default: 3",
+	},
+	cli.DurationFlag{
+		Name:  "miner-interval",
+		Value: time.Second,
+		Usage: "specify the minimum time between two deals proposed to the same miner, default: 1s",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the deals with their duration and cost in FIL without proposing them",
+	},
+	cli.IntFlag{
+		Name:  "replicas",
+		Value: 1,
+		Usage: "specify how many miners to send a deal for each piece to, default: 1",
+	},
 }
 
 var sendOnlineFlags = []cli.Flag{
@@ -226,26 +707,43 @@ var sendOnlineFlags = []cli.Flag{
 		Value: defaultOnlineDuration,
 		Usage: "specify length in day to store the file",
 	},
+	cli.StringFlag{
+		Name:  "tag-source",
+		Usage: "tag the source object of the data-cid with the deal, e.g. myminio/dataset/file.zip",
+	},
 }
 
-func checkSendArgs(ctx *cli.Context) (string, uint, uint, string, string, *big.Float) {
+func checkSendArgs(ctx *cli.Context) (string, uint, uint, []string, string, *big.Int, int) {
 	args := ctx.Args()
 	for _, arg := range args {
 		if strings.TrimSpace(arg) == "" {
 			fatalIf(errInvalidArgument().Trace(args...), "Unable to validate empty argument.")
 		}
 	}
-	if len(args) < 1 {
-
+	replicas := ctx.Int("replicas")
+	if replicas < 1 {
+		fatalIf(errInvalidArgument(), "please provide a valid number of replicas")
+	}
+	var miners []string
+	if !ctx.Bool("auto-miner") {
+		if len(args) < 1 {
+			fatalIf(errInvalidArgument().Trace(), "please provide a miner id or use --auto-miner")
+		}
+		miners = args
+		if len(miners) < replicas {
+			fatalIf(errInvalidArgument().Trace(args...), "please provide at least %d miner ids for %d replicas", replicas, replicas)
+		}
 	}
-	miner := args[0]
 
 	wallet := strings.TrimSpace(ctx.String("from"))
 	start := ctx.Uint("start")
 	duration := ctx.Uint("duration")
 	input := ""
 	price := ctx.String("price")
-	upload := ctx.Bool("upload")
+	uploadTo := strings.TrimSpace(ctx.String("upload-to"))
+	if ctx.Bool("upload") && uploadTo == "" {
+		uploadTo = deprecatedUploadTarget(ctx)
+	}
 
 	if !ctx.IsSet("input") {
 		pieceCid := strings.TrimSpace(ctx.String("piece-cid"))
@@ -276,26 +774,27 @@ func checkSendArgs(ctx *cli.Context) (string, uint, uint, string, string, *big.F
 	if duration == 0 {
 		fatalIf(errInvalidArgument(), "please provide a valid length of duration in day")
 	}
-	priceDecimal, _, err := big.ParseFloat(price, 10, 256, big.ToNearestEven)
-	if err != nil {
-		fatalIf(errInvalidArgument(), "please provide a valid price")
+	priceAttoFIL, err := parseFIL(price)
+	if err != nil || priceAttoFIL.Sign() < 0 {
+		fatalIf(errInvalidArgument().Trace(price), "please provide a valid price")
 	}
-	if upload {
-		AccessKey := os.Getenv("ACCESS_KEY")
-		SecretKey := os.Getenv("SECRET_KEY")
-		Endpoint := os.Getenv("ENDPOINT")
-		if !(strings.HasPrefix(Endpoint, "http") || strings.HasPrefix(Endpoint, "https")) {
-			fatalIf(errInvalidArgument().Trace(Endpoint), "endpoint should start with 'http' or 'https'")
-		}
-		if len(AccessKey) == 0 {
-			fatalIf(errInvalidArgument().Trace(AccessKey), "$ACCESS_KEY not provided")
-		}
-		if len(SecretKey) == 0 {
-			fatalIf(errInvalidArgument().Trace(SecretKey), "$SECRET_KEY not provided")
+	if uploadTo != "" {
+		if len(input) == 0 {
+			fatalIf(errInvalidArgument().Trace(uploadTo), "--upload-to needs an --input csv")
 		}
+		fatalIf(checkUploadTarget(uploadTo), "Unable to upload to `"+uploadTo+"`.")
+	}
+	if ctx.Int("parallel") < 1 {
+		fatalIf(errInvalidArgument().Trace(ctx.String("parallel")), "please provide a valid number of parallel proposals")
+	}
+	if ctx.Int("max-retries") < 0 {
+		fatalIf(errInvalidArgument().Trace(ctx.String("max-retries")), "please provide a valid number of retries")
+	}
+	if ctx.Bool("continue") && len(input) == 0 {
+		fatalIf(errInvalidArgument(), "--continue needs an --input csv")
 	}
 
-	return wallet, start, duration, miner, input, priceDecimal
+	return wallet, start, duration, miners, input, priceAttoFIL, replicas
 }
 
 func checkSendOnlineArgs(ctx *cli.Context) (string, string, string, string, string, string, string) {
@@ -334,103 +833,164 @@ func checkSendOnlineArgs(ctx *cli.Context) (string, string, string, string, stri
 	return wallet, verifiedDeal, fastRetrieval, datacid, miner, duration, price
 }
 
-func getCurrentEpoch() uint {
-	sec := time.Now().Unix()
-	currentEpoch := uint((sec - 1598306471) / 30)
-	return currentEpoch
-}
-
-func calculateStartEpoch(start uint) uint {
-	startEpoch := getCurrentEpoch() + (start*24)*uint(epochPerHour)
-	return startEpoch
-}
-
-func calculateCost(price *big.Float, pieceSize string) *big.Float {
-	pieceSizeInt := new(big.Float)
-	pieceSizeInt.SetString(pieceSize)
-	pieceSizeInGiB := pieceSizeInt.Quo(pieceSizeInt, big.NewFloat(float64(GiBToByte))).Quo(pieceSizeInt, big.NewFloat(127)).Mul(pieceSizeInt, big.NewFloat(128))
-
-	cost := pieceSizeInGiB.Mul(pieceSizeInGiB, price)
-	return cost
-}
-
-func calculateDuration(duration uint) uint {
-	epoch := duration * 24 * 3600 / 30
-	return epoch
+// calculateCost returns the epoch price in attoFIL of a deal for an unpadded
+// piece, from a price in attoFIL for each GiB of padded piece. The result is
+// rounded down to the attoFIL.
+func calculateCost(price *big.Int, pieceSize string) (*big.Int, *probe.Error) {
+	size, ok := new(big.Int).SetString(pieceSize, 10)
+	if !ok {
+		return nil, errInvalidArgument().Trace(pieceSize)
+	}
+	cost := new(big.Int).Mul(price, size)
+	cost.Mul(cost, big.NewInt(128))
+	return cost.Quo(cost, big.NewInt(127*int64(GiBToByte))), nil
 }
 
-func proposeOfflineDeal(config *OfflineDeal) {
-
-	var commandArgs []string
-	commandArgs = []string{"client", "deal", "--from", config.SenderWallet, "--start-epoch", config.StartEpoch,
-		fmt.Sprintf("--fast-retrieval=%s", strconv.FormatBool(config.FastRetrieval)), "--manual-piece-cid",
-		config.PieceCid, "--manual-piece-size", config.PieceSize, config.DataCid, config.MinerId, config.Cost,
-		config.Duration}
-
-	cmd := exec.Command("lotus", commandArgs...)
-	fmt.Println(cmd.String())
-	stdout, err := cmd.Output()
+func proposeOfflineDeal(ctx context.Context, api *lotusClient, config *OfflineDeal) *probe.Error {
+	pieceSize, e := strconv.ParseUint(config.PieceSize, 10, 64)
+	if e != nil {
+		return probe.NewError(e).Trace(config.PieceSize)
+	}
+	startEpoch, e := strconv.ParseInt(config.StartEpoch, 10, 64)
+	if e != nil {
+		return probe.NewError(e).Trace(config.StartEpoch)
+	}
+	duration, e := strconv.ParseUint(config.Duration, 10, 64)
+	if e != nil {
+		return probe.NewError(e).Trace(config.Duration)
+	}
+	price, err := parseFIL(config.Cost)
 	if err != nil {
-		errorIf(errDummy(), err.Error())
-	} else {
-		config.DealCid = strings.TrimSuffix(string(stdout), "\n")
-		fmt.Println(fmt.Sprintf("DataCid: %s, DealCid: %s", config.DataCid, config.DealCid))
+		return err.Trace(config.Cost)
 	}
-}
 
-func proposeOnlineDeal(config OnlineDeal) {
-
-	commandLine := "lotus " + "client " + "deal " + "--from " + config.SenderWallet + " --verified-deal=" + config.VerifiedDeal +
-		" --fast-retrieval=" + config.FastRetrieval + " " + config.DataCid + " " + config.MinerId + " " + config.Cost + " " + config.Duration
-	dealCID, err := ExecCommand(commandLine)
+	dealCid, err := api.ClientStartDeal(ctx, &lotusStartDealParams{
+		Data: &lotusDataRef{
+			TransferType: lotusTransferManual,
+			Root:         lotusCid{Root: config.DataCid},
+			PieceCid:     &lotusCid{Root: config.PieceCid},
+			PieceSize:    pieceSize,
+		},
+		Wallet:             config.SenderWallet,
+		Miner:              config.MinerId,
+		EpochPrice:         price.String(),
+		MinBlocksDuration:  duration,
+		ProviderCollateral: "0",
+		DealStartEpoch:     startEpoch,
+		FastRetrieval:      config.FastRetrieval,
+		VerifiedDeal:       config.VerifiedDeal,
+	})
 	if err != nil {
-		logs.GetLogger().Error(err)
-		return
-	} else {
-		fmt.Println(fmt.Sprintf("Wallet: %s, VerifiedDeal: %s, FastRetrieval: %s, DataCid: %s,MinerID: %s, Price: %s, Duration %s, DealCid: %s", config.SenderWallet, config.VerifiedDeal, config.FastRetrieval, config.DataCid, config.MinerId, config.Cost, config.Duration, strings.TrimSuffix(string(dealCID), "\n")))
+		return err.Trace(config.DataCid)
 	}
-	return
+	config.DealCid = dealCid.String()
+	fmt.Println(fmt.Sprintf("DataCid: %s, DealCid: %s", config.DataCid, config.DealCid))
+	return nil
 }
 
-func readCsv(filepath string) []*OfflineDeal {
-	csvFile, err := os.Open(filepath)
+func proposeOnlineDeal(ctx context.Context, api *lotusClient, config OnlineDeal) (string, *probe.Error) {
+	verifiedDeal, e := strconv.ParseBool(config.VerifiedDeal)
+	if e != nil {
+		return "", probe.NewError(e).Trace(config.VerifiedDeal)
+	}
+	fastRetrieval, e := strconv.ParseBool(config.FastRetrieval)
+	if e != nil {
+		return "", probe.NewError(e).Trace(config.FastRetrieval)
+	}
+	duration, e := strconv.ParseUint(config.Duration, 10, 64)
+	if e != nil {
+		return "", probe.NewError(e).Trace(config.Duration)
+	}
+	price, err := parseFIL(config.Cost)
 	if err != nil {
-		fmt.Println(err)
+		return "", err.Trace(config.Cost)
 	}
-	defer csvFile.Close()
 
-	csvLines, err := csv.NewReader(csvFile).ReadAll()
+	dealCid, err := api.ClientStartDeal(ctx, &lotusStartDealParams{
+		Data: &lotusDataRef{
+			TransferType: lotusTransferGraphsync,
+			Root:         lotusCid{Root: config.DataCid},
+		},
+		Wallet:             config.SenderWallet,
+		Miner:              config.MinerId,
+		EpochPrice:         price.String(),
+		MinBlocksDuration:  duration,
+		ProviderCollateral: "0",
+		DealStartEpoch:     -1,
+		FastRetrieval:      fastRetrieval,
+		VerifiedDeal:       verifiedDeal,
+	})
 	if err != nil {
-		errorIf(errDummy(), err.Error())
+		return "", err.Trace(config.DataCid)
 	}
-	var dealConfigs []*OfflineDeal
-	// playload_cid,filename,piece_cid,piece_size
-	for i, line := range csvLines {
-		if i == 0 {
-			// skip header line
-			continue
-		}
+	fmt.Println(fmt.Sprintf("Wallet: %s, VerifiedDeal: %s, FastRetrieval: %s, DataCid: %s,MinerID: %s, Price: %s, Duration %s, DealCid: %s", config.SenderWallet, config.VerifiedDeal, config.FastRetrieval, config.DataCid, config.MinerId, config.Cost, config.Duration, dealCid.String()))
+	return dealCid.String(), nil
+}
 
-		offlineDeal := NewOfflineDeal()
+// filUnits are the decimal exponents of the FIL units in attoFIL.
+var filUnits = map[string]int64{
+	"":         18,
+	"fil":      18,
+	"millifil": 15,
+	"mfil":     15,
+	"microfil": 12,
+	"ufil":     12,
+	"μfil":     12,
+	"nanofil":  9,
+	"nfil":     9,
+	"picofil":  6,
+	"pfil":     6,
+	"femtofil": 3,
+	"ffil":     3,
+	"attofil":  0,
+	"afil":     0,
+}
 
-		offlineDeal.DataCid = line[0]
-		offlineDeal.Filename = line[1]
-		offlineDeal.PieceCid = line[2]
-		offlineDeal.PieceSize = line[3]
+// parseFIL parses a FIL amount, optionally suffixed with a unit from FIL
+// down to attoFIL, into an exact number of attoFIL.
+func parseFIL(s string) (*big.Int, *probe.Error) {
+	s = strings.TrimSpace(s)
+	suffix := strings.TrimLeft(s, "-.1234567890")
+	amount := s[:len(s)-len(suffix)]
+	exponent, ok := filUnits[strings.ToLower(strings.TrimSpace(suffix))]
+	if !ok {
+		return nil, errInvalidArgument().Trace(s)
+	}
 
-		dealConfigs = append(dealConfigs, offlineDeal)
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, errInvalidArgument().Trace(s)
 	}
-	return dealConfigs
+	r = r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(exponent), nil)))
+	if !r.IsInt() {
+		return nil, errInvalidArgument().Trace(s)
+	}
+	return r.Num(), nil
 }
+
+// formatFIL formats an amount of attoFIL in FIL without losing precision.
+func formatFIL(attoFIL *big.Int) string {
+	fil := new(big.Rat).SetFrac(attoFIL, attoFILPerFIL).FloatString(18)
+	return strings.TrimSuffix(strings.TrimRight(fil, "0"), ".")
+}
+
+// dealCsvHeader are the columns of the deal csv written by `send`.
+var dealCsvHeader = []string{"data_cid", "filename", "piece_cid", "piece_size", "deal_cid", "miner_id", "car_url", "car_url_expiry"}
+
+// writeCsv appends a deal to a deal csv, in the columns of its header when
+// the csv exists, columns may have been added by `swan task create`.
 func writeCsv(filePath string, deal OfflineDeal) {
 	_, err := os.Stat(filePath)
-	header := []string{"data_cid", "filename", "piece_cid", "piece_size", "deal_cid", "miner_id"}
+	header := dealCsvHeader
 	var records [][]string
 	var file *os.File
 	if os.IsNotExist(err) {
 		file, err = os.Create(filePath)
 		records = append(records, header)
 	} else {
+		if csvHeader, e := readCsvHeader(filePath); e == nil && len(csvHeader) > 0 {
+			header = csvHeader
+		}
 		file, err = os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
 	}
 	if err != nil {
@@ -438,7 +998,21 @@ func writeCsv(filePath string, deal OfflineDeal) {
 	}
 	defer file.Close()
 
-	dealRecord := []string{deal.DataCid, deal.Filename, deal.PieceCid, deal.PieceSize, deal.DealCid, deal.MinerId}
+	fields := map[string]string{
+		"data_cid":       deal.DataCid,
+		"filename":       deal.Filename,
+		"piece_cid":      deal.PieceCid,
+		"piece_size":     deal.PieceSize,
+		"deal_cid":       deal.DealCid,
+		"miner_id":       deal.MinerId,
+		"car_url":        deal.CarUrl,
+		"car_url_expiry": deal.CarUrlExpiry,
+		swanTaskIDColumn: deal.TaskId,
+	}
+	dealRecord := make([]string, len(header))
+	for i, name := range header {
+		dealRecord[i] = fields[strings.TrimSpace(name)]
+	}
 	records = append(records, dealRecord)
 
 	writer := csv.NewWriter(file)
@@ -448,88 +1022,95 @@ func writeCsv(filePath string, deal OfflineDeal) {
 	}
 }
 
-func makeFinalEnv(accessKey, secretKey, endpoint string) string {
-	protocol := "http"
-	if strings.HasPrefix(endpoint, "https") {
-		protocol = "https"
+// readCsvHeader returns the first line of a csv file.
+func readCsvHeader(filePath string) ([]string, *probe.Error) {
+	csvFile, e := os.Open(filePath)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(filePath)
 	}
-	url := strings.Split(endpoint, "://")[1]
-	return fmt.Sprintf("%s://%s:%s@%s", protocol, accessKey, secretKey, url)
-}
-
-func uploadCsv(csvPath string, targetFolder string, cliCtx *cli.Context) {
-
-	AccessKey := os.Getenv("ACCESS_KEY")
-	SecretKey := os.Getenv("SECRET_KEY")
-	Endpoint := os.Getenv("ENDPOINT")
-
-	os.Setenv(fmt.Sprintf("MC_HOST_%s", aliasName), makeFinalEnv(AccessKey, SecretKey, Endpoint))
-
-	ctx, cancelCopy := context.WithCancel(globalContext)
-	defer cancelCopy()
-
-	encKeyDB, err := getEncKeys(cliCtx)
-	fatalIf(err, "Unable to parse encryption keys.")
-
-	flagSet := flag.NewFlagSet("copy", flag.ExitOnError)
-	flagSet.Parse([]string{csvPath, targetFolder})
-	minioCtx := cli.NewContext(cliCtx.App, flagSet, cliCtx)
+	defer csvFile.Close()
 
-	// make bucket if not exist, reference mb-main.go
-	{
-		defaultRegion := "us-east-1"
-		targetURL := targetFolder
-		clnt, err := newClient(targetURL)
-		if err != nil {
-			errorIf(err.Trace(targetURL), "Invalid target `"+targetURL+"`.")
-			exitStatus(globalErrorExitStatus)
-		}
+	header, e := csv.NewReader(csvFile).Read()
+	if e != nil {
+		return nil, probe.NewError(e).Trace(filePath)
+	}
+	return header, nil
+}
 
-		ctx, cancelMakeBucket := context.WithCancel(globalContext)
-		defer cancelMakeBucket()
+// deprecatedUploadTarget maps the deprecated --upload and --minio-bucket
+// flags onto --upload-to: the $ENDPOINT, $ACCESS_KEY and $SECRET_KEY server
+// is set as the swanminio alias, and --minio-bucket of it is the target.
+func deprecatedUploadTarget(ctx *cli.Context) string {
+	errorIf(errInvalidArgument().Trace("upload"), "`--upload` and `--minio-bucket` are deprecated, please use `--upload-to` with an alias added by `mc alias set` instead.")
 
-		// Make bucket.
-		err = clnt.MakeBucket(ctx, defaultRegion, true, false)
-		if err != nil {
-			switch err.ToGoError().(type) {
-			case BucketNameEmpty:
-				errorIf(err.Trace(targetURL), "Unable to make bucket, please use `mc mb %s/<your-bucket-name>`.", targetURL)
-			case BucketNameTopLevel:
-				errorIf(err.Trace(targetURL), "Unable to make prefix, please use `mc mb %s/`.", targetURL)
-			default:
-				errorIf(err.Trace(targetURL), "Unable to make bucket `"+targetURL+"`.")
-			}
-			exitStatus(globalErrorExitStatus)
-		}
+	accessKey := os.Getenv("ACCESS_KEY")
+	secretKey := os.Getenv("SECRET_KEY")
+	endpoint := os.Getenv("ENDPOINT")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		fatalIf(errInvalidArgument().Trace(endpoint), "endpoint should start with 'http' or 'https'")
+	}
+	if len(accessKey) == 0 {
+		fatalIf(errInvalidArgument().Trace(accessKey), "$ACCESS_KEY not provided")
 	}
+	if len(secretKey) == 0 {
+		fatalIf(errInvalidArgument().Trace(secretKey), "$SECRET_KEY not provided")
+	}
+	endpointParts := splitStr(endpoint, "://", 2)
+	scheme, host := endpointParts[0], endpointParts[1]
+	e := os.Setenv(mcEnvHostPrefix+deprecatedUploadAlias, fmt.Sprintf("%s://%s:%s@%s", scheme, accessKey, secretKey, host))
+	fatalIf(probe.NewError(e), "Unable to set the `"+deprecatedUploadAlias+"` alias.")
 
-	var session *sessionV8
+	// The CAR files and the deal csv are then uploaded like with --upload-to.
+	uploadTo := deprecatedUploadAlias + "/" + strings.Trim(ctx.String("minio-bucket"), "/")
+	e = ctx.Set("upload-to", uploadTo)
+	fatalIf(probe.NewError(e), "Unable to upload to `"+uploadTo+"`.")
+	return uploadTo
+}
 
-	e := doCopySession(ctx, cancelCopy, minioCtx, session, encKeyDB, false)
-	if session != nil {
-		session.Delete()
+// readDealCsv reads a dealMetadata CSV written by `send`, or a manifest
+// written by `car generate`, matching the columns by their header name.
+func readDealCsv(filePath string) ([]*OfflineDeal, *probe.Error) {
+	csvFile, e := os.Open(filePath)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(filePath)
 	}
+	defer csvFile.Close()
+
+	csvLines, e := csv.NewReader(csvFile).ReadAll()
 	if e != nil {
-		fatalIf(probe.NewError(e).Untrace(), e.Error())
+		return nil, probe.NewError(e).Trace(filePath)
+	}
+	if len(csvLines) == 0 {
+		return nil, nil
 	}
-	return
-}
 
-func ExecCommand(strCommand string) (string, error) {
-	cmd := exec.Command("/bin/bash", "-c", strCommand)
-	stdout, _ := cmd.StdoutPipe()
-	if err := cmd.Start(); err != nil {
-		logs.GetLogger().Error("Execute failed when Start:" + err.Error())
-		return "", err
+	columns := make(map[string]int)
+	for i, name := range csvLines[0] {
+		columns[strings.TrimSpace(name)] = i
 	}
-	out_bytes, _ := ioutil.ReadAll(stdout)
-	if err := stdout.Close(); err != nil {
-		logs.GetLogger().Error("Execute failed when close stdout:" + err.Error())
-		return "", err
+	field := func(line []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(line) {
+				return strings.TrimSpace(line[i])
+			}
+		}
+		return ""
 	}
-	if err := cmd.Wait(); err != nil {
-		logs.GetLogger().Error("Execute failed when Wait:" + err.Error())
-		return "", err
+
+	var deals []*OfflineDeal
+	for _, line := range csvLines[1:] {
+		deal := NewOfflineDeal()
+		deal.DataCid = field(line, "data_cid", "payload_cid", "playload_cid")
+		deal.Filename = field(line, "filename")
+		deal.PieceCid = field(line, "piece_cid")
+		deal.PieceSize = field(line, "piece_size")
+		deal.DealCid = field(line, "deal_cid")
+		deal.MinerId = field(line, "miner_id")
+		deal.CarUrl = field(line, "car_url")
+		deal.CarUrlExpiry = field(line, "car_url_expiry")
+		deal.Detail = field(line, "detail")
+		deal.TaskId = field(line, swanTaskIDColumn)
+		deals = append(deals, deal)
 	}
-	return string(out_bytes), nil
+	return deals, nil
 }
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/cli"
+)
+
+func TestParseFIL(t *testing.T) {
+	testCases := []struct {
+		amount  string
+		atto    string
+		success bool
+	}{
+		{"1", "1000000000000000000", true},
+		{"0.5 FIL", "500000000000000000", true},
+		{"1.23e-05", "", false},
+		{"100 attoFIL", "100", true},
+		{"0.5 attoFIL", "", false},
+		{"1 mFIL", "1000000000000000", true},
+		{"500 nanoFIL", "500000000000", true},
+		{" 0.0005 FIL ", "500000000000000", true},
+		{"1 kFIL", "", false},
+		{"abc", "", false},
+	}
+	for i, testCase := range testCases {
+		atto, err := parseFIL(testCase.amount)
+		if testCase.success != (err == nil) {
+			t.Fatalf("Test %d: expected success %v, got error %v", i+1, testCase.success, err)
+		}
+		if err == nil && atto.String() != testCase.atto {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.atto, atto)
+		}
+	}
+}
+
+func TestFormatFIL(t *testing.T) {
+	testCases := []struct {
+		atto string
+		fil  string
+	}{
+		{"1000000000000000000", "1"},
+		{"500000000000", "0.0000005"},
+		{"1", "0.000000000000000001"},
+		{"0", "0"},
+		{"12300000000000000000", "12.3"},
+	}
+	for i, testCase := range testCases {
+		atto, _ := new(big.Int).SetString(testCase.atto, 10)
+		if fil := formatFIL(atto); fil != testCase.fil {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.fil, fil)
+		}
+	}
+}
+
+func TestCalculateCost(t *testing.T) {
+	testCases := []struct {
+		price     string
+		pieceSize string
+		cost      string
+		success   bool
+	}{
+		// 127 bytes of unpadded piece are 128 bytes of padded piece.
+		{"1", "34091302912", "32000000000000000000", true},
+		{"0.0000000005", "34091302912", "16000000000", true},
+		{"1 attoFIL", "1", "0", true},
+		{"0", "34091302912", "0", true},
+		{"1", "1.5", "", false},
+	}
+	for i, testCase := range testCases {
+		price, err := parseFIL(testCase.price)
+		if err != nil {
+			t.Fatalf("Test %d: %s", i+1, err)
+		}
+		cost, err := calculateCost(price, testCase.pieceSize)
+		if testCase.success != (err == nil) {
+			t.Fatalf("Test %d: expected success %v, got error %v", i+1, testCase.success, err)
+		}
+		if err == nil && cost.String() != testCase.cost {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.cost, cost)
+		}
+	}
+}
+
+func TestDealCsvRoundTrip(t *testing.T) {
+	tmpDir, e := ioutil.TempDir("", "mc-deal-csv-")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(tmpDir)
+	csvPath := filepath.Join(tmpDir, "dealMetadata.csv")
+	deal := OfflineDeal{
+		DataCid:      "bafybeidata",
+		Filename:     "batch-1",
+		PieceCid:     "baga6ea4seaqpiece",
+		PieceSize:    "34091302912",
+		DealCid:      "bafyreideal",
+		MinerId:      "f01234",
+		CarUrl:       "https://fs3.example.com/swan/bafybeidata.car?X-Amz-Expires=604800&X-Amz-Signature=abc",
+		CarUrlExpiry: "2026-10-24T00:00:00Z",
+	}
+	writeCsv(csvPath, deal)
+	writeCsv(csvPath, deal)
+
+	deals, err := readDealCsv(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 2 {
+		t.Fatalf("expected 2 deals, got %d", len(deals))
+	}
+	deal.FastRetrieval = true
+	if *deals[1] != deal {
+		t.Errorf("expected %+v, got %+v", deal, *deals[1])
+	}
+}
+
+func TestWriteCsvKeepsColumns(t *testing.T) {
+	tmpDir, e := ioutil.TempDir("", "mc-deal-csv-")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(tmpDir)
+	csvPath := filepath.Join(tmpDir, "dealMetadata.csv")
+	header := "task_id,miner_id,deal_cid,data_cid,piece_cid,piece_size\n"
+	if e = ioutil.WriteFile(csvPath, []byte(header), 0644); e != nil {
+		t.Fatal(e)
+	}
+	writeCsv(csvPath, OfflineDeal{
+		DataCid:   "bafybeidata",
+		PieceCid:  "baga6ea4seaqpiece",
+		PieceSize: "34091302912",
+		DealCid:   "bafyreideal",
+		MinerId:   "f01234",
+		TaskId:    "42",
+	})
+
+	data, e := ioutil.ReadFile(csvPath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expected := header + "42,f01234,bafyreideal,bafybeidata,baga6ea4seaqpiece,34091302912\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+}
+
+func TestDeprecatedUploadTarget(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	for name, value := range map[string]string{
+		"ENDPOINT":                              "http://fs3.example.com:9000",
+		"ACCESS_KEY":                            "minioadmin",
+		"SECRET_KEY":                            "miniosecret",
+		mcEnvHostPrefix + deprecatedUploadAlias: "",
+	} {
+		saved, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if ok {
+			defer os.Setenv(name, saved)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	flagSet := flag.NewFlagSet("send", flag.ContinueOnError)
+	flagSet.Bool("upload", false, "")
+	flagSet.String("minio-bucket", "swan", "")
+	flagSet.String("upload-to", "", "")
+	if e := flagSet.Parse([]string{"--upload", "--minio-bucket", "batch-42/", "f01234"}); e != nil {
+		t.Fatal(e)
+	}
+	cliCtx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	uploadTo := deprecatedUploadTarget(cliCtx)
+	if uploadTo != "swanminio/batch-42" || cliCtx.String("upload-to") != uploadTo {
+		t.Fatalf("expected --upload-to swanminio/batch-42, got %q and %q", uploadTo, cliCtx.String("upload-to"))
+	}
+	if err := checkUploadTarget(uploadTo); err != nil {
+		t.Fatal(err)
+	}
+	_, _, hostCfg, err := expandAlias(uploadTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostCfg.URL != "http://fs3.example.com:9000" || hostCfg.AccessKey != "minioadmin" || hostCfg.SecretKey != "miniosecret" {
+		t.Errorf("unexpected alias %+v", hostCfg)
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+)
+
+var sendAutoMinerFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "auto-miner",
+		Usage: "pick a miner from the swan miner list for each piece instead of MINER-ID",
+	},
+	cli.StringFlag{
+		Name:  "region",
+		Usage: "with --auto-miner, only pick miners in specific region",
+	},
+	cli.StringFlag{
+		Name:  "max-price",
+		Usage: "with --auto-miner, only pick miners asking at most this price for each GiB",
+	},
+	cli.BoolFlag{
+		Name:  "verified",
+		Usage: "with --auto-miner, compare verified prices and send verified deals",
+	},
+	cli.Float64Flag{
+		Name:  "min-score",
+		Usage: "with --auto-miner, only pick miners with at least this score",
+	},
+}
+
+// minerFilter holds the criteria of `send --auto-miner`.
+type minerFilter struct {
+	region   string
+	maxPrice *big.Int
+	verified bool
+	minScore float64
+}
+
+// checkMinerFilterArgs validates the --auto-miner flags.
+func checkMinerFilterArgs(ctx *cli.Context) minerFilter {
+	filter := minerFilter{
+		region:   checkListArgs(ctx),
+		verified: ctx.Bool("verified"),
+		minScore: ctx.Float64("min-score"),
+	}
+	if maxPrice := strings.TrimSpace(ctx.String("max-price")); maxPrice != "" {
+		price, err := parseFIL(maxPrice)
+		fatalIf(err, "please provide a valid max-price")
+		filter.maxPrice = price
+	}
+	return filter
+}
+
+// minerScore returns the score of a miner, which the swan API reports
+// either as a number or as a string.
+func minerScore(m MinerMessage) float64 {
+	switch score := m.Score.(type) {
+	case float64:
+		return score
+	case string:
+		if f, e := strconv.ParseFloat(score, 64); e == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// minerPrice returns the price in attoFIL a miner asks for the deal kind of
+// the filter.
+func (f minerFilter) minerPrice(m MinerMessage) (*big.Int, *probe.Error) {
+	if f.verified {
+		return parseFIL(m.VerifiedPrice)
+	}
+	return parseFIL(m.Price)
+}
+
+// accepts returns true if the miner takes offline deals for a piece of this
+// padded size and matches the filter.
+func (f minerFilter) accepts(m MinerMessage, pieceSize uint64) bool {
+	if !m.OfflineDealAvailable {
+		return false
+	}
+	if f.region != "" && m.Location != f.region {
+		return false
+	}
+	if minerScore(m) < f.minScore {
+		return false
+	}
+	price, err := f.minerPrice(m)
+	if err != nil || (f.maxPrice != nil && price.Cmp(f.maxPrice) > 0) {
+		return false
+	}
+	minSize, e := humanize.ParseBytes(m.MinPieceSize)
+	if e != nil || pieceSize < minSize {
+		return false
+	}
+	maxSize, e := humanize.ParseBytes(m.MaxPieceSize)
+	if e != nil || pieceSize > maxSize {
+		return false
+	}
+	return true
+}
+
+// selectMiners returns the miners accepting a piece, best score first, the
+// order of the list is kept between miners of the same score. pieceSize is
+// the unpadded size of the CSV files, the sizes of the miners are padded.
+func selectMiners(miners []MinerMessage, filter minerFilter, pieceSize string) ([]MinerMessage, *probe.Error) {
+	size, e := strconv.ParseUint(pieceSize, 10, 64)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(pieceSize)
+	}
+	size = paddedPieceSize(size)
+	var selected []MinerMessage
+	for _, miner := range miners {
+		if filter.accepts(miner, size) {
+			selected = append(selected, miner)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errNoMatchingMiner(pieceSize).Trace(pieceSize)
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return minerScore(selected[i]) > minerScore(selected[j])
+	})
+	return selected, nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSelectMiners(t *testing.T) {
+	var locations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locations = append(locations, r.URL.Query().Get("location"))
+		response := minerResponse{Status: "success"}
+		response.Data.Miner = []MinerMessage{
+			{MinerID: "f01000", Location: "Asia", MinPieceSize: "256 B", MaxPieceSize: "32 GiB", OfflineDealAvailable: false, Price: "0", VerifiedPrice: "0", Score: 100.0},
+			{MinerID: "f01001", Location: "Asia", MinPieceSize: "256 B", MaxPieceSize: "32 GiB", OfflineDealAvailable: true, Price: "0.0000002 FIL", VerifiedPrice: "0", Score: "90"},
+			{MinerID: "f01002", Location: "Europe", MinPieceSize: "1 GiB", MaxPieceSize: "64 GiB", OfflineDealAvailable: true, Price: "0.0000001", VerifiedPrice: "0.00000001", Score: 80.0},
+			{MinerID: "f01003", Location: "Europe", MinPieceSize: "256 B", MaxPieceSize: "2 KiB", OfflineDealAvailable: true, Price: "0", Score: 95.0},
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	savedAPI := os.Getenv(swanAPIEnv)
+	os.Setenv(swanAPIEnv, server.URL)
+	defer os.Setenv(swanAPIEnv, savedAPI)
+
+	miners, err := fetchSwanMiners(context.Background(), swanMinerQuery{Region: "Europe", Status: "Active", NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(miners) != 4 || len(locations) != 1 || locations[0] != "Europe" {
+		t.Fatalf("unexpected miner list %v requested for %v", miners, locations)
+	}
+
+	maxPrice, err := parseFIL("0.00000015")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		filter    minerFilter
+		pieceSize string
+		miners    []string
+	}{
+		{minerFilter{}, "2032", []string{"f01003", "f01001"}},
+		{minerFilter{}, "34091302912", []string{"f01001", "f01002"}},
+		{minerFilter{maxPrice: maxPrice}, "34091302912", []string{"f01002"}},
+		{minerFilter{minScore: 96}, "2032", nil},
+		{minerFilter{region: "Asia"}, "2032", []string{"f01001"}},
+		{minerFilter{verified: true, minScore: 85}, "2032", []string{"f01001"}},
+		// The unpadded sizes of the CSV files are padded: 2048 bytes
+		// do not fit in a 2 KiB piece, nor 32 GiB in a 32 GiB piece.
+		{minerFilter{}, "2048", []string{"f01001"}},
+		{minerFilter{}, "34359738368", []string{"f01002"}},
+		{minerFilter{}, "68182605825", nil},
+		{minerFilter{}, "not-a-size", nil},
+	}
+	for i, testCase := range testCases {
+		selected, err := selectMiners(miners, testCase.filter, testCase.pieceSize)
+		if testCase.miners == nil {
+			if err == nil {
+				t.Errorf("Test %d: expected no miner, got %v", i+1, selected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error %s", i+1, err)
+			continue
+		}
+		var minerIDs []string
+		for _, miner := range selected {
+			minerIDs = append(minerIDs, miner.MinerID)
+		}
+		if !reflect.DeepEqual(minerIDs, testCase.miners) {
+			t.Errorf("Test %d: expected %v, got %v", i+1, testCase.miners, minerIDs)
+		}
+	}
+}
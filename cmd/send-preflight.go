@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/filswan/fs3-mc/pkg/probe"
+	json "github.com/minio/colorjson"
+)
+
+const (
+	// Deal durations accepted by the storage market actor, in days.
+	minDealDurationDays = 180
+	maxDealDurationDays = 540
+)
+
+// minerAsk is what a miner accepts for a deal, a zero size or a nil price
+// is not known and not checked.
+type minerAsk struct {
+	minPieceSize  uint64
+	maxPieceSize  uint64
+	price         *big.Int
+	verifiedPrice *big.Int
+	err           *probe.Error
+}
+
+// swanMinerAsk returns the ask of a miner from the swan miner list.
+func swanMinerAsk(m MinerMessage) *minerAsk {
+	ask := &minerAsk{}
+	if m.MinPieceSize != "" {
+		if ask.minPieceSize, _ = humanize.ParseBytes(m.MinPieceSize); ask.minPieceSize == 0 {
+			ask.err = errInvalidArgument().Trace(m.MinPieceSize)
+		}
+	}
+	if m.MaxPieceSize != "" {
+		if ask.maxPieceSize, _ = humanize.ParseBytes(m.MaxPieceSize); ask.maxPieceSize == 0 {
+			ask.err = errInvalidArgument().Trace(m.MaxPieceSize)
+		}
+	}
+	if m.Price != "" {
+		ask.price, ask.err = parseFIL(m.Price)
+	}
+	if m.VerifiedPrice != "" && ask.err == nil {
+		ask.verifiedPrice, ask.err = parseFIL(m.VerifiedPrice)
+	}
+	return ask
+}
+
+// queryMinerAsk asks a miner for its storage ask through lotus.
+func queryMinerAsk(ctx context.Context, api *lotusClient, minerID string) *minerAsk {
+	lotusAsk, err := queryStorageAsk(ctx, api, minerID)
+	if err != nil {
+		return &minerAsk{err: err.Trace(minerID)}
+	}
+	ask := &minerAsk{
+		minPieceSize:  lotusAsk.MinPieceSize,
+		maxPieceSize:  lotusAsk.MaxPieceSize,
+		price:         new(big.Int),
+		verifiedPrice: new(big.Int),
+	}
+	if _, ok := ask.price.SetString(lotusAsk.Price, 10); !ok {
+		ask.err = errInvalidArgument().Trace(minerID, lotusAsk.Price)
+	}
+	if _, ok := ask.verifiedPrice.SetString(lotusAsk.VerifiedPrice, 10); !ok {
+		ask.err = errInvalidArgument().Trace(minerID, lotusAsk.VerifiedPrice)
+	}
+	return ask
+}
+
+// dealPreflight checks deals against the constraints of the market and of
+// their miner before they are proposed.
+type dealPreflight struct {
+	minDuration uint64
+	maxDuration uint64
+	// api queries the asks of miners which are not in the swan miner list,
+	// they are not checked without it.
+	api  *lotusClient
+	asks map[string]*minerAsk
+}
+
+func newDealPreflight(network networkConfigV10, api *lotusClient) *dealPreflight {
+	return &dealPreflight{
+		minDuration: uint64(calculateDuration(network, minDealDurationDays)),
+		maxDuration: uint64(calculateDuration(network, maxDealDurationDays)),
+		api:         api,
+		asks:        make(map[string]*minerAsk),
+	}
+}
+
+// minerAsk returns the ask of the miner of a candidate, from the swan miner
+// list when it comes from there, from lotus else.
+func (p *dealPreflight) minerAsk(ctx context.Context, candidate MinerMessage) *minerAsk {
+	if ask, ok := p.asks[candidate.MinerID]; ok {
+		return ask
+	}
+	var ask *minerAsk
+	switch {
+	case candidate.MinPieceSize != "" || candidate.MaxPieceSize != "" || candidate.Price != "":
+		ask = swanMinerAsk(candidate)
+	case p.api != nil:
+		ask = queryMinerAsk(ctx, p.api, candidate.MinerID)
+	}
+	p.asks[candidate.MinerID] = ask
+	return ask
+}
+
+// check returns every reason for which the deal would be rejected.
+func (p *dealPreflight) check(ctx context.Context, deal OfflineDeal, candidate MinerMessage) []string {
+	var violations []string
+	// The piece size of a deal csv is unpadded, the asks of the miners are
+	// in padded sizes.
+	var pieceSize uint64
+	unpadded, e := strconv.ParseUint(deal.PieceSize, 10, 64)
+	if e == nil && unpadded%127 == 0 {
+		pieceSize = paddedPieceSize(unpadded)
+	}
+	if pieceSize == 0 || pieceSize&(pieceSize-1) != 0 {
+		violations = append(violations, fmt.Sprintf("piece size %s is not the unpadded size of a power of two", deal.PieceSize))
+	}
+	if duration, e := strconv.ParseUint(deal.Duration, 10, 64); e != nil || duration < p.minDuration || duration > p.maxDuration {
+		violations = append(violations, fmt.Sprintf("duration of %s epochs is not between %d and %d", deal.Duration, p.minDuration, p.maxDuration))
+	}
+
+	ask := p.minerAsk(ctx, candidate)
+	if ask == nil {
+		return violations
+	}
+	if ask.err != nil {
+		return append(violations, "unable to get the ask of the miner: "+ask.err.ToGoError().Error())
+	}
+	if ask.minPieceSize > 0 && pieceSize > 0 && pieceSize < ask.minPieceSize {
+		violations = append(violations, fmt.Sprintf("padded piece size %d is below the minimum of %d", pieceSize, ask.minPieceSize))
+	}
+	if ask.maxPieceSize > 0 && pieceSize > ask.maxPieceSize {
+		violations = append(violations, fmt.Sprintf("padded piece size %d is above the maximum of %d", pieceSize, ask.maxPieceSize))
+	}
+	askPrice := ask.price
+	if deal.VerifiedDeal {
+		askPrice = ask.verifiedPrice
+	}
+	if askPrice != nil {
+		askEpochPrice, err := calculateCost(askPrice, deal.PieceSize)
+		dealEpochPrice, dealErr := parseFIL(deal.Cost)
+		if err == nil && dealErr == nil && dealEpochPrice.Cmp(askEpochPrice) < 0 {
+			violations = append(violations, fmt.Sprintf("epoch price %s FIL is below the ask of %s FIL", deal.Cost, formatFIL(askEpochPrice)))
+		}
+	}
+	return violations
+}
+
+// sendPreflightMessage reports the deals of a piece which would be
+// rejected, it is an error when no miner is left for the piece.
+type sendPreflightMessage struct {
+	Status     string   `json:"status"`
+	DataCid    string   `json:"dataCid"`
+	Accepted   []string `json:"accepted"`
+	Violations []string `json:"violations"`
+}
+
+// JSON jsonified send preflight message.
+func (s sendPreflightMessage) JSON() string {
+	preflightJSONBytes, e := json.MarshalIndent(s, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(preflightJSONBytes)
+}
+
+// String colorized send preflight message.
+func (s sendPreflightMessage) String() string {
+	message := fmt.Sprintf("DataCid: %s, Miners left: %s", s.DataCid, strings.Join(s.Accepted, ","))
+	if len(s.Accepted) == 0 {
+		message = fmt.Sprintf("DataCid: %s, not proposed", s.DataCid)
+	}
+	return message + "\n  " + strings.Join(s.Violations, "\n  ")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDealPreflight(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.StateMinerInfo": map[string]interface{}{"PeerId": "12D3KooW"},
+		"Filecoin.ClientQueryAsk": map[string]interface{}{
+			"Price":         "1000",
+			"VerifiedPrice": "0",
+			"MinPieceSize":  256,
+			"MaxPieceSize":  34359738368,
+		},
+	})
+	defer server.Close()
+
+	preflight := newDealPreflight(builtinNetworks["mainnet"], newLotusClient(server.URL, ""))
+	swanMiner := MinerMessage{MinerID: "f05678", MinPieceSize: "1 GiB", MaxPieceSize: "32 GiB", Price: "0.000000001"}
+	testCases := []struct {
+		deal       OfflineDeal
+		candidate  MinerMessage
+		violations int
+	}{
+		// Piece sizes are unpadded, 34091302912 bytes is a piece of 32 GiB,
+		// at 1000 attoFIL per GiB it is 32000 attoFIL per epoch.
+		{OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0.000000000000032"}, MinerMessage{MinerID: "f01234"}, 0},
+		{OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0.000000000000031999"}, MinerMessage{MinerID: "f01234"}, 1},
+		{OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0", VerifiedDeal: true}, MinerMessage{MinerID: "f01234"}, 0},
+		// A padded size in the deal csv.
+		{OfflineDeal{PieceSize: "34359738368", Duration: "1036800", Cost: "1"}, MinerMessage{MinerID: "f01234"}, 1},
+		{OfflineDeal{PieceSize: "1000", Duration: "1036800", Cost: "1"}, MinerMessage{MinerID: "f01234"}, 1},
+		{OfflineDeal{PieceSize: "127", Duration: "100", Cost: "1"}, MinerMessage{MinerID: "f01234"}, 2},
+		{OfflineDeal{PieceSize: "254", Duration: "1036800", Cost: "1"}, MinerMessage{MinerID: "f01234"}, 0},
+		{OfflineDeal{PieceSize: "68182605824", Duration: "1036800", Cost: "1"}, MinerMessage{MinerID: "f01234"}, 1},
+		{OfflineDeal{PieceSize: "532676608", Duration: "1036800", Cost: "1"}, swanMiner, 1},
+		{OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0.000000032"}, swanMiner, 0},
+		{OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0.00000000000003225"}, swanMiner, 1},
+	}
+	for i, testCase := range testCases {
+		violations := preflight.check(context.Background(), testCase.deal, testCase.candidate)
+		if len(violations) != testCase.violations {
+			t.Errorf("Test %d: expected %d violations, got %v", i+1, testCase.violations, violations)
+		}
+	}
+
+	offline := newDealPreflight(builtinNetworks["mainnet"], nil)
+	deal := OfflineDeal{PieceSize: "34091302912", Duration: "1036800", Cost: "0"}
+	if violations := offline.check(context.Background(), deal, MinerMessage{MinerID: "f01234"}); violations != nil {
+		t.Errorf("expected no violations without lotus, got %v", violations)
+	}
+	if ask := preflight.asks["f01234"]; ask == nil || ask.minPieceSize != 256 {
+		t.Errorf("expected the ask of f01234 to be kept, got %v", ask)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/minio-go/v7"
+)
+
+// minerRateLimiter spaces the deals proposed to each miner, so that a large
+// batch does not flood a miner with proposals.
+type minerRateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newMinerRateLimiter(interval time.Duration) *minerRateLimiter {
+	return &minerRateLimiter{
+		interval: interval,
+		next:     make(map[string]time.Time),
+	}
+}
+
+// wait blocks until a deal may be proposed to the miner.
+func (l *minerRateLimiter) wait(ctx context.Context, minerID string) error {
+	l.mutex.Lock()
+	now := time.Now()
+	at := l.next[minerID]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[minerID] = at.Add(l.interval)
+	l.mutex.Unlock()
+
+	select {
+	case <-time.After(time.Until(at)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// proposalRetryUnit is the first backoff between two proposals of a deal.
+var proposalRetryUnit = time.Second
+
+// lotusTimeoutMessages and lotusTransportMessages are parts of the messages
+// of the lotus errors of proposals which timed out, or which did not reach
+// the lotus node or the miner.
+var (
+	lotusTimeoutMessages   = []string{"timeout", "timed out", "deadline exceeded"}
+	lotusTransportMessages = []string{"connection refused", "connection reset", "broken pipe", "failed to dial", "failed to open stream", "stream reset", "502 bad gateway", "503 service unavailable"}
+)
+
+// isProposalRetryable returns whether a failed proposal is retried, only
+// transport errors and timeouts are, and whether it timed out. Rejections of
+// the miner, invalid prices or a wallet without enough funds fail the same
+// way when proposed again.
+func isProposalRetryable(err *probe.Error) (retry, timeout bool) {
+	e := err.ToGoError()
+	if errors.Is(e, context.DeadlineExceeded) {
+		return true, true
+	}
+	var netErr net.Error
+	if errors.As(e, &netErr) {
+		return true, netErr.Timeout()
+	}
+	msg := strings.ToLower(e.Error())
+	for _, part := range lotusTimeoutMessages {
+		if strings.Contains(msg, part) {
+			return true, true
+		}
+	}
+	for _, part := range lotusTransportMessages {
+		if strings.Contains(msg, part) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// findDealProposal returns the proposal CID of a pending deal of the piece
+// of deal with its miner, empty if the lotus node has none. A proposal which
+// timed out may have been made all the same.
+func findDealProposal(ctx context.Context, api *lotusClient, deal *OfflineDeal) (string, *probe.Error) {
+	infos, err := api.ClientListDeals(ctx)
+	if err != nil {
+		return "", err.Trace(deal.PieceCid, deal.MinerId)
+	}
+	for _, info := range infos {
+		if info.Provider != deal.MinerId || info.DealID != 0 {
+			continue
+		}
+		switch info.State {
+		case storageDealProposalNotFound, storageDealProposalRejected, storageDealFailing, storageDealError:
+			continue
+		}
+		pieceCid := info.PieceCID.String()
+		if pieceCid == "" && info.DataRef != nil {
+			pieceCid = info.DataRef.PieceCid.String()
+		}
+		if pieceCid == deal.PieceCid {
+			return info.ProposalCid.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// proposeOfflineDealWithRetry proposes a deal, and retries up to maxRetries
+// times with an exponential backoff when the proposal fails on a transport
+// error or a timeout. After a timeout, the deal is only proposed again if
+// the lotus node has no proposal of its piece to its miner.
+func proposeOfflineDealWithRetry(ctx context.Context, api *lotusClient, limiter *minerRateLimiter, deal *OfflineDeal, maxRetries int) *probe.Error {
+	retryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := probe.NewError(context.Canceled)
+	timedOut := false
+	for attempt := range newRetryTimerContinous(retryCtx, proposalRetryUnit, time.Second*30, minio.MaxJitter) {
+		if timedOut {
+			proposalCid, listErr := findDealProposal(retryCtx, api, deal)
+			if listErr != nil {
+				if attempt >= maxRetries {
+					break
+				}
+				errorIf(listErr, "Unable to look for the proposal of `"+deal.DataCid+"` to miner `"+deal.MinerId+"`, retrying.")
+				continue
+			}
+			if proposalCid != "" {
+				deal.DealCid = proposalCid
+				return nil
+			}
+		}
+		if e := limiter.wait(retryCtx, deal.MinerId); e != nil {
+			return probe.NewError(e).Trace(deal.DataCid, deal.MinerId)
+		}
+		err = proposeOfflineDeal(retryCtx, api, deal)
+		if err == nil || attempt >= maxRetries {
+			break
+		}
+		var retry bool
+		if retry, timedOut = isProposalRetryable(err); !retry {
+			break
+		}
+		errorIf(err, "Unable to propose deal for `"+deal.DataCid+"` to miner `"+deal.MinerId+"`, retrying.")
+	}
+	return err
+}
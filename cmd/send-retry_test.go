@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+)
+
+func TestMinerRateLimiter(t *testing.T) {
+	limiter := newMinerRateLimiter(100 * time.Millisecond)
+	ctx := context.Background()
+
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		if e := limiter.wait(ctx, "f01234"); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// Other miners are not held back by f01234.
+	if e := limiter.wait(ctx, "f05678"); e != nil {
+		t.Fatal(e)
+	}
+	if elapsed := time.Since(begin); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected 3 proposals to f01234 in 200ms, took %s", elapsed)
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if e := limiter.wait(canceledCtx, "f01234"); e == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestProposeOfflineDealWithRetry(t *testing.T) {
+	server, _ := newFakeLotusServer("", map[string]interface{}{
+		"Filecoin.ClientStartDeal": map[string]string{"/": "bafydeal"},
+	})
+	defer server.Close()
+
+	deal := &OfflineDeal{
+		MinerId:    "f01234",
+		Cost:       "0",
+		PieceCid:   "bafypiece",
+		PieceSize:  "2048",
+		DataCid:    "bafydata",
+		Duration:   "1036800",
+		StartEpoch: "100",
+	}
+	limiter := newMinerRateLimiter(0)
+	if err := proposeOfflineDealWithRetry(context.Background(), newLotusClient(server.URL, ""), limiter, deal, 2); err != nil {
+		t.Fatal(err)
+	}
+	if deal.DealCid != "bafydeal" {
+		t.Errorf("expected deal CID bafydeal, got %s", deal.DealCid)
+	}
+
+	failing, _ := newFakeLotusServer("", nil)
+	defer failing.Close()
+	if err := proposeOfflineDealWithRetry(context.Background(), newLotusClient(failing.URL, ""), limiter, deal, 0); err == nil {
+		t.Error("expected an error from a failing node")
+	}
+}
+
+func TestIsProposalRetryable(t *testing.T) {
+	testCases := []struct {
+		err     *probe.Error
+		retry   bool
+		timeout bool
+	}{
+		{probe.NewError(context.DeadlineExceeded), true, true},
+		{errLotusAPI("ClientStartDeal", "failed to start deal: context deadline exceeded"), true, true},
+		{errLotusAPI("ClientStartDeal", "504 Gateway Timeout: upstream timed out"), true, true},
+		{errLotusAPI("ClientStartDeal", "failed to dial f01234: dial tcp 10.0.0.3:24001: connect: connection refused"), true, false},
+		{errLotusAPI("ClientStartDeal", "503 Service Unavailable: "), true, false},
+		{errLotusAPI("ClientStartDeal", "deal rejected: miner is not accepting online storage deals"), false, false},
+		{errLotusAPI("ClientStartDeal", "failed to ensure funds: not enough funds (required: 0.5 FIL, balance: 0.1 FIL)"), false, false},
+		{errLotusAPI("ClientStartDeal", "storage price per epoch less than asking price: 0 < 500000000"), false, false},
+		{probe.NewError(errors.New("strconv.ParseUint: parsing \"abc\": invalid syntax")), false, false},
+	}
+	for i, testCase := range testCases {
+		retry, timeout := isProposalRetryable(testCase.err)
+		if retry != testCase.retry || timeout != testCase.timeout {
+			t.Errorf("Test %d: expected retry %t and timeout %t, got %t and %t for %s", i+1, testCase.retry, testCase.timeout, retry, timeout, testCase.err)
+		}
+	}
+}
+
+func TestProposeOfflineDealRetries(t *testing.T) {
+	savedUnit := proposalRetryUnit
+	proposalRetryUnit = time.Millisecond
+	defer func() { proposalRetryUnit = savedUnit }()
+
+	newDeal := func() *OfflineDeal {
+		return &OfflineDeal{
+			MinerId:    "f01234",
+			Cost:       "0",
+			PieceCid:   "bafypiece",
+			PieceSize:  "2048",
+			DataCid:    "bafydata",
+			Duration:   "1036800",
+			StartEpoch: "100",
+		}
+	}
+	// startDeal fails with the given errors, then proposes bafydeal.
+	startDeal := func(calls *int32, errs ...string) func([]json.RawMessage) interface{} {
+		return func([]json.RawMessage) interface{} {
+			if call := int(atomic.AddInt32(calls, 1)); call <= len(errs) {
+				return &lotusRPCError{Code: 1, Message: errs[call-1]}
+			}
+			return map[string]string{"/": "bafydeal"}
+		}
+	}
+	pendingDeals := []map[string]interface{}{
+		{"ProposalCid": map[string]string{"/": "bafyother"}, "State": 18, "Provider": "f05678", "PieceCID": map[string]string{"/": "bafypiece"}},
+		{"ProposalCid": map[string]string{"/": "bafyfailed"}, "State": storageDealError, "Provider": "f01234", "PieceCID": map[string]string{"/": "bafypiece"}},
+		{"ProposalCid": map[string]string{"/": "bafyactive"}, "State": storageDealActive, "Provider": "f01234", "PieceCID": map[string]string{"/": "bafypiece"}, "DealID": 7},
+	}
+	limiter := newMinerRateLimiter(0)
+
+	testCases := []struct {
+		errs    []string
+		deals   []map[string]interface{}
+		calls   int32
+		dealCid string
+		listed  bool
+		success bool
+	}{
+		// A rejection of the miner is not retried.
+		{[]string{"deal rejected: miner is not accepting storage deals"}, nil, 1, "", false, false},
+		// A transport error is retried without listing the deals.
+		{[]string{"failed to dial f01234: connection refused"}, nil, 2, "bafydeal", false, true},
+		// The proposal which timed out was made, it is not proposed again.
+		{[]string{"context deadline exceeded"}, append(pendingDeals, map[string]interface{}{
+			"ProposalCid": map[string]string{"/": "bafypending"}, "State": 18, "Provider": "f01234", "PieceCID": map[string]string{"/": "bafypiece"},
+		}), 1, "bafypending", true, true},
+		// The proposal which timed out was not made, it is proposed again.
+		{[]string{"context deadline exceeded"}, pendingDeals, 2, "bafydeal", true, true},
+		// Retries run out.
+		{[]string{"i/o timeout", "i/o timeout", "i/o timeout"}, pendingDeals, 3, "", true, false},
+	}
+	for i, testCase := range testCases {
+		var calls int32
+		results := map[string]interface{}{
+			"Filecoin.ClientStartDeal": startDeal(&calls, testCase.errs...),
+		}
+		if testCase.deals != nil {
+			results["Filecoin.ClientListDeals"] = testCase.deals
+		}
+		server, handler := newFakeLotusServer("", results)
+		deal := newDeal()
+		err := proposeOfflineDealWithRetry(context.Background(), newLotusClient(server.URL, ""), limiter, deal, 2)
+		server.Close()
+		if testCase.success != (err == nil) {
+			t.Errorf("Test %d: expected success %t, got %v", i+1, testCase.success, err)
+		}
+		if calls != testCase.calls {
+			t.Errorf("Test %d: expected %d proposals, got %d", i+1, testCase.calls, calls)
+		}
+		if deal.DealCid != testCase.dealCid {
+			t.Errorf("Test %d: expected deal CID %q, got %q", i+1, testCase.dealCid, deal.DealCid)
+		}
+		if _, listed := handler.params["Filecoin.ClientListDeals"]; listed != testCase.listed {
+			t.Errorf("Test %d: expected the deals listed %t, got %t", i+1, testCase.listed, listed)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+)
+
+// newSendSession creates the session of a `send --continue` batch, or loads
+// it when the same command was interrupted before. The deals are written to
+// the deal csv of the session, so that a resumed batch appends to it.
+func newSendSession(cliCtx *cli.Context, dealCsvPath string) (*sessionV8, *probe.Error) {
+	sessionID := getHash("send", os.Args[1:])
+	if isSessionExists(sessionID) {
+		session, err := loadSessionV8(sessionID)
+		if err != nil {
+			return nil, err.Trace(sessionID)
+		}
+		return session, nil
+	}
+
+	session := newSessionV8(sessionID)
+	session.Header.CommandType = "send"
+	session.Header.CommandArgs = cliCtx.Args()
+	session.Header.CommandBoolFlags["session"] = true
+	session.Header.CommandStringFlags["input"] = cliCtx.String("input")
+	session.Header.CommandStringFlags["output"] = dealCsvPath
+
+	var e error
+	if session.Header.RootPath, e = os.Getwd(); e != nil {
+		session.Delete()
+		return nil, probe.NewError(e)
+	}
+	if err := session.Save(); err != nil {
+		session.Delete()
+		return nil, err.Trace(sessionID)
+	}
+	return session, nil
+}
+
+// sentRows returns how many rows of the input csv were sent before the
+// session was interrupted.
+func sentRows(session *sessionV8) int {
+	rows, e := strconv.Atoi(session.Header.LastCopied)
+	if e != nil {
+		return 0
+	}
+	return rows
+}
+
+// setSentRows records that the first rows of the input csv are sent.
+func setSentRows(session *sessionV8, rows int) *probe.Error {
+	session.Header.LastCopied = strconv.Itoa(rows)
+	return session.Save()
+}
+
+// nextSentRows returns how many rows are sent without a gap from the first
+// row, given the rows sent so far.
+func nextSentRows(rows int, doneRows []bool) int {
+	for rows < len(doneRows) && doneRows[rows] {
+		rows++
+	}
+	return rows
+}
+
+// sentDeals returns the deals of a deal csv by data CID, rows without a
+// deal CID are left out. A missing deal csv has no deals.
+func sentDeals(dealCsvPath string) (map[string][]*OfflineDeal, *probe.Error) {
+	if _, e := os.Stat(dealCsvPath); os.IsNotExist(e) {
+		return nil, nil
+	}
+	deals, err := readDealCsv(dealCsvPath)
+	if err != nil {
+		return nil, err.Trace(dealCsvPath)
+	}
+	sent := make(map[string][]*OfflineDeal)
+	for _, deal := range deals {
+		if deal.DealCid != "" {
+			sent[deal.DataCid] = append(sent[deal.DataCid], deal)
+		}
+	}
+	return sent, nil
+}
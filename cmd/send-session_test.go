@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/cli"
+)
+
+func TestSendSession(t *testing.T) {
+	if err := createSessionDir(); err != nil {
+		t.Fatal(err)
+	}
+	flagSet := flag.NewFlagSet("send", flag.ContinueOnError)
+	flagSet.String("input", "", "")
+	if e := flagSet.Parse([]string{"--input", "/data/car/manifest.csv", "f01234"}); e != nil {
+		t.Fatal(e)
+	}
+	cliCtx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	session, err := newSendSession(cliCtx, "/data/car/dealMetadata-5a3c8f21.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Delete()
+	if rows := sentRows(session); rows != 0 {
+		t.Errorf("expected no rows sent by a new session, got %d", rows)
+	}
+	if err = setSentRows(session, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same command loads the session with its progress and deal csv.
+	resumed, err := newSendSession(cliCtx, "/data/car/dealMetadata-0b1d2e3f.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Delete()
+	if resumed.SessionID != session.SessionID {
+		t.Errorf("expected session %s, got %s", session.SessionID, resumed.SessionID)
+	}
+	if rows := sentRows(resumed); rows != 3 {
+		t.Errorf("expected 3 rows sent, got %d", rows)
+	}
+	if output := resumed.Header.CommandStringFlags["output"]; output != "/data/car/dealMetadata-5a3c8f21.csv" {
+		t.Errorf("expected the deal csv of the session, got %s", output)
+	}
+	if input := resumed.Header.CommandStringFlags["input"]; input != "/data/car/manifest.csv" {
+		t.Errorf("expected the input csv of the session, got %s", input)
+	}
+}
+
+func TestNextSentRows(t *testing.T) {
+	testCases := []struct {
+		rows     int
+		doneRows []bool
+		expected int
+	}{
+		{0, []bool{false, true, true}, 0},
+		{0, []bool{true, true, false, true}, 2},
+		{2, []bool{false, false, true, true}, 4},
+		// The rows resumed from the session count as sent.
+		{1, []bool{false, false, true}, 1},
+		{3, []bool{false, false, false}, 3},
+	}
+	for i, testCase := range testCases {
+		if rows := nextSentRows(testCase.rows, testCase.doneRows); rows != testCase.expected {
+			t.Errorf("Test %d: expected %d, got %d", i+1, testCase.expected, rows)
+		}
+	}
+}
+
+func TestSentDeals(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mc-send-session")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	dealCsvPath := filepath.Join(dir, "dealMetadata-5a3c8f21.csv")
+	sent, err := sentDeals(dealCsvPath)
+	if err != nil || len(sent) != 0 {
+		t.Fatalf("expected no deals without a deal csv, got %v, %v", sent, err)
+	}
+
+	for _, deal := range []OfflineDeal{
+		{DataCid: "bafy1", DealCid: "deal1a", MinerId: "f01234"},
+		{DataCid: "bafy1", DealCid: "deal1b", MinerId: "f05678"},
+		{DataCid: "bafy2", DealCid: "deal2", MinerId: "f01234"},
+		// A row without deal CID is not a replica.
+		{DataCid: "bafy3", MinerId: "f01234"},
+	} {
+		writeCsv(dealCsvPath, deal)
+	}
+	if sent, err = sentDeals(dealCsvPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || len(sent["bafy1"]) != 2 || len(sent["bafy2"]) != 1 {
+		t.Errorf("unexpected deals %v", sent)
+	}
+	if sent["bafy1"][1].MinerId != "f05678" {
+		t.Errorf("expected the second replica of bafy1 to be f05678, got %s", sent["bafy1"][1].MinerId)
+	}
+}
@@ -34,6 +34,7 @@ var shareSubcommands = []cli.Command{
 	shareDownload,
 	shareUpload,
 	shareList,
+	shareRenew,
 }
 
 // Share documents via URL.
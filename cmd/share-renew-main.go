@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+)
+
+var shareRenewFlags = []cli.Flag{
+	shareFlagExpire,
+}
+
+// Renew the download URLs of deal CSV files.
+var shareRenew = cli.Command{
+	Name:         "renew",
+	Usage:        "renew the download URLs of the CAR files of deal CSV files",
+	Action:       mainShareRenew,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(shareRenewFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] CSV [CSV...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Every car_url of the CSV files, such as the dealMetadata-<uuid>.csv written by
+  'send --upload-to' or 'archive', is signed again for the new expiry, and the car_url
+  and car_url_expiry columns are updated. The rows sharing a URL get the same new URL.
+  The object of a URL is the one saved by 'share download', or the object of the alias
+  whose URL the shared URL starts with once it has expired. A CSV file is only updated
+  when all of its URLs are renewed.
+
+EXAMPLES:
+  1. Renew the download URLs of a deal CSV file for 7 days.
+     {{.Prompt}} {{.HelpName}} dealMetadata-0c2d0e8c.csv
+
+  2. Renew the download URLs of the deal CSV files of a batch for 3 days.
+     {{.Prompt}} {{.HelpName}} --expire 72h /data/car/batch-42/dealMetadata-*.csv
+`,
+}
+
+// sharedObject returns the object URL of a shared URL, from the share DB or
+// from the URL itself, its version and the alias the object belongs to.
+func sharedObject(shareDB *shareDBV1, shareURL string) (alias, objectURL, versionID string, err *probe.Error) {
+	u, e := url.Parse(shareURL)
+	if e != nil {
+		return "", "", "", probe.NewError(e).Trace(shareURL)
+	}
+	objectURL = u.Scheme + "://" + u.Host + u.Path
+	versionID = u.Query().Get("versionId")
+	if share, ok := shareDB.Shares[shareURL]; ok {
+		objectURL = share.URL
+	}
+
+	cfg, err := loadMcConfig()
+	if err != nil {
+		return "", "", "", err.Trace(shareURL)
+	}
+	// The alias of the longest URL wins, sorted for a stable choice.
+	var aliases []string
+	for name := range cfg.Aliases {
+		aliases = append(aliases, name)
+	}
+	sort.Strings(aliases)
+	var aliasURL string
+	for _, name := range aliases {
+		prefix := strings.TrimSuffix(cfg.Aliases[name].URL, "/") + "/"
+		if strings.HasPrefix(objectURL, prefix) && len(prefix) > len(aliasURL) {
+			alias, aliasURL = name, prefix
+		}
+	}
+	if alias == "" {
+		return "", "", "", errUnknownShareURL(shareURL).Trace(shareURL)
+	}
+	return alias, objectURL, versionID, nil
+}
+
+// renewCsvShares signs again every car_url of a CSV file for expiry, saves
+// the new URLs in shareDB and updates the car_url and car_url_expiry columns.
+// It returns the renewed shares, the CSV file is left as is on errors.
+func renewCsvShares(ctx context.Context, csvPath string, expiry time.Duration, shareDB *shareDBV1) ([]shareMesssage, *probe.Error) {
+	var shares []shareMesssage
+	renewed := make(map[string]string)
+	expiryTime := UTCNow().Add(expiry).Format(time.RFC3339)
+	err := updateCsvColumns(csvPath, []string{"car_url", "car_url_expiry"}, func(row map[string]string) *probe.Error {
+		carURL := strings.TrimSpace(row["car_url"])
+		if carURL == "" {
+			return nil
+		}
+		shareURL, ok := renewed[carURL]
+		if !ok {
+			alias, objectURL, versionID, err := sharedObject(shareDB, carURL)
+			if err != nil {
+				return err.Trace(carURL)
+			}
+			clnt, err := newClientFromAlias(alias, objectURL)
+			if err != nil {
+				return err.Trace(objectURL)
+			}
+			shareURL, err = clnt.ShareDownload(ctx, versionID, expiry)
+			if err != nil {
+				return err.Trace(objectURL, "expiry="+expiry.String())
+			}
+
+			// Not useful for download shares.
+			contentType := ""
+			shareDB.Set(objectURL, shareURL, expiry, contentType)
+			renewed[carURL] = shareURL
+			shares = append(shares, shareMesssage{
+				ObjectURL: objectURL,
+				ShareURL:  shareURL,
+				TimeLeft:  expiry,
+			})
+		}
+		row["car_url"] = shareURL
+		row["car_url_expiry"] = expiryTime
+		return nil
+	})
+	if err != nil {
+		return nil, err.Trace(csvPath)
+	}
+	return shares, nil
+}
+
+// mainShareRenew is the handle for "mc share renew" command.
+func mainShareRenew(cliCtx *cli.Context) error {
+	ctx, cancelShareRenew := context.WithCancel(globalContext)
+	defer cancelShareRenew()
+
+	if !cliCtx.Args().Present() {
+		cli.ShowCommandHelpAndExit(cliCtx, "renew", globalErrorExitStatus)
+	}
+	expiry := shareDefaultExpiry
+	if expireArg := cliCtx.String("expire"); expireArg != "" {
+		var e error
+		expiry, e = time.ParseDuration(expireArg)
+		fatalIf(probe.NewError(e), "Unable to parse expire=`"+expireArg+"`.")
+	}
+	if expiry.Seconds() < 1 {
+		fatalIf(errDummy().Trace(expiry.String()), "Expiry cannot be lesser than 1 second.")
+	}
+	if expiry.Seconds() > 604800 {
+		fatalIf(errDummy().Trace(expiry.String()), "Expiry cannot be larger than 7 days.")
+	}
+
+	// Initialize share config folder.
+	initShareConfig()
+
+	// Additional command speific theme customization.
+	shareSetColor()
+
+	shareDB := newShareDBV1()
+	shareDownloadsFile := getShareDownloadsFile()
+	fatalIf(shareDB.Load(shareDownloadsFile), "Unable to load `"+shareDownloadsFile+"`.")
+
+	failed := false
+	for _, csvPath := range cliCtx.Args() {
+		shares, err := renewCsvShares(ctx, csvPath, expiry, shareDB)
+		if err != nil {
+			errorIf(err, "Unable to renew the download URLs of `"+csvPath+"`.")
+			failed = true
+			continue
+		}
+		for _, share := range shares {
+			printMsg(share)
+		}
+	}
+	fatalIf(shareDB.Save(shareDownloadsFile), "Unable to save `"+shareDownloadsFile+"`.")
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenewCsvShares(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	// Presigning only asks the server for the region of the bucket.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	cfg := newMcConfig()
+	cfg.Aliases["swan"] = aliasConfigV10{
+		URL:       server.URL,
+		AccessKey: "WLGDGYAQYIGI833EV05A",
+		SecretKey: "BYvgJM101sHngl2uzjXS/OBF/aMxAN06JrJ3qJlF",
+		API:       "S3v4",
+		Path:      "on",
+	}
+	if err := saveMcConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	loadMcConfig = loadMcConfigFactory()
+
+	quiet := globalQuiet
+	globalQuiet = true
+	defer func() { globalQuiet = quiet }()
+	initShareConfig()
+
+	dir, e := ioutil.TempDir("", "mc-share-renew")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two slices of a CAR file shared by an expired URL.
+	expiredURL := server.URL + "/swan/batch-1/graph.car?X-Amz-Expires=60&versionId=v1"
+	csvPath := filepath.Join(dir, "dealMetadata.csv")
+	data := "uuid,car_file_name,car_url\n" +
+		"1,graph.car," + expiredURL + "\n" +
+		"2,graph.car," + expiredURL + "\n" +
+		"3,other.car,\n"
+	if e = ioutil.WriteFile(csvPath, []byte(data), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	shareDB := newShareDBV1()
+	shares, err := renewCsvShares(context.Background(), csvPath, 72*time.Hour, shareDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 {
+		t.Fatalf("expected the shared URL to be renewed once, got %d shares", len(shares))
+	}
+	if shares[0].ObjectURL != server.URL+"/swan/batch-1/graph.car" {
+		t.Errorf("unexpected object URL %s", shares[0].ObjectURL)
+	}
+	shareURL := shares[0].ShareURL
+	if !strings.Contains(shareURL, "X-Amz-Expires=259200") || !strings.Contains(shareURL, "versionId=v1") {
+		t.Errorf("unexpected share URL %s", shareURL)
+	}
+	if share, ok := shareDB.Shares[shareURL]; !ok || share.URL != shares[0].ObjectURL {
+		t.Errorf("expected the share DB to hold the renewed URL, got %+v", shareDB.Shares)
+	}
+
+	file, e := os.Open(csvPath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	records, e := csv.NewReader(file).ReadAll()
+	file.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(records[0], ",") != "uuid,car_file_name,car_url,car_url_expiry" {
+		t.Fatalf("unexpected header %v", records[0])
+	}
+	for _, record := range records[1:3] {
+		if record[2] != shareURL {
+			t.Errorf("expected car_url %s, got %s", shareURL, record[2])
+		}
+		if _, e := time.Parse(time.RFC3339, record[3]); e != nil {
+			t.Errorf("unexpected car_url_expiry %q: %v", record[3], e)
+		}
+	}
+	if records[3][2] != "" || records[3][3] != "" {
+		t.Errorf("expected a row without car_url to be left as is, got %v", records[3])
+	}
+
+	// A URL of no alias fails and leaves the CSV file as is.
+	data = "uuid,car_url\n1," + shareURL + "\n2,http://unknown.example.com/swan/graph.car\n"
+	if e = ioutil.WriteFile(csvPath, []byte(data), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, err = renewCsvShares(context.Background(), csvPath, time.Hour, shareDB); err == nil {
+		t.Fatal("expected an error for an unknown share URL")
+	}
+	content, e := ioutil.ReadFile(csvPath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(content) != data {
+		t.Errorf("expected the CSV file to be left as is, got %q", content)
+	}
+}
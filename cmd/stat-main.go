@@ -56,7 +56,7 @@ var statCmd = cli.Command{
 	Action:       mainStat,
 	OnUsageError: onUsageError,
 	Before:       setGlobalsFromContext,
-	Flags:        append(append(statFlags, ioFlags...), globalFlags...),
+	Flags:        append(append(append(statFlags, ioFlags...), cidFlags...), globalFlags...),
 	CustomHelpTemplate: `NAME:
   {{.HelpName}} - {{.Usage}}
 
@@ -91,6 +91,9 @@ EXAMPLES:
 
   7. Stat all objects versions recursively created before 1st January 2020.
      {{.Prompt}} {{.HelpName}} --versions --rewind 2020.01.01T00:00 s3/personal-docs/
+
+  8. Show the UnixFS CID of an object as a CIDv1, to check it against data retrieved from filecoin.
+     {{.Prompt}} {{.HelpName}} --cid --cid-version 1 s3/personal-docs/2018-account_report.docx
 `,
 }
 
@@ -134,6 +137,31 @@ func parseAndCheckStatSyntax(ctx context.Context, cliCtx *cli.Context, encKeyDB
 	return URLs, recursive, versionID, rewind, withVersions
 }
 
+// statObjectURL returns the URL of a content found by statURL, whose path is
+// relative to the folder of the target.
+func statObjectURL(targetURL string, content *ClientContent) string {
+	separator := "/"
+	if content.URL.Separator != 0 {
+		separator = string(content.URL.Separator)
+	}
+	targetDir := targetURL
+	if !strings.HasSuffix(targetDir, separator) {
+		targetDir = targetDir[:strings.LastIndex(targetDir, separator)+1]
+	}
+	return targetDir + content.URL.Path
+}
+
+// statObjectCID returns the UnixFS CID of a content found by statURL.
+func statObjectCID(ctx context.Context, targetURL string, content *ClientContent, encKeyDB map[string][]prefixSSEPair, opts objectCIDOptions) string {
+	objectURL := statObjectURL(targetURL, content)
+	alias, urlStr, _ := mustExpandAlias(objectURL)
+	opts.alias = alias
+	sse := getSSE(objectURL, encKeyDB[alias])
+	objectCid, err := objectCID(ctx, urlStr, content.VersionID, sse, opts)
+	errorIf(err, "Unable to compute the CID of `"+objectURL+"`.")
+	return objectCid
+}
+
 // mainStat - is a handler for mc stat command
 func mainStat(cliCtx *cli.Context) error {
 	ctx, cancelStat := context.WithCancel(globalContext)
@@ -157,6 +185,7 @@ func mainStat(cliCtx *cli.Context) error {
 
 	// check 'stat' cli arguments.
 	args, isRecursive, versionID, rewind, withVersions := parseAndCheckStatSyntax(ctx, cliCtx, encKeyDB)
+	cidOpts := parseCIDFlags(cliCtx)
 	// mimic operating system tool behavior.
 	if len(args) == 0 {
 		args = []string{"."}
@@ -171,6 +200,9 @@ func mainStat(cliCtx *cli.Context) error {
 		for _, content := range contents {
 			stat := parseStat(content)
 			stat.singleObject = len(contents) == 1
+			if cidOpts != nil && !content.Type.IsDir() && !content.IsDeleteMarker {
+				stat.CID = statObjectCID(ctx, targetURL, content, encKeyDB, *cidOpts)
+			}
 			printMsg(stat)
 		}
 		for _, binfo := range bstats {
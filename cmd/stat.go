@@ -44,6 +44,7 @@ type statMessage struct {
 	Date              time.Time         `json:"lastModified"`
 	Size              int64             `json:"size"`
 	ETag              string            `json:"etag"`
+	CID               string            `json:"cid,omitempty"`
 	Type              string            `json:"type"`
 	Expires           time.Time         `json:"expires"`
 	Expiration        time.Time         `json:"expiration"`
@@ -65,6 +66,9 @@ func (stat statMessage) String() (msg string) {
 	if stat.ETag != "" {
 		msgBuilder.WriteString(fmt.Sprintf("%-10s: %s ", "ETag", stat.ETag) + "\n")
 	}
+	if stat.CID != "" {
+		msgBuilder.WriteString(fmt.Sprintf("%-10s: %s ", "CID", stat.CID) + "\n")
+	}
 	if stat.VersionID != "" {
 		versionIDField := stat.VersionID
 		if stat.DeleteMarker {
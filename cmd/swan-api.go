@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	json "github.com/minio/colorjson"
+)
+
+const (
+	// swanAPIEnv overrides the swan API base URL of the config file.
+	swanAPIEnv = "SWAN_API"
+	// swanTokenEnv overrides the swan API token of the config file.
+	swanTokenEnv    = "SWAN_TOKEN"
+	defaultSwanAPI  = "https://api.filswan.com"
+	swanMinersPath  = "/miners"
+	swanPageSize    = 100
+	swanCacheDir    = "swan-cache"
+	defaultSwanTTL  = 10 * time.Minute
+	defaultSwanWait = 5 * time.Second
+)
+
+// swanMinerQuery selects the miners listed by the swan API.
+type swanMinerQuery struct {
+	Region string
+	Status string
+	// Limit is the number of miners to list from Offset, all of them when 0.
+	Limit  int
+	Offset int
+	// NoCache skips the responses cached on disk.
+	NoCache bool
+}
+
+// swanAPIConfig is where and how the swan API is reached, from $SWAN_API,
+// $SWAN_TOKEN and the `swan` entry of the config file.
+type swanAPIConfig struct {
+	api      string
+	token    string
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+// loadSwanAPIConfig returns the swan API settings, with their defaults.
+func loadSwanAPIConfig() (swanAPIConfig, *probe.Error) {
+	swan := swanAPIConfig{api: defaultSwanAPI, timeout: defaultSwanWait, cacheTTL: defaultSwanTTL}
+	if isMcConfigExists() {
+		cfg, err := loadConfigV10()
+		if err != nil {
+			return swan, err.Trace()
+		}
+		if cfg.Swan != nil {
+			if cfg.Swan.API != "" {
+				swan.api = cfg.Swan.API
+			}
+			swan.token = cfg.Swan.Token
+			if cfg.Swan.Timeout != "" {
+				timeout, e := time.ParseDuration(cfg.Swan.Timeout)
+				if e != nil {
+					return swan, probe.NewError(e).Trace(cfg.Swan.Timeout)
+				}
+				swan.timeout = timeout
+			}
+			if cfg.Swan.CacheTTL != "" {
+				cacheTTL, e := time.ParseDuration(cfg.Swan.CacheTTL)
+				if e != nil {
+					return swan, probe.NewError(e).Trace(cfg.Swan.CacheTTL)
+				}
+				swan.cacheTTL = cacheTTL
+			}
+		}
+	}
+	if api := strings.TrimSpace(os.Getenv(swanAPIEnv)); api != "" {
+		swan.api = api
+	}
+	if token := strings.TrimSpace(os.Getenv(swanTokenEnv)); token != "" {
+		swan.token = token
+	}
+	swan.api = strings.TrimSuffix(swan.api, "/")
+	return swan, nil
+}
+
+// pageURL returns the URL of a page of the miner list.
+func (s swanAPIConfig) pageURL(query swanMinerQuery, offset, limit int) (string, *probe.Error) {
+	pageURL, e := url.Parse(s.api + swanMinersPath)
+	if e != nil {
+		return "", probe.NewError(e).Trace(s.api)
+	}
+	values := pageURL.Query()
+	values.Set("limit", strconv.Itoa(limit))
+	values.Set("offset", strconv.Itoa(offset))
+	values.Set("sort_by", "score")
+	values.Set("order", "ascending")
+	if query.Status != "" {
+		values.Set("status", query.Status)
+	}
+	if query.Region != "" {
+		values.Set("location", query.Region)
+	}
+	pageURL.RawQuery = values.Encode()
+	return pageURL.String(), nil
+}
+
+// getSwanCacheFile returns the file caching the response of a URL.
+func getSwanCacheFile(pageURL string) (string, *probe.Error) {
+	configDir, err := getMcConfigDir()
+	if err != nil {
+		return "", err.Trace()
+	}
+	sum := sha256.Sum256([]byte(pageURL))
+	return filepath.Join(configDir, swanCacheDir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// get returns the body of a swan API response, from the disk cache when it
+// is fresher than the cache TTL.
+func (s swanAPIConfig) get(ctx context.Context, pageURL string, noCache bool) ([]byte, *probe.Error) {
+	cacheFile, err := getSwanCacheFile(pageURL)
+	if err != nil {
+		return nil, err.Trace(pageURL)
+	}
+	if !noCache && s.cacheTTL > 0 {
+		if st, e := os.Stat(cacheFile); e == nil && time.Since(st.ModTime()) < s.cacheTTL {
+			if body, e := ioutil.ReadFile(cacheFile); e == nil {
+				return body, nil
+			}
+		}
+	}
+
+	request, e := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(pageURL)
+	}
+	body, err := s.do(request)
+	if err != nil {
+		return nil, err.Trace(pageURL)
+	}
+
+	// The cache is only an optimization, failing to write it is not an error.
+	if s.cacheTTL > 0 {
+		if e = os.MkdirAll(filepath.Dir(cacheFile), 0700); e == nil {
+			ioutil.WriteFile(cacheFile, body, 0600)
+		}
+	}
+	return body, nil
+}
+
+// do sends a request to the swan API, with the token if any, and returns
+// the body of the response.
+func (s swanAPIConfig) do(request *http.Request) ([]byte, *probe.Error) {
+	if s.token != "" {
+		request.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	client := http.Client{Timeout: s.timeout}
+	resp, e := client.Do(request)
+	defer closeResponse(resp)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(request.URL.String())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errSwanAPI(request.URL.String(), resp.Status).Trace(request.URL.String())
+	}
+	body, e := ioutil.ReadAll(resp.Body)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(request.URL.String())
+	}
+	return body, nil
+}
+
+// fetchSwanMiners gets the miners listed by the swan API, page by page.
+func fetchSwanMiners(ctx context.Context, query swanMinerQuery) ([]MinerMessage, *probe.Error) {
+	var miners []MinerMessage
+	err := walkSwanMiners(ctx, query, func(miner MinerMessage) bool {
+		miners = append(miners, miner)
+		return true
+	})
+	if err != nil {
+		return nil, err.Trace()
+	}
+	return miners, nil
+}
+
+// findSwanMiners gets the swan listing of the given miners by ID, it stops
+// paging through the miner list as soon as all of them are found.
+func findSwanMiners(ctx context.Context, minerIDs []string) (map[string]*MinerMessage, *probe.Error) {
+	found := make(map[string]*MinerMessage)
+	wanted := make(map[string]bool)
+	for _, minerID := range minerIDs {
+		wanted[minerID] = true
+	}
+	err := walkSwanMiners(ctx, swanMinerQuery{}, func(miner MinerMessage) bool {
+		if wanted[miner.MinerID] && found[miner.MinerID] == nil {
+			found[miner.MinerID] = &miner
+		}
+		return len(found) < len(wanted)
+	})
+	if err != nil {
+		return nil, err.Trace(minerIDs...)
+	}
+	return found, nil
+}
+
+// walkSwanMiners calls fn with the miners listed by the swan API, page by
+// page, until fn returns false.
+func walkSwanMiners(ctx context.Context, query swanMinerQuery, fn func(MinerMessage) bool) *probe.Error {
+	swan, err := loadSwanAPIConfig()
+	if err != nil {
+		return err.Trace()
+	}
+
+	listed := 0
+	offset := query.Offset
+	for query.Limit == 0 || listed < query.Limit {
+		limit := swanPageSize
+		if query.Limit > 0 && query.Limit-listed < limit {
+			limit = query.Limit - listed
+		}
+		pageURL, err := swan.pageURL(query, offset, limit)
+		if err != nil {
+			return err.Trace()
+		}
+		body, err := swan.get(ctx, pageURL, query.NoCache)
+		if err != nil {
+			return err.Trace()
+		}
+		response := minerResponse{}
+		if e := json.Unmarshal(body, &response); e != nil {
+			return probe.NewError(e).Trace(pageURL)
+		}
+		for _, miner := range response.Data.Miner {
+			if !fn(miner) {
+				return nil
+			}
+		}
+		listed += len(response.Data.Miner)
+		if len(response.Data.Miner) < limit {
+			break
+		}
+		offset += len(response.Data.Miner)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestFetchSwanMiners(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		response := minerResponse{Status: "success"}
+		for i := offset; i < offset+limit && i < 250; i++ {
+			response.Data.Miner = append(response.Data.Miner, MinerMessage{MinerID: fmt.Sprintf("f0%d", 1000+i)})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	configDir, e := ioutil.TempDir("", "swan-cache")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(configDir)
+	savedConfigDir, savedAPI := mcCustomConfigDir, os.Getenv(swanAPIEnv)
+	mcCustomConfigDir = configDir
+	os.Setenv(swanAPIEnv, server.URL)
+	defer func() {
+		mcCustomConfigDir = savedConfigDir
+		os.Setenv(swanAPIEnv, savedAPI)
+	}()
+
+	testCases := []struct {
+		query    swanMinerQuery
+		miners   int
+		requests int
+	}{
+		{swanMinerQuery{Limit: 10}, 10, 1},
+		{swanMinerQuery{Limit: 100, Offset: 200}, 50, 1},
+		{swanMinerQuery{Limit: 150}, 150, 2},
+		// The first and last pages are served from the cache.
+		{swanMinerQuery{}, 250, 1},
+		{swanMinerQuery{}, 250, 0},
+		{swanMinerQuery{NoCache: true}, 250, 3},
+	}
+	for i, testCase := range testCases {
+		requests = 0
+		miners, err := fetchSwanMiners(context.Background(), testCase.query)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if len(miners) != testCase.miners || requests != testCase.requests {
+			t.Errorf("Test %d: expected %d miners in %d requests, got %d in %d", i+1, testCase.miners, testCase.requests, len(miners), requests)
+		}
+	}
+
+	// Only the pages up to the last requested miner are fetched.
+	findCases := []struct {
+		minerIDs []string
+		found    int
+		requests int
+	}{
+		{[]string{"f01005"}, 1, 1},
+		{[]string{"f01005", "f01150"}, 2, 2},
+		{[]string{"f01005", "f09999"}, 1, 3},
+	}
+	for i, testCase := range findCases {
+		requests = 0
+		os.RemoveAll(filepath.Join(configDir, swanCacheDir))
+		found, err := findSwanMiners(context.Background(), testCase.minerIDs)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if len(found) != testCase.found || requests != testCase.requests {
+			t.Errorf("Test %d: expected %d miners in %d requests, got %d in %d", i+1, testCase.found, testCase.requests, len(found), requests)
+		}
+		if miner := found["f01005"]; miner == nil || miner.MinerID != "f01005" {
+			t.Errorf("Test %d: expected miner f01005, got %v", i+1, miner)
+		}
+	}
+}
+
+func TestFilterAndSortMiners(t *testing.T) {
+	miners := []MinerMessage{
+		{MinerID: "f01000", Price: "0.0000002", Score: 80.0, AdjustedPower: "1 PiB", OfflineDealAvailable: true},
+		{MinerID: "f01001", Price: "invalid", Score: "95", AdjustedPower: "10 TiB", OfflineDealAvailable: true},
+		{MinerID: "f01002", Price: "0.0000001", Score: 90.0, AdjustedPower: "2 PiB"},
+	}
+	ids := func(miners []MinerMessage) []string {
+		var ids []string
+		for _, m := range miners {
+			ids = append(ids, m.MinerID)
+		}
+		return ids
+	}
+
+	maxPrice, err := parseFIL("150 nanoFIL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filtered := ids(filterMiners(miners, maxPrice, false)); !reflect.DeepEqual(filtered, []string{"f01002"}) {
+		t.Errorf("expected f01002 at most 150 nanoFIL, got %v", filtered)
+	}
+	if filtered := ids(filterMiners(miners, nil, true)); !reflect.DeepEqual(filtered, []string{"f01000", "f01001"}) {
+		t.Errorf("expected f01000 and f01001 offline, got %v", filtered)
+	}
+
+	testCases := []struct {
+		sortBy string
+		miners []string
+	}{
+		{"price", []string{"f01002", "f01000", "f01001"}},
+		{"score", []string{"f01001", "f01002", "f01000"}},
+		{"power", []string{"f01002", "f01000", "f01001"}},
+	}
+	for _, testCase := range testCases {
+		sorted := append([]MinerMessage(nil), miners...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return minerSorters[testCase.sortBy](sorted[i], sorted[j])
+		})
+		if got := ids(sorted); !reflect.DeepEqual(got, testCase.miners) {
+			t.Errorf("sort by %s: expected %v, got %v", testCase.sortBy, testCase.miners, got)
+		}
+	}
+}
+
+func TestListSwanMiners(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		response := minerResponse{Status: "success"}
+		// The miners of the last pages are the cheapest and the only ones
+		// accepting offline deals.
+		for i := offset; i < offset+limit && i < 250; i++ {
+			response.Data.Miner = append(response.Data.Miner, MinerMessage{
+				MinerID:              fmt.Sprintf("f0%d", 1000+i),
+				Price:                fmt.Sprintf("%d nanoFIL", 1000-i),
+				OfflineDealAvailable: i >= 150,
+			})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	configDir, e := ioutil.TempDir("", "swan-cache")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(configDir)
+	savedConfigDir, savedAPI := mcCustomConfigDir, os.Getenv(swanAPIEnv)
+	mcCustomConfigDir = configDir
+	os.Setenv(swanAPIEnv, server.URL)
+	defer func() {
+		mcCustomConfigDir = savedConfigDir
+		os.Setenv(swanAPIEnv, savedAPI)
+	}()
+
+	maxPrice, err := parseFIL("800 nanoFIL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		limit       int
+		maxPrice    bool
+		offlineOnly bool
+		sortBy      string
+		first, last string
+		miners      int
+		requests    int
+	}{
+		{10, false, false, "", "f01000", "f01009", 10, 1},
+		{10, false, true, "", "f01150", "f01159", 10, 3},
+		{10, true, false, "", "f01200", "f01209", 10, 3},
+		{5, false, false, "price", "f01249", "f01245", 5, 3},
+		{0, false, true, "price", "f01249", "f01150", 100, 3},
+	}
+	for i, testCase := range testCases {
+		requests = 0
+		var price *big.Int
+		if testCase.maxPrice {
+			price = maxPrice
+		}
+		query := swanMinerQuery{Limit: testCase.limit, NoCache: true}
+		miners, err := listSwanMiners(context.Background(), query, price, testCase.offlineOnly, testCase.sortBy)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i+1, err)
+		}
+		if len(miners) != testCase.miners || requests != testCase.requests {
+			t.Fatalf("Test %d: expected %d miners in %d requests, got %d in %d", i+1, testCase.miners, testCase.requests, len(miners), requests)
+		}
+		if first, last := miners[0].MinerID, miners[len(miners)-1].MinerID; first != testCase.first || last != testCase.last {
+			t.Errorf("Test %d: expected miners %s to %s, got %s to %s", i+1, testCase.first, testCase.last, first, last)
+		}
+	}
+}
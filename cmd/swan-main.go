@@ -0,0 +1,44 @@
+package cmd
+
+import "github.com/minio/cli"
+
+var swanCmdSubcommands = []cli.Command{
+	swanTaskCmd,
+}
+
+var swanCmd = cli.Command{
+	Name:            "swan",
+	Usage:           "manage offline deal tasks on the swan platform",
+	Action:          mainSwan,
+	Before:          setGlobalsFromContext,
+	Flags:           globalFlags,
+	HideHelpCommand: true,
+	Subcommands:     swanCmdSubcommands,
+}
+
+// mainSwan is the handle for "mc swan" command.
+func mainSwan(ctx *cli.Context) error {
+	commandNotFound(ctx, swanCmdSubcommands)
+	return nil
+}
+
+var swanTaskCmdSubcommands = []cli.Command{
+	swanTaskCreateCmd,
+	swanTaskStatusCmd,
+}
+
+var swanTaskCmd = cli.Command{
+	Name:            "task",
+	Usage:           "create and follow swan tasks",
+	Action:          mainSwanTask,
+	Before:          setGlobalsFromContext,
+	Flags:           globalFlags,
+	HideHelpCommand: true,
+	Subcommands:     swanTaskCmdSubcommands,
+}
+
+// mainSwanTask is the handle for "mc swan task" command.
+func mainSwanTask(ctx *cli.Context) error {
+	commandNotFound(ctx, swanTaskCmdSubcommands)
+	return nil
+}
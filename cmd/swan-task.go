@@ -0,0 +1,523 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+	json "github.com/minio/colorjson"
+	csv "github.com/minio/minio/pkg/csvparser"
+)
+
+const (
+	swanTasksPath = "/tasks"
+	// swanTaskIDColumn is the column of the task ID in the task CSV.
+	swanTaskIDColumn = "task_id"
+)
+
+var swanTaskCreateFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "name",
+		Usage: "specify the name of the task",
+	},
+	cli.StringFlag{
+		Name:  "description",
+		Usage: "specify a description of the task",
+	},
+	cli.StringFlag{
+		Name:  "car-dir",
+		Usage: "specify the directory of the CAR files, the task is created from its manifest unless a CSV is given",
+	},
+	cli.BoolFlag{
+		Name:  "curated",
+		Usage: "mark the task as a curated dataset",
+	},
+	cli.BoolFlag{
+		Name:  "public",
+		Usage: "make the task public so that any miner can bid for it",
+	},
+	cli.BoolTFlag{
+		Name:  "fast-retrieval",
+		Usage: "ask the miners for fast retrieval, default: true",
+	},
+	cli.BoolFlag{
+		Name:  "verified",
+		Usage: "create a task of verified deals",
+	},
+}
+
+var swanTaskCreateCmd = cli.Command{
+	Name:         "create",
+	Usage:        "create a swan task from a batch of offline deals",
+	Action:       mainSwanTaskCreate,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        append(swanTaskCreateFlags, globalFlags...),
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} --name NAME [FLAGS] CSV-FILE
+  {{.HelpName}} --name NAME --car-dir DIR [FLAGS] [CSV-FILE]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Create a task on the swan platform from a dealMetadata CSV written by 'send', or
+  from the manifest of a CAR directory written by 'car generate'. The ID of the task
+  is written to the task_id column of the CSV. The swan API is set with $SWAN_API and
+  $SWAN_TOKEN, or in the 'swan' entry of the config file.
+
+EXAMPLES:
+  1. Create a task from the deals of a batch.
+     {{.Prompt}} {{.HelpName}} --name dataset-1 /data/car/dealMetadata-5a3c8f21.csv
+
+  2. Create a public task of verified deals from a CAR directory.
+     {{.Prompt}} {{.HelpName}} --name dataset-1 --public --verified --car-dir /data/car
+`,
+}
+
+var swanTaskStatusCmd = cli.Command{
+	Name:         "status",
+	Usage:        "show the state of swan tasks",
+	Action:       mainSwanTaskStatus,
+	OnUsageError: onUsageError,
+	Before:       setGlobalsFromContext,
+	Flags:        globalFlags,
+	CustomHelpTemplate: `NAME:
+  {{.HelpName}} - {{.Usage}}
+
+USAGE:
+  {{.HelpName}} [FLAGS] TASK-ID | CSV-FILE [TASK-ID | CSV-FILE...]
+
+FLAGS:
+  {{range .VisibleFlags}}{{.}}
+  {{end}}
+DESCRIPTION:
+  Look up a task and its deals on the swan platform, by its ID or from the task_id
+  column of a CSV written by 'swan task create'.
+
+EXAMPLES:
+  1. Show the state of a task.
+     {{.Prompt}} {{.HelpName}} 8b6cbd8f-1e1c-4d3c-9a1c-2a4f5e6d7c8b
+
+  2. Show the state of the task of a batch in JSON format.
+     {{.Prompt}} {{.HelpName}} --json /data/car/dealMetadata-5a3c8f21.csv
+`,
+}
+
+// swanTaskParams are the settings of a new swan task.
+type swanTaskParams struct {
+	Name          string
+	Description   string
+	Curated       bool
+	Public        bool
+	FastRetrieval bool
+	Verified      bool
+}
+
+// swanTask is a task as returned by the swan API.
+type swanTask struct {
+	UUID           string `json:"uuid"`
+	TaskName       string `json:"task_name"`
+	Description    string `json:"description"`
+	Status         string `json:"status"`
+	Type           string `json:"type"`
+	CuratedDataset string `json:"curated_dataset"`
+	CreatedOn      string `json:"created_on"`
+}
+
+// swanTaskDeal is a deal of a swan task.
+type swanTaskDeal struct {
+	MinerID    string `json:"miner_id"`
+	DealCid    string `json:"deal_cid"`
+	PayloadCid string `json:"payload_cid"`
+	PieceCid   string `json:"piece_cid"`
+	Status     string `json:"status"`
+}
+
+type swanTaskResponse struct {
+	Data struct {
+		Task  swanTask       `json:"task"`
+		Deals []swanTaskDeal `json:"deal"`
+	} `json:"data"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// swanTaskMessage container for swan task messages.
+type swanTaskMessage struct {
+	Status     string         `json:"status"`
+	TaskID     string         `json:"taskId"`
+	Name       string         `json:"name"`
+	TaskStatus string         `json:"taskStatus,omitempty"`
+	Type       string         `json:"type,omitempty"`
+	CsvFile    string         `json:"csvFile,omitempty"`
+	Deals      []swanTaskDeal `json:"deals,omitempty"`
+}
+
+// JSON jsonified swan task message.
+func (s swanTaskMessage) JSON() string {
+	taskJSONBytes, e := json.MarshalIndent(s, "", " ")
+	fatalIf(probe.NewError(e), "Unable to marshal into JSON.")
+
+	return string(taskJSONBytes)
+}
+
+// String colorized swan task message.
+func (s swanTaskMessage) String() string {
+	message := fmt.Sprintf("Task: %s, Name: %s", s.TaskID, s.Name)
+	if s.TaskStatus != "" {
+		message += ", Status: " + s.TaskStatus
+	}
+	if s.Type != "" {
+		message += ", Type: " + s.Type
+	}
+	if s.CsvFile != "" {
+		message += ", CSV: " + s.CsvFile
+	}
+	if len(s.Deals) > 0 {
+		message += "\n" + formatSwanTaskDealRow("Payload CID", "Miner", "Deal CID", "Status")
+	}
+	for _, deal := range s.Deals {
+		message += "\n" + formatSwanTaskDealRow(deal.PayloadCid, deal.MinerID, deal.DealCid, deal.Status)
+	}
+	return message
+}
+
+func formatSwanTaskDealRow(payloadCid, miner, dealCid, status string) string {
+	return fmt.Sprintf("  %*s %*s %*s %s",
+		-62, payloadCid,
+		-10, miner,
+		-64, dealCid,
+		status)
+}
+
+// swanTaskType is the type of the deals of a task for the swan API.
+func swanTaskType(verified bool) string {
+	if verified {
+		return "verified"
+	}
+	return "regular"
+}
+
+// swanFormBool formats a flag for the swan API.
+func swanFormBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// parseSwanTaskResponse decodes a task response of the swan API.
+func parseSwanTaskResponse(taskURL string, body []byte) (*swanTaskResponse, *probe.Error) {
+	response := &swanTaskResponse{}
+	if e := json.Unmarshal(body, response); e != nil {
+		return nil, probe.NewError(e).Trace(taskURL)
+	}
+	if response.Status != "success" {
+		return nil, errSwanAPI(taskURL, response.Message).Trace(taskURL)
+	}
+	return response, nil
+}
+
+// createSwanTask uploads a task CSV to the swan API and returns the task
+// created from it.
+func createSwanTask(ctx context.Context, params swanTaskParams, csvPath string) (*swanTask, *probe.Error) {
+	swan, err := loadSwanAPIConfig()
+	if err != nil {
+		return nil, err.Trace()
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	fields := [][2]string{
+		{"task_name", params.Name},
+		{"description", params.Description},
+		{"curated_dataset", swanFormBool(params.Curated)},
+		{"is_public", swanFormBool(params.Public)},
+		{"fast_retrieval", swanFormBool(params.FastRetrieval)},
+		{"type", swanTaskType(params.Verified)},
+	}
+	for _, field := range fields {
+		if e := writer.WriteField(field[0], field[1]); e != nil {
+			return nil, probe.NewError(e)
+		}
+	}
+	csvFile, e := os.Open(csvPath)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(csvPath)
+	}
+	defer csvFile.Close()
+	part, e := writer.CreateFormFile("file", filepath.Base(csvPath))
+	if e != nil {
+		return nil, probe.NewError(e).Trace(csvPath)
+	}
+	if _, e = io.Copy(part, csvFile); e != nil {
+		return nil, probe.NewError(e).Trace(csvPath)
+	}
+	if e = writer.Close(); e != nil {
+		return nil, probe.NewError(e).Trace(csvPath)
+	}
+
+	taskURL := swan.api + swanTasksPath
+	request, e := http.NewRequestWithContext(ctx, http.MethodPost, taskURL, &form)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(taskURL)
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	body, err := swan.do(request)
+	if err != nil {
+		return nil, err.Trace(csvPath)
+	}
+	response, err := parseSwanTaskResponse(taskURL, body)
+	if err != nil {
+		return nil, err.Trace(csvPath)
+	}
+	if response.Data.Task.UUID == "" {
+		return nil, errSwanAPI(taskURL, "no task ID in the response").Trace(csvPath)
+	}
+	return &response.Data.Task, nil
+}
+
+// getSwanTask looks up a task and its deals on the swan API, bypassing the
+// cache since the state of a task changes.
+func getSwanTask(ctx context.Context, taskID string) (*swanTaskResponse, *probe.Error) {
+	swan, err := loadSwanAPIConfig()
+	if err != nil {
+		return nil, err.Trace()
+	}
+	taskURL := swan.api + swanTasksPath + "/" + url.PathEscape(taskID)
+	request, e := http.NewRequestWithContext(ctx, http.MethodGet, taskURL, nil)
+	if e != nil {
+		return nil, probe.NewError(e).Trace(taskURL)
+	}
+	body, err := swan.do(request)
+	if err != nil {
+		return nil, err.Trace(taskID)
+	}
+	return parseSwanTaskResponse(taskURL, body)
+}
+
+// setCsvColumn sets a column of every row of a CSV file to value, the column
+// is added if the header does not have it. The other columns are kept.
+func setCsvColumn(csvPath, column, value string) *probe.Error {
+	return updateCsvColumns(csvPath, []string{column}, func(row map[string]string) *probe.Error {
+		row[column] = value
+		return nil
+	})
+}
+
+// updateCsvColumns calls update with every row of a CSV file by column name,
+// and writes back the columns it sets. The columns are added if the header
+// does not have them, the other columns are kept. The file is left as is
+// when update fails.
+func updateCsvColumns(csvPath string, columns []string, update func(row map[string]string) *probe.Error) *probe.Error {
+	csvFile, e := os.Open(csvPath)
+	if e != nil {
+		return probe.NewError(e).Trace(csvPath)
+	}
+	records, e := csv.NewReader(csvFile).ReadAll()
+	csvFile.Close()
+	if e != nil {
+		return probe.NewError(e).Trace(csvPath)
+	}
+	if len(records) == 0 {
+		return errInvalidArgument().Trace(csvPath)
+	}
+
+	indexes := make(map[string]int)
+	for i, name := range records[0] {
+		indexes[strings.TrimSpace(name)] = i
+	}
+	for _, column := range columns {
+		if _, ok := indexes[column]; !ok {
+			indexes[column] = len(records[0])
+			records[0] = append(records[0], column)
+		}
+	}
+	for i := 1; i < len(records); i++ {
+		for len(records[i]) < len(records[0]) {
+			records[i] = append(records[i], "")
+		}
+		row := make(map[string]string)
+		for name, index := range indexes {
+			row[name] = records[i][index]
+		}
+		if err := update(row); err != nil {
+			return err.Trace(csvPath)
+		}
+		for _, column := range columns {
+			records[i][indexes[column]] = row[column]
+		}
+	}
+
+	// Write to a temporary file first, so that an error does not leave
+	// a truncated CSV behind.
+	tmpPath := csvPath + ".tmp"
+	tmpFile, e := os.Create(tmpPath)
+	if e != nil {
+		return probe.NewError(e).Trace(csvPath)
+	}
+	if e = csv.NewWriter(tmpFile).WriteAll(records); e != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return probe.NewError(e).Trace(csvPath)
+	}
+	if e = tmpFile.Close(); e != nil {
+		os.Remove(tmpPath)
+		return probe.NewError(e).Trace(csvPath)
+	}
+	if e = os.Rename(tmpPath, csvPath); e != nil {
+		return probe.NewError(e).Trace(csvPath)
+	}
+	return nil
+}
+
+// checkSwanTaskCreateArgs returns the settings of the task and the CSV it is
+// created from.
+func checkSwanTaskCreateArgs(ctx *cli.Context) (swanTaskParams, string) {
+	args := ctx.Args()
+	if len(args) > 1 {
+		cli.ShowCommandHelpAndExit(ctx, "create", globalErrorExitStatus)
+	}
+	params := swanTaskParams{
+		Name:          strings.TrimSpace(ctx.String("name")),
+		Description:   strings.TrimSpace(ctx.String("description")),
+		Curated:       ctx.Bool("curated"),
+		Public:        ctx.Bool("public"),
+		FastRetrieval: ctx.BoolT("fast-retrieval"),
+		Verified:      ctx.Bool("verified"),
+	}
+	if params.Name == "" {
+		fatalIf(errInvalidArgument(), "Please provide a task name with --name.")
+	}
+
+	carDir := strings.TrimSpace(ctx.String("car-dir"))
+	csvPath := ""
+	if len(args) == 1 {
+		csvPath = strings.TrimSpace(args.First())
+	} else if carDir != "" {
+		csvPath = filepath.Join(carDir, carManifestName)
+	} else {
+		cli.ShowCommandHelpAndExit(ctx, "create", globalErrorExitStatus)
+	}
+	if _, e := os.Stat(csvPath); e != nil {
+		fatalIf(probe.NewError(e).Trace(csvPath), "Unable to read `"+csvPath+"`.")
+	}
+
+	deals, err := readDealCsv(csvPath)
+	fatalIf(err, "Unable to read `"+csvPath+"`.")
+	if len(deals) == 0 {
+		fatalIf(errInvalidArgument().Trace(csvPath), "No deal to create a task from in `"+csvPath+"`.")
+	}
+	// The miners of a task download its CAR files, check that none is
+	// missing before publishing it.
+	if carDir != "" {
+		for _, deal := range deals {
+			if findSliceCar(carDir, deal) == "" {
+				fatalIf(errInvalidArgument().Trace(deal.DataCid), "No CAR file for `"+deal.DataCid+"` in `"+carDir+"`.")
+			}
+		}
+	}
+	return params, csvPath
+}
+
+// mainSwanTaskCreate is the handle for "mc swan task create" command.
+func mainSwanTaskCreate(cliCtx *cli.Context) error {
+	ctx, cancelCreate := context.WithCancel(globalContext)
+	defer cancelCreate()
+
+	params, csvPath := checkSwanTaskCreateArgs(cliCtx)
+
+	task, err := createSwanTask(ctx, params, csvPath)
+	fatalIf(err, "Unable to create swan task `"+params.Name+"`.")
+
+	err = setCsvColumn(csvPath, swanTaskIDColumn, task.UUID)
+	fatalIf(err, "Unable to write the ID of task `"+task.UUID+"` to `"+csvPath+"`.")
+
+	name := task.TaskName
+	if name == "" {
+		name = params.Name
+	}
+	printMsg(swanTaskMessage{
+		Status:     "success",
+		TaskID:     task.UUID,
+		Name:       name,
+		TaskStatus: task.Status,
+		Type:       swanTaskType(params.Verified),
+		CsvFile:    csvPath,
+	})
+	return nil
+}
+
+// parseSwanTaskStatusArgs reads the tasks to look up from task IDs and CSV
+// files.
+func parseSwanTaskStatusArgs(ctx *cli.Context) []string {
+	if len(ctx.Args()) == 0 {
+		cli.ShowCommandHelpAndExit(ctx, "status", globalErrorExitStatus)
+	}
+
+	var taskIDs []string
+	for _, arg := range ctx.Args() {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			fatalIf(errInvalidArgument().Trace(ctx.Args()...), "Unable to validate empty argument.")
+		}
+		if _, e := os.Stat(arg); e != nil {
+			taskIDs = append(taskIDs, arg)
+			continue
+		}
+		deals, err := readDealCsv(arg)
+		fatalIf(err, "Unable to read tasks from `"+arg+"`.")
+		seen := make(map[string]bool)
+		for _, deal := range deals {
+			if deal.TaskId != "" && !seen[deal.TaskId] {
+				seen[deal.TaskId] = true
+				taskIDs = append(taskIDs, deal.TaskId)
+			}
+		}
+		if len(seen) == 0 {
+			fatalIf(errInvalidArgument().Trace(arg), "No task ID in `"+arg+"`, create the task with 'swan task create' first.")
+		}
+	}
+	return taskIDs
+}
+
+// mainSwanTaskStatus is the handle for "mc swan task status" command.
+func mainSwanTaskStatus(cliCtx *cli.Context) error {
+	ctx, cancelStatus := context.WithCancel(globalContext)
+	defer cancelStatus()
+
+	failed := false
+	for _, taskID := range parseSwanTaskStatusArgs(cliCtx) {
+		response, err := getSwanTask(ctx, taskID)
+		if err != nil {
+			errorIf(err, "Unable to get swan task `"+taskID+"`.")
+			failed = true
+			continue
+		}
+		printMsg(swanTaskMessage{
+			Status:     "success",
+			TaskID:     taskID,
+			Name:       response.Data.Task.TaskName,
+			TaskStatus: response.Data.Task.Status,
+			Type:       response.Data.Task.Type,
+			Deals:      response.Data.Deals,
+		})
+	}
+	if failed {
+		return exitStatus(globalErrorExitStatus)
+	}
+	return nil
+}
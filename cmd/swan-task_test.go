@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSwanTask(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response := swanTaskResponse{Status: "success"}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/tasks":
+			if e := r.ParseMultipartForm(1 << 20); e != nil {
+				t.Error(e)
+			}
+			form = make(map[string]string)
+			for name, values := range r.MultipartForm.Value {
+				form[name] = values[0]
+			}
+			if files := r.MultipartForm.File["file"]; len(files) != 1 || files[0].Filename != "dealMetadata-1.csv" {
+				t.Errorf("expected the deal csv to be uploaded, got %v", files)
+			}
+			response.Data.Task = swanTask{UUID: "task-1", TaskName: form["task_name"], Status: "Created"}
+		case r.Method == http.MethodGet && r.URL.Path == "/tasks/task-1":
+			response.Data.Task = swanTask{UUID: "task-1", TaskName: "dataset-1", Status: "Assigned"}
+			response.Data.Deals = []swanTaskDeal{{MinerID: "f01234", DealCid: "bafy2bzace", PayloadCid: "bafk2bzace", Status: "Active"}}
+		default:
+			response = swanTaskResponse{Status: "fail", Message: "task not found"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	savedAPI, savedToken := os.Getenv(swanAPIEnv), os.Getenv(swanTokenEnv)
+	os.Setenv(swanAPIEnv, server.URL)
+	os.Setenv(swanTokenEnv, "secret")
+	defer func() {
+		os.Setenv(swanAPIEnv, savedAPI)
+		os.Setenv(swanTokenEnv, savedToken)
+	}()
+
+	dir, e := ioutil.TempDir("", "swan-task")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	csvPath := filepath.Join(dir, "dealMetadata-1.csv")
+	csvData := "data_cid,filename,piece_cid,piece_size,deal_cid,miner_id,car_url,car_url_expiry\n" +
+		"bafk2bzace,a.car,baga6ea4sea,2032,bafy2bzace,f01234,,\n" +
+		"bafk2bzacf,b.car,baga6ea4seb,2032,bafy2bzacf,f05678,,\n"
+	if e = ioutil.WriteFile(csvPath, []byte(csvData), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	params := swanTaskParams{Name: "dataset-1", Public: true, FastRetrieval: true, Verified: true}
+	task, err := createSwanTask(context.Background(), params, csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedForm := map[string]string{
+		"task_name":       "dataset-1",
+		"description":     "",
+		"curated_dataset": "0",
+		"is_public":       "1",
+		"fast_retrieval":  "1",
+		"type":            "verified",
+	}
+	if !reflect.DeepEqual(form, expectedForm) {
+		t.Errorf("expected form %v, got %v", expectedForm, form)
+	}
+	if task.UUID != "task-1" {
+		t.Fatalf("expected task-1, got %s", task.UUID)
+	}
+
+	if err = setCsvColumn(csvPath, swanTaskIDColumn, task.UUID); err != nil {
+		t.Fatal(err)
+	}
+	// Setting the task ID again replaces it.
+	if err = setCsvColumn(csvPath, swanTaskIDColumn, task.UUID); err != nil {
+		t.Fatal(err)
+	}
+	deals, err := readDealCsv(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 2 || deals[1].TaskId != "task-1" || deals[1].MinerId != "f05678" {
+		t.Errorf("expected the task ID in every row, got %+v", deals)
+	}
+
+	response, err := getSwanTask(context.Background(), "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Data.Task.Status != "Assigned" || len(response.Data.Deals) != 1 {
+		t.Errorf("unexpected task %+v", response.Data)
+	}
+	if _, err = getSwanTask(context.Background(), "task-2"); err == nil {
+		t.Error("expected an error for an unknown task")
+	}
+}
+
+func TestWriteCsvAfterSetCsvColumn(t *testing.T) {
+	dir, e := ioutil.TempDir("", "swan-task")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	csvPath := filepath.Join(dir, "dealMetadata-1.csv")
+	writeCsv(csvPath, OfflineDeal{DataCid: "bafk2bzace", Filename: "a.car", DealCid: "bafy2bzace", MinerId: "f01234"})
+	if err := setCsvColumn(csvPath, swanTaskIDColumn, "task-1"); err != nil {
+		t.Fatal(err)
+	}
+	// A deal sent after the task was created fills the columns of the header.
+	writeCsv(csvPath, OfflineDeal{DataCid: "bafk2bzacf", Filename: "b.car", DealCid: "bafy2bzacf", MinerId: "f05678", TaskId: "task-2"})
+
+	deals, err := readDealCsv(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 2 {
+		t.Fatalf("expected 2 deals, got %d", len(deals))
+	}
+	if deals[0].TaskId != "task-1" || deals[1].TaskId != "task-2" || deals[1].MinerId != "f05678" {
+		t.Errorf("unexpected deals %+v, %+v", *deals[0], *deals[1])
+	}
+}
@@ -126,3 +126,87 @@ var errConflictSSE = func(sseServer, sseKeys string) *probe.Error {
 	err := fmt.Errorf("SSE alias '%s' overlaps with SSE-C aliases '%s'", sseServer, sseKeys)
 	return probe.NewError(conflictSSEErr(err)).Untrace()
 }
+
+type lotusNotConfiguredErr error
+
+var errLotusNotConfigured = func() *probe.Error {
+	msg := "Lotus API is not configured, please set $" + lotusAPIInfoEnv + " or the `lotus` entry in mc config."
+	return probe.NewError(lotusNotConfiguredErr(errors.New(msg))).Untrace()
+}
+
+type invalidLotusAPIErr error
+
+var errInvalidLotusAPI = func(apiInfo string) *probe.Error {
+	msg := "Lotus API `" + apiInfo + "` should be of the form TOKEN:/ip4/<host>/tcp/<port>/http or http(s)://host:port."
+	return probe.NewError(invalidLotusAPIErr(errors.New(msg))).Untrace()
+}
+
+type lotusAPIErr error
+
+var errLotusAPI = func(method, msg string) *probe.Error {
+	msg = "Lotus API `" + method + "` failed: " + msg
+	return probe.NewError(lotusAPIErr(errors.New(msg))).Untrace()
+}
+
+type corruptedCarErr error
+
+var errCorruptedCar = func(carPath, msg string) *probe.Error {
+	msg = "CAR file `" + carPath + "` is corrupted: " + msg
+	return probe.NewError(corruptedCarErr(errors.New(msg))).Untrace()
+}
+
+type corruptedBlockErr error
+
+var errCorruptedBlock = func(c, msg string) *probe.Error {
+	msg = "Block `" + c + "` " + msg + "."
+	return probe.NewError(corruptedBlockErr(errors.New(msg))).Untrace()
+}
+
+type noMatchingMinerErr error
+
+var errNoMatchingMiner = func(pieceSize string) *probe.Error {
+	msg := "No miner of the swan miner list matches the filters for a piece of size " + pieceSize + "."
+	return probe.NewError(noMatchingMinerErr(errors.New(msg))).Untrace()
+}
+
+type invalidNetworkErr error
+
+var errInvalidNetwork = func(network string) *probe.Error {
+	msg := "Network `" + network + "` is unknown or has no block time, define it in `networks` of the config file."
+	return probe.NewError(invalidNetworkErr(errors.New(msg))).Untrace()
+}
+
+type epochDriftErr error
+
+var errEpochDrift = func(local, head int64) *probe.Error {
+	msg := fmt.Sprintf("Local clock gives epoch %d but the chain head is at epoch %d.", local, head)
+	return probe.NewError(epochDriftErr(errors.New(msg))).Untrace()
+}
+
+type swanAPIErr error
+
+var errSwanAPI = func(pageURL, status string) *probe.Error {
+	msg := "Swan API request `" + pageURL + "` failed: " + status
+	return probe.NewError(swanAPIErr(errors.New(msg))).Untrace()
+}
+
+type noRetrievalOfferErr error
+
+var errNoRetrievalOffer = func(dataCid, reason string) *probe.Error {
+	msg := "No miner offers to retrieve `" + dataCid + "`: " + reason
+	return probe.NewError(noRetrievalOfferErr(errors.New(msg))).Untrace()
+}
+
+type unknownShareURLErr error
+
+var errUnknownShareURL = func(shareURL string) *probe.Error {
+	msg := "No alias is configured for the shared URL `" + shareURL + "`, add one for its host with `mc alias set`."
+	return probe.NewError(unknownShareURLErr(errors.New(msg))).Untrace()
+}
+
+type tooManyTagsErr error
+
+var errTooManyTags = func(dropped []string) *probe.Error {
+	msg := fmt.Sprintf("An object holds at most %d tags, `%s` left out. Remove some tags of the object to make room for them.", maxObjectTags, strings.Join(dropped, "`, `"))
+	return probe.NewError(tooManyTagsErr(errors.New(msg))).Untrace()
+}
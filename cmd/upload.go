@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filswan/fs3-mc/pkg/probe"
+	"github.com/minio/cli"
+)
+
+// uploadFlags are shared by the commands uploading their output to an alias.
+var uploadFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "upload-to",
+		Usage: "upload the output to an alias configured with `mc alias set`, e.g. myalias/swan/batch-42",
+	},
+}
+
+// checkUploadTarget verifies that targetURL refers to a configured alias.
+func checkUploadTarget(targetURL string) *probe.Error {
+	_, _, hostCfg, err := expandAlias(targetURL)
+	if err != nil {
+		return err.Trace(targetURL)
+	}
+	if hostCfg == nil {
+		return errInvalidAliasedURL(targetURL).Trace(targetURL)
+	}
+	return nil
+}
+
+// uploadFiles copies local files into the targetURL folder through a copy
+// session, the same way `mc cp --continue` does. A session interrupted by
+// the user is kept and resumed by the next upload of the same files to the
+// same target.
+func uploadFiles(cliCtx *cli.Context, filePaths []string, targetURL string) *probe.Error {
+	ctx, cancelCopy := context.WithCancel(globalContext)
+	defer cancelCopy()
+
+	if !strings.HasSuffix(targetURL, "/") {
+		targetURL += "/"
+	}
+	args, err := uploadArgs(filePaths, targetURL)
+	if err != nil {
+		return err.Trace(targetURL)
+	}
+
+	// Make the bucket and prefix if they do not exist.
+	clnt, err := newClient(targetURL)
+	if err != nil {
+		return err.Trace(targetURL)
+	}
+	if err = clnt.MakeBucket(ctx, "us-east-1", true, false); err != nil {
+		return err.Trace(targetURL)
+	}
+
+	encKeyDB, err := getEncKeys(cliCtx)
+	if err != nil {
+		return err.Trace(targetURL)
+	}
+
+	flagSet := flag.NewFlagSet("upload", flag.ContinueOnError)
+	if e := flagSet.Parse(append([]string{"--"}, args...)); e != nil {
+		return probe.NewError(e).Trace(args...)
+	}
+	copyCtx := cli.NewContext(cliCtx.App, flagSet, cliCtx)
+
+	session, err := uploadSession(args)
+	if err != nil {
+		return err.Trace(targetURL)
+	}
+
+	e := doCopySession(ctx, cancelCopy, copyCtx, session, encKeyDB, false)
+	session.Delete()
+	if e != nil {
+		return probe.NewError(e).Trace(targetURL)
+	}
+	return nil
+}
+
+// uploadArgs returns the `cp` arguments of an upload, the absolute paths of
+// the files followed by the target folder.
+func uploadArgs(filePaths []string, targetURL string) ([]string, *probe.Error) {
+	args := make([]string, 0, len(filePaths)+1)
+	for _, filePath := range filePaths {
+		absPath, e := filepath.Abs(filePath)
+		if e != nil {
+			return nil, probe.NewError(e).Trace(filePath)
+		}
+		args = append(args, absPath)
+	}
+	return append(args, targetURL), nil
+}
+
+// uploadSession returns the copy session of an upload, the session left by
+// an interrupted upload of the same arguments when there is one.
+func uploadSession(args []string) (*sessionV8, *probe.Error) {
+	sessionID := getHash("upload", args)
+	if isSessionExists(sessionID) {
+		session, err := loadSessionV8(sessionID)
+		if err != nil {
+			return nil, err.Trace(sessionID)
+		}
+		return session, nil
+	}
+
+	session := newSessionV8(sessionID)
+	session.Header.CommandType = "cp"
+	session.Header.CommandBoolFlags["session"] = true
+	session.Header.CommandArgs = args
+
+	var e error
+	if session.Header.RootPath, e = os.Getwd(); e != nil {
+		session.Delete()
+		return nil, probe.NewError(e)
+	}
+	return session, nil
+}
+
+// shareUploadedFiles generates presigned download URLs for files uploaded
+// into the targetURL folder and saves them in the share DB, the same way
+// `mc share download` does. It returns the URLs by local file path.
+func shareUploadedFiles(ctx context.Context, filePaths []string, targetURL string, expiry time.Duration) (map[string]string, *probe.Error) {
+	shareDB := newShareDBV1()
+	shareDownloadsFile := getShareDownloadsFile()
+	if err := shareDB.Load(shareDownloadsFile); err != nil {
+		return nil, err.Trace(shareDownloadsFile)
+	}
+
+	shareURLs := make(map[string]string)
+	for _, filePath := range filePaths {
+		objectURL := urlJoinPath(targetURL, filepath.Base(filePath))
+		alias, objectURLFull, _, err := expandAlias(objectURL)
+		if err != nil {
+			return nil, err.Trace(objectURL)
+		}
+		clnt, err := newClientFromAlias(alias, objectURLFull)
+		if err != nil {
+			return nil, err.Trace(objectURL)
+		}
+		shareURL, err := clnt.ShareDownload(ctx, "", expiry)
+		if err != nil {
+			return nil, err.Trace(objectURL, "expiry="+expiry.String())
+		}
+
+		// Not useful for download shares.
+		contentType := ""
+		shareDB.Set(clnt.GetURL().String(), shareURL, expiry, contentType)
+		shareURLs[filePath] = shareURL
+	}
+	return shareURLs, shareDB.Save(shareDownloadsFile)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/cli"
+)
+
+func TestUploadFiles(t *testing.T) {
+	defer setTestConfigDir(t)()
+
+	dir, e := ioutil.TempDir("", "mc-upload")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	quiet := globalQuiet
+	globalQuiet = true
+	defer func() { globalQuiet = quiet }()
+	if err := createSessionDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	var filePaths []string
+	for _, name := range []string{"first.car", "second.car", carManifestName} {
+		filePath := filepath.Join(dir, name)
+		if e = ioutil.WriteFile(filePath, []byte(name), 0644); e != nil {
+			t.Fatal(e)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	cliCtx := cli.NewContext(cli.NewApp(), flag.NewFlagSet("upload", flag.ContinueOnError), nil)
+
+	// An upload to a new target.
+	target := filepath.Join(dir, "target", "batch-1")
+	if err := uploadFiles(cliCtx, filePaths, target); err != nil {
+		t.Fatal(err)
+	}
+	for _, filePath := range filePaths {
+		data, e := ioutil.ReadFile(filepath.Join(target, filepath.Base(filePath)))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if string(data) != filepath.Base(filePath) {
+			t.Errorf("unexpected content %q of %s", data, filePath)
+		}
+	}
+	args, err := uploadArgs(filePaths, target+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isSessionExists(getHash("upload", args)) {
+		t.Error("expected the session of a complete upload to be removed")
+	}
+
+	// An upload interrupted after its first file is resumed from its
+	// session, the first file is not copied again.
+	target = filepath.Join(dir, "target", "batch-2")
+	args, err = uploadArgs(filePaths, target+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e = os.MkdirAll(target, 0755); e != nil {
+		t.Fatal(e)
+	}
+	session, err := uploadSession(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Header.TotalBytes, session.Header.TotalObjects = doPrepareCopyURLs(context.Background(), session, func() {})
+	session.Header.LastCopied = args[0]
+	if err = session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !isSessionExists(session.SessionID) {
+		t.Fatal("expected the session of an interrupted upload to be saved")
+	}
+	if err = uploadFiles(cliCtx, filePaths, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, e = os.Stat(filepath.Join(target, "first.car")); !os.IsNotExist(e) {
+		t.Errorf("expected first.car not to be copied again, got %v", e)
+	}
+	for _, name := range []string{"second.car", carManifestName} {
+		if _, e = os.Stat(filepath.Join(target, name)); e != nil {
+			t.Error(e)
+		}
+	}
+	if isSessionExists(session.SessionID) {
+		t.Error("expected the session of a resumed upload to be removed")
+	}
+}
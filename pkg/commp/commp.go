@@ -0,0 +1,188 @@
+// Package commp computes the piece commitment (CommP) of Filecoin pieces in
+// pure Go, without filecoin-ffi. The data is zero padded to the unpadded size
+// of its piece, Fr32 padded and hashed into a binary merkle tree of
+// SHA2-256 nodes truncated to 254 bits.
+package commp
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+const (
+	// NodeSize is the size of a merkle tree node.
+	NodeSize = 32
+
+	// MinPieceSize is the padded size of the smallest piece.
+	MinPieceSize = 128
+
+	// MaxPieceSize is the padded size of the largest piece, for 64GiB sectors.
+	MaxPieceSize = 64 << 30
+
+	// quantum of unpadded data which is Fr32 padded into 4 nodes.
+	unpaddedQuantum = 127
+	paddedQuantum   = 128
+
+	// maxLevels is the height of the tree of the largest piece.
+	maxLevels = 31
+)
+
+// ErrPieceTooLarge is returned when more data than the largest piece is written.
+var ErrPieceTooLarge = errors.New("data does not fit in a piece of 64GiB")
+
+// zeroComms are the roots of the trees of zero data, by level.
+var zeroComms [maxLevels + 1][NodeSize]byte
+
+func init() {
+	for level := 1; level <= maxLevels; level++ {
+		zeroComms[level] = hashNodes(&zeroComms[level-1], &zeroComms[level-1])
+	}
+}
+
+// PaddedSize returns the padded size of the piece holding size bytes of data,
+// the next power of two of their Fr32 padded size.
+func PaddedSize(size uint64) uint64 {
+	if size <= unpaddedQuantum {
+		return MinPieceSize
+	}
+	padded := (size + unpaddedQuantum - 1) / unpaddedQuantum * paddedQuantum
+	if bits.OnesCount64(padded) != 1 {
+		padded = 1 << uint(64-bits.LeadingZeros64(padded))
+	}
+	return padded
+}
+
+// UnpaddedSize returns the unpadded size of a padded piece size.
+func UnpaddedSize(padded uint64) uint64 {
+	return padded - padded/paddedQuantum
+}
+
+// ZeroComm returns the commitment of a piece of zeros of the given padded size.
+func ZeroComm(padded uint64) [NodeSize]byte {
+	return zeroComms[bits.TrailingZeros64(padded/NodeSize)]
+}
+
+// hashNodes returns the parent of two nodes.
+func hashNodes(left, right *[NodeSize]byte) [NodeSize]byte {
+	var buf [2 * NodeSize]byte
+	copy(buf[:NodeSize], left[:])
+	copy(buf[NodeSize:], right[:])
+	node := sha256.Sum256(buf[:])
+	node[NodeSize-1] &= 0x3f
+	return node
+}
+
+// pad Fr32 pads 127 bytes into 128 bytes, 4 field elements of 254 bits
+// followed by 2 zero bits.
+func pad(in, out []byte) {
+	copy(out[:31], in[:31])
+
+	t := in[31] >> 6
+	out[31] = in[31] & 0x3f
+	var v byte
+
+	for i := 32; i < 64; i++ {
+		v = in[i]
+		out[i] = (v << 2) | t
+		t = v >> 6
+	}
+
+	t = v >> 4
+	out[63] &= 0x3f
+
+	for i := 64; i < 96; i++ {
+		v = in[i]
+		out[i] = (v << 4) | t
+		t = v >> 4
+	}
+
+	t = v >> 2
+	out[95] &= 0x3f
+
+	for i := 96; i < 127; i++ {
+		v = in[i]
+		out[i] = (v << 6) | t
+		t = v >> 2
+	}
+
+	out[127] = t & 0x3f
+}
+
+// Writer computes the piece commitment of the data written to it. Only the
+// pending nodes of every level of the tree are kept in memory.
+type Writer struct {
+	size    uint64
+	buf     [unpaddedQuantum]byte
+	buffed  int
+	padded  [paddedQuantum]byte
+	pending [maxLevels + 1]*[NodeSize]byte
+}
+
+// Write hashes p into the tree.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.size+uint64(len(p)) > UnpaddedSize(MaxPieceSize) {
+		return 0, ErrPieceTooLarge
+	}
+	n := len(p)
+	w.size += uint64(n)
+	for len(p) > 0 {
+		copied := copy(w.buf[w.buffed:], p)
+		w.buffed += copied
+		p = p[copied:]
+		if w.buffed == unpaddedQuantum {
+			w.addQuantum()
+		}
+	}
+	return n, nil
+}
+
+// addQuantum pads the buffered data and adds its 4 leaves to the tree.
+func (w *Writer) addQuantum() {
+	pad(w.buf[:], w.padded[:])
+	for i := 0; i < paddedQuantum; i += NodeSize {
+		var leaf [NodeSize]byte
+		copy(leaf[:], w.padded[i:i+NodeSize])
+		w.addNode(leaf, 0)
+	}
+	w.buf = [unpaddedQuantum]byte{}
+	w.buffed = 0
+}
+
+// addNode adds a node at a level of the tree, hashing it with the pending
+// left nodes it completes.
+func (w *Writer) addNode(node [NodeSize]byte, level int) {
+	for w.pending[level] != nil {
+		node = hashNodes(w.pending[level], &node)
+		w.pending[level] = nil
+		level++
+	}
+	w.pending[level] = &node
+}
+
+// Size returns the number of bytes written.
+func (w *Writer) Size() uint64 {
+	return w.size
+}
+
+// Sum returns the piece commitment and the padded piece size of the data
+// written so far. The writer must not be written to afterwards.
+func (w *Writer) Sum() ([NodeSize]byte, uint64) {
+	padded := PaddedSize(w.size)
+	if w.buffed > 0 {
+		w.addQuantum()
+	}
+
+	// The rest of the piece is zeros, every pending node gets the zero
+	// tree of its level as right sibling.
+	root := bits.TrailingZeros64(padded / NodeSize)
+	for level := 0; level < root; level++ {
+		if w.pending[level] != nil {
+			w.addNode(zeroComms[level], level)
+		}
+	}
+	if w.pending[root] == nil {
+		return zeroComms[root], padded
+	}
+	return *w.pending[root], padded
+}
@@ -0,0 +1,117 @@
+package commp
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// pattern returns deterministic test data.
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte((i*7 + 3) % 251)
+	}
+	return data
+}
+
+func TestPaddedSize(t *testing.T) {
+	testCases := []struct {
+		size   uint64
+		padded uint64
+	}{
+		{0, 128},
+		{1, 128},
+		{127, 128},
+		{128, 256},
+		{254, 256},
+		{255, 512},
+		{1016, 1024},
+		{1017, 2048},
+		{32<<30 - 32<<30/128, 32 << 30},
+		{32<<30 - 32<<30/128 + 1, 64 << 30},
+	}
+	for i, testCase := range testCases {
+		if padded := PaddedSize(testCase.size); padded != testCase.padded {
+			t.Errorf("Test %d: expected %d, got %d", i+1, testCase.padded, padded)
+		}
+		if unpadded := UnpaddedSize(testCase.padded); unpadded < testCase.size {
+			t.Errorf("Test %d: unpadded size %d smaller than %d", i+1, unpadded, testCase.size)
+		}
+	}
+}
+
+func TestZeroComm(t *testing.T) {
+	// The commitments of zero pieces used by lotus for empty sectors.
+	testCases := []struct {
+		padded uint64
+		comm   string
+	}{
+		{32, "0000000000000000000000000000000000000000000000000000000000000000"},
+		{64, "f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a92759fb0b"},
+		{128, "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333"},
+		{256, "642a607ef886b004bf2c1978463ae1d4693ac0f410eb2d1b7a47fe205e5e750f"},
+	}
+	for i, testCase := range testCases {
+		comm := ZeroComm(testCase.padded)
+		if got := hex.EncodeToString(comm[:]); got != testCase.comm {
+			t.Errorf("Test %d: expected %s, got %s", i+1, testCase.comm, got)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	// The commitments of go-fil-commp-hashhash v0.1.0 for the same data, it
+	// does not define them below 65 bytes: no data is a zero piece.
+	testCases := []struct {
+		size   int
+		padded uint64
+		comm   string
+	}{
+		{0, 128, "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333"},
+		{65, 128, "852c70fe179fcbb5b3c3ecd857f3a560ee29f6a2e865154906cbfe442db13820"},
+		{127, 128, "471ba531719d0e7b9209af629cb26747b5f7dba8ef46ea962ed654f078f7461f"},
+		{128, 256, "4e29802edc91048caf57fa029212f5a57236beac774913bac7ada7c2ba703c10"},
+		{254, 256, "d86fcd0f28277b4783c51f4171f16c3b3ae480cfadf62021938ce1a4f805d919"},
+		{1000, 1024, "2318edbf213a39370dce99c9d25a1bbbc95356022bf3e34fdd8b59af10ff4534"},
+		{1021, 2048, "4c77dc3fff88fedd6642a6ca5eed36e9a3e7fcf8d0b0682aefb12eff97c3ad23"},
+		{4064, 4096, "54936116fa5b8b849b8b01e33872a3f667dd57c77cfc63f01af25b2c5523e31f"},
+		{10000, 16384, "c6de3390c76e7db34712cd1584076f29c609aac2fb5b82897ebc87eb21e8493a"},
+		{130048, 131072, "a282de57deed730beb140f7e1bc42194222f347fa7e0276bbd74b81b2053963a"},
+		{130049, 262144, "a319e33211fedbe1042e97b467043ad951ed76402fee1f232987b098628f593d"},
+	}
+	for i, testCase := range testCases {
+		data := pattern(testCase.size)
+		// Uneven writes must not change the commitment.
+		for _, step := range []int{testCase.size + 1, 1, 100, 4096} {
+			w := &Writer{}
+			for off := 0; off < len(data); off += step {
+				end := off + step
+				if end > len(data) {
+					end = len(data)
+				}
+				if _, e := w.Write(data[off:end]); e != nil {
+					t.Fatalf("Test %d: %v", i+1, e)
+				}
+			}
+			comm, padded := w.Sum()
+			if got := hex.EncodeToString(comm[:]); got != testCase.comm || padded != testCase.padded {
+				t.Errorf("Test %d, writes of %d: expected (%s, %d), got (%s, %d)", i+1, step, testCase.comm, testCase.padded, got, padded)
+			}
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	in := make([]byte, unpaddedQuantum)
+	for i := range in {
+		in[i] = 0xff
+	}
+	out := make([]byte, paddedQuantum)
+	pad(in, out)
+	// Every field element keeps its 2 most significant bits clear.
+	for i := NodeSize - 1; i < paddedQuantum; i += NodeSize {
+		if out[i] != 0x3f {
+			t.Errorf("byte %d: expected 0x3f, got %#x", i, out[i])
+		}
+	}
+}